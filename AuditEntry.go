@@ -0,0 +1,151 @@
+package vaultstore
+
+import (
+	"strconv"
+
+	"github.com/dromara/carbon/v2"
+	"github.com/gouniverse/dataobject"
+	"github.com/gouniverse/uid"
+)
+
+// == CLASS ==================================================================
+
+type auditEntry struct {
+	dataobject.DataObject
+}
+
+// == CONSTRUCTORS ===========================================================
+
+func NewAuditEntry() AuditEntryInterface {
+	d := (&auditEntry{}).
+		SetID(uid.HumanUid()).
+		SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+		SetHmac("")
+
+	return d
+}
+
+func NewAuditEntryFromExistingData(data map[string]string) AuditEntryInterface {
+	o := &auditEntry{}
+	o.Hydrate(data)
+	return o
+}
+
+// == SETTERS AND GETTERS ====================================================
+
+func (v *auditEntry) GetAction() string {
+	return v.Get(COLUMN_ACTION)
+}
+
+func (v *auditEntry) SetAction(action string) AuditEntryInterface {
+	v.Set(COLUMN_ACTION, action)
+	return v
+}
+
+func (v *auditEntry) GetActor() string {
+	return v.Get(COLUMN_ACTOR)
+}
+
+func (v *auditEntry) SetActor(actor string) AuditEntryInterface {
+	v.Set(COLUMN_ACTOR, actor)
+	return v
+}
+
+func (v *auditEntry) GetCreatedAt() string {
+	return v.Get(COLUMN_CREATED_AT)
+}
+
+func (v *auditEntry) SetCreatedAt(createdAt string) AuditEntryInterface {
+	v.Set(COLUMN_CREATED_AT, createdAt)
+	return v
+}
+
+func (v *auditEntry) GetHash() string {
+	return v.Get(COLUMN_HASH)
+}
+
+func (v *auditEntry) SetHash(hash string) AuditEntryInterface {
+	v.Set(COLUMN_HASH, hash)
+	return v
+}
+
+func (v *auditEntry) GetHmac() string {
+	return v.Get(COLUMN_HMAC)
+}
+
+func (v *auditEntry) SetHmac(hmac string) AuditEntryInterface {
+	v.Set(COLUMN_HMAC, hmac)
+	return v
+}
+
+func (v *auditEntry) GetID() string {
+	return v.Get(COLUMN_ID)
+}
+
+func (v *auditEntry) SetID(id string) AuditEntryInterface {
+	v.Set(COLUMN_ID, id)
+	return v
+}
+
+// GetNamespace returns the namespace of the call, empty for the default namespace
+func (v *auditEntry) GetNamespace() string {
+	return v.Get(COLUMN_NAMESPACE)
+}
+
+func (v *auditEntry) SetNamespace(namespace string) AuditEntryInterface {
+	v.Set(COLUMN_NAMESPACE, namespace)
+	return v
+}
+
+func (v *auditEntry) GetOutcome() string {
+	return v.Get(COLUMN_OUTCOME)
+}
+
+func (v *auditEntry) SetOutcome(outcome string) AuditEntryInterface {
+	v.Set(COLUMN_OUTCOME, outcome)
+	return v
+}
+
+func (v *auditEntry) GetPrevHash() string {
+	return v.Get(COLUMN_PREV_HASH)
+}
+
+func (v *auditEntry) SetPrevHash(prevHash string) AuditEntryInterface {
+	v.Set(COLUMN_PREV_HASH, prevHash)
+	return v
+}
+
+func (v *auditEntry) GetPurpose() string {
+	return v.Get(COLUMN_PURPOSE)
+}
+
+func (v *auditEntry) SetPurpose(purpose string) AuditEntryInterface {
+	v.Set(COLUMN_PURPOSE, purpose)
+	return v
+}
+
+// GetSequence returns the position of the entry in the audit chain,
+// starting at 1, or 0 if the entry is not chained yet
+func (v *auditEntry) GetSequence() int64 {
+	sequence, err := strconv.ParseInt(v.Get(COLUMN_SEQUENCE), 10, 64)
+
+	if err != nil {
+		return 0
+	}
+
+	return sequence
+}
+
+func (v *auditEntry) SetSequence(sequence int64) AuditEntryInterface {
+	v.Set(COLUMN_SEQUENCE, strconv.FormatInt(sequence, 10))
+	return v
+}
+
+func (v *auditEntry) GetToken() string {
+	return v.Get(COLUMN_VAULT_TOKEN)
+}
+
+func (v *auditEntry) SetToken(token string) AuditEntryInterface {
+	v.Set(COLUMN_VAULT_TOKEN, token)
+	return v
+}
@@ -1,6 +1,10 @@
 package vaultstore
 
 import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
 	"github.com/dromara/carbon/v2"
 	"github.com/gouniverse/dataobject"
 	"github.com/gouniverse/sb"
@@ -20,7 +24,18 @@ func NewRecord() RecordInterface {
 		SetID(uid.HumanUid()).
 		SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
 		SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
-		SetSoftDeletedAt(sb.MAX_DATETIME)
+		SetSoftDeletedAt(sb.MAX_DATETIME).
+		SetExpiresAt(sb.MAX_DATETIME).
+		SetReadsRemaining(READS_UNLIMITED).
+		SetRevision(1).
+		SetNamespace("").
+		SetOwner("").
+		SetAcl([]AclEntry{}).
+		SetMetadata(map[string]string{}).
+		SetValueHmac("").
+		SetBlindIndex("").
+		SetBlindIndexPrefix("").
+		SetBlindIndexSuffix("")
 
 	return d
 }
@@ -35,6 +50,33 @@ func NewRecordFromExistingData(data map[string]string) RecordInterface {
 
 // == SETTERS AND GETTERS ====================================================
 
+// GetAcl returns the access control list of the token
+func (v *record) GetAcl() ([]AclEntry, error) {
+	acl := []AclEntry{}
+
+	if v.Get(COLUMN_ACL) == "" {
+		return acl, nil
+	}
+
+	if err := json.Unmarshal([]byte(v.Get(COLUMN_ACL)), &acl); err != nil {
+		return []AclEntry{}, errors.New("acl malformed: " + err.Error())
+	}
+
+	return acl, nil
+}
+
+func (v *record) SetAcl(acl []AclEntry) RecordInterface {
+	if acl == nil {
+		acl = []AclEntry{}
+	}
+
+	// a slice of structs with string fields always marshals
+	encoded, _ := json.Marshal(acl)
+
+	v.Set(COLUMN_ACL, string(encoded))
+	return v
+}
+
 func (v *record) GetCreatedAt() string {
 	return v.Get(COLUMN_CREATED_AT)
 }
@@ -44,6 +86,15 @@ func (v *record) SetCreatedAt(createdAt string) RecordInterface {
 	return v
 }
 
+func (v *record) GetExpiresAt() string {
+	return v.Get(COLUMN_EXPIRES_AT)
+}
+
+func (v *record) SetExpiresAt(expiresAt string) RecordInterface {
+	v.Set(COLUMN_EXPIRES_AT, expiresAt)
+	return v
+}
+
 func (v *record) GetSoftDeletedAt() string {
 	return v.Get(COLUMN_SOFT_DELETED_AT)
 }
@@ -62,6 +113,129 @@ func (v *record) SetID(id string) RecordInterface {
 	return v
 }
 
+// GetReadsRemaining returns the number of reads left before the token
+// is deleted, or READS_UNLIMITED if the token has no read limit
+func (v *record) GetReadsRemaining() int {
+	readsRemaining, err := strconv.Atoi(v.Get(COLUMN_READS_REMAINING))
+
+	if err != nil {
+		return READS_UNLIMITED
+	}
+
+	return readsRemaining
+}
+
+func (v *record) SetReadsRemaining(readsRemaining int) RecordInterface {
+	v.Set(COLUMN_READS_REMAINING, strconv.Itoa(readsRemaining))
+	return v
+}
+
+// GetRevision returns the revision of the record, incremented by every
+// update, or 0 for the records created before revisions were added
+func (v *record) GetRevision() int {
+	revision, err := strconv.Atoi(v.Get(COLUMN_REVISION))
+
+	if err != nil {
+		return 0
+	}
+
+	return revision
+}
+
+func (v *record) SetRevision(revision int) RecordInterface {
+	v.Set(COLUMN_REVISION, strconv.Itoa(revision))
+	return v
+}
+
+// GetBlindIndex returns the keyed HMAC of the normalized value
+func (v *record) GetBlindIndex() string {
+	return v.Get(COLUMN_BLIND_INDEX)
+}
+
+func (v *record) SetBlindIndex(blindIndex string) RecordInterface {
+	v.Set(COLUMN_BLIND_INDEX, blindIndex)
+	return v
+}
+
+// GetBlindIndexPrefix returns the keyed HMAC of the prefix of the normalized value
+func (v *record) GetBlindIndexPrefix() string {
+	return v.Get(COLUMN_BLIND_INDEX_PREFIX)
+}
+
+func (v *record) SetBlindIndexPrefix(blindIndexPrefix string) RecordInterface {
+	v.Set(COLUMN_BLIND_INDEX_PREFIX, blindIndexPrefix)
+	return v
+}
+
+// GetBlindIndexSuffix returns the keyed HMAC of the suffix of the normalized value
+func (v *record) GetBlindIndexSuffix() string {
+	return v.Get(COLUMN_BLIND_INDEX_SUFFIX)
+}
+
+func (v *record) SetBlindIndexSuffix(blindIndexSuffix string) RecordInterface {
+	v.Set(COLUMN_BLIND_INDEX_SUFFIX, blindIndexSuffix)
+	return v
+}
+
+// GetMetadata returns the non-secret metadata of the token, i.e. its labels
+func (v *record) GetMetadata() (map[string]string, error) {
+	metadata := map[string]string{}
+
+	if v.Get(COLUMN_METADATA) == "" {
+		return metadata, nil
+	}
+
+	if err := json.Unmarshal([]byte(v.Get(COLUMN_METADATA)), &metadata); err != nil {
+		return map[string]string{}, errors.New("metadata malformed: " + err.Error())
+	}
+
+	return metadata, nil
+}
+
+// SetMetadata sets the non-secret metadata of the token, never store
+// secrets in the metadata, it is saved in plain text to be queryable
+func (v *record) SetMetadata(metadata map[string]string) RecordInterface {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+
+	// a map of strings always marshals, with its keys sorted,
+	// the label filters of the record query rely on this
+	encoded, _ := json.Marshal(metadata)
+
+	v.Set(COLUMN_METADATA, string(encoded))
+	return v
+}
+
+// GetValueHmac returns the keyed HMAC of the value of a deterministic
+// token, empty for random tokens
+func (v *record) GetValueHmac() string {
+	return v.Get(COLUMN_VALUE_HMAC)
+}
+
+func (v *record) SetValueHmac(valueHmac string) RecordInterface {
+	v.Set(COLUMN_VALUE_HMAC, valueHmac)
+	return v
+}
+
+func (v *record) GetNamespace() string {
+	return v.Get(COLUMN_NAMESPACE)
+}
+
+func (v *record) SetNamespace(namespace string) RecordInterface {
+	v.Set(COLUMN_NAMESPACE, namespace)
+	return v
+}
+
+func (v *record) GetOwner() string {
+	return v.Get(COLUMN_OWNER)
+}
+
+func (v *record) SetOwner(owner string) RecordInterface {
+	v.Set(COLUMN_OWNER, owner)
+	return v
+}
+
 func (v *record) GetToken() string {
 	return v.Get(COLUMN_VAULT_TOKEN)
 }
@@ -2,6 +2,7 @@ package vaultstore
 
 import (
 	"context"
+	"errors"
 	"log"
 	"log/slog"
 
@@ -12,33 +13,104 @@ import (
 	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
 	_ "github.com/doug-martin/goqu/v9/dialect/sqlserver"
 	"github.com/gouniverse/base/database"
+	"github.com/gouniverse/sb"
 )
 
 // Store defines a session store
 type Store struct {
-	vaultTableName     string
-	db                 *sql.DB
-	dbDriverName       string
-	automigrateEnabled bool
-	debugEnabled       bool
-	logger             *slog.Logger
+	vaultTableName        string
+	vaultVersionTableName string
+	maxVersions           int
+	auditEnabled          bool
+	auditTableName        string
+	auditHmacKey          []byte
+	auditErrorHandler     func(err error)
+	deterministicKey      []byte
+	blindIndex            BlindIndexOptions
+	defaultTokenFormat    TokenFormat
+	tokenFormats          map[string]TokenFormat
+	tokenCreateRetries    int
+	janitor               JanitorOptions
+	janitorState          *janitorState
+	db                    *sql.DB
+	dbDriverName          string
+	automigrateEnabled    bool
+	debugEnabled          bool
+	logger                *slog.Logger
+	kdf                   KdfOptions
+	keyProvider           KeyProvider
+	policyEvaluator       PolicyEvaluator
+	namespace             string
+	namespaceScoped       bool
+	tx                    *sql.Tx
+	txDepth               int
+	txAuditKept           *[]AuditEntryInterface
 }
 
 var _ StoreInterface = (*Store)(nil) // verify it extends the interface
 
 // AutoMigrate auto migrate
+//
+// Creates the tables and their indexes, and adds the columns missing from
+// the tables created by an earlier release, so it is safe to run on every start.
 func (st *Store) AutoMigrate() error {
-	sql := st.SqlCreateTable()
+	tableNames := []string{st.vaultTableName, st.vaultVersionTableName}
+	tableColumns := map[string][]sb.Column{
+		st.vaultTableName:        vaultTableColumns(),
+		st.vaultVersionTableName: versionTableColumns(),
+	}
+	tableIndexes := map[string][]tableIndex{
+		st.vaultTableName:        vaultTableIndexes(),
+		st.vaultVersionTableName: versionTableIndexes(),
+	}
 
-	if st.debugEnabled {
-		log.Println(sql)
+	if st.auditEnabled {
+		tableNames = append(tableNames, st.auditTableName)
+		tableColumns[st.auditTableName] = auditTableColumns()
 	}
 
-	_, err := st.db.Exec(sql)
+	for _, tableName := range tableNames {
+		// the columns before the migration, none if the table does not exist yet
+		existing, err := st.tableColumnNames(tableName)
 
-	if err != nil {
-		log.Println(err)
-		return err
+		if err != nil {
+			existing = map[string]bool{}
+		}
+
+		if err := st.migrateExec([]string{st.sqlCreateTable(tableName, tableColumns[tableName])}); err != nil {
+			return err
+		}
+
+		sqls, err := st.sqlAddMissingColumns(tableName, tableColumns[tableName])
+
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+
+		sqls = append(sqls, st.sqlCreateMissingIndexes(tableName, tableIndexes[tableName], existing)...)
+
+		if err := st.migrateExec(sqls); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateExec executes the migration statements
+func (st *Store) migrateExec(sqls []string) error {
+	for _, sql := range sqls {
+		if st.debugEnabled {
+			log.Println(sql)
+		}
+
+		_, err := st.db.Exec(sql)
+
+		if err != nil {
+			log.Println(err)
+			return err
+		}
 	}
 
 	return nil
@@ -49,6 +121,10 @@ func (st *Store) EnableDebug(debug bool) {
 	st.debugEnabled = debug
 }
 
+func (st *Store) GetAuditTableName() string {
+	return st.auditTableName
+}
+
 func (st *Store) GetDbDriverName() string {
 	return st.dbDriverName
 }
@@ -57,10 +133,53 @@ func (st *Store) GetVaultTableName() string {
 	return st.vaultTableName
 }
 
+func (st *Store) GetVaultVersionTableName() string {
+	return st.vaultVersionTableName
+}
+
 func (store *Store) toQuerableContext(context context.Context) database.QueryableContext {
+	// a store bound by WithTx always runs in its transaction
+	if store.tx != nil {
+		return database.Context(context, store.tx)
+	}
+
 	if database.IsQueryableContext(context) {
 		return context.(database.QueryableContext)
 	}
 
 	return database.Context(context, store.db)
 }
+
+// runInTransaction runs fn in a transaction, which is committed if fn
+// returns no error and rolled back otherwise
+//
+// If the context already carries a transaction, fn joins it,
+// and the caller remains responsible for committing it
+func (store *Store) runInTransaction(ctx context.Context, fn func(txCtx context.Context) error) error {
+	queryable := store.toQuerableContext(ctx)
+
+	if queryable.IsTx() {
+		return fn(queryable)
+	}
+
+	beginner, ok := queryable.Queryable().(interface {
+		BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	})
+
+	if !ok {
+		return errors.New("vault store: transactions not supported by the queryable")
+	}
+
+	tx, err := beginner.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if err := fn(database.Context(ctx, tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
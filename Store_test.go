@@ -9,6 +9,7 @@ import (
 
 	"database/sql"
 
+	"github.com/gouniverse/sb"
 	_ "modernc.org/sqlite"
 )
 
@@ -30,17 +31,25 @@ func initDB(filepath string) (*sql.DB, error) {
 	return db, nil
 }
 
-func initStore(filepath string) (StoreInterface, error) {
+// initStore creates a store on a new database, the overrides change
+// the options, i.e. to enable the audit log
+func initStore(filepath string, overrides ...func(options *NewStoreOptions)) (StoreInterface, error) {
 	db, err := initDB(filepath)
 	if err != nil {
 		return nil, err
 	}
 
-	store, err := NewStore(NewStoreOptions{
+	options := NewStoreOptions{
 		VaultTableName:     "vault_token",
 		DB:                 db,
 		AutomigrateEnabled: true,
-	})
+	}
+
+	for _, override := range overrides {
+		override(&options)
+	}
+
+	store, err := NewStore(options)
 
 	if err != nil {
 		return nil, err
@@ -127,6 +136,92 @@ func Test_Store_AutoMigrate(t *testing.T) {
 	}
 }
 
+func Test_Store_AutoMigrate_LegacyTables(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatalf("initDB: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// the tables as created by an earlier release, with a legacy token
+	legacySqls := []string{
+		`CREATE TABLE vault_legacy (id TEXT PRIMARY KEY, vault_token TEXT UNIQUE NOT NULL, vault_value TEXT NOT NULL, created_at DATETIME NOT NULL, updated_at DATETIME NOT NULL, soft_deleted_at DATETIME NOT NULL)`,
+		`CREATE TABLE vault_legacy_version (id TEXT PRIMARY KEY, record_id TEXT NOT NULL, version INTEGER NOT NULL, vault_value TEXT NOT NULL, created_at DATETIME NOT NULL)`,
+		`INSERT INTO vault_legacy VALUES ('rec_legacy', 'tk_legacy', '` + encodeXor("legacy_secret", "test_pass") + `', '2020-01-01 00:00:00', '2020-01-01 00:00:00', '` + sb.MAX_DATETIME + `')`,
+	}
+
+	for _, sql := range legacySqls {
+		if _, err := db.Exec(sql); err != nil {
+			t.Fatalf("Exec: Expected [err] to be nil received [%v]", err.Error())
+		}
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		VaultTableName:        "vault_legacy",
+		VaultVersionTableName: "vault_legacy_version",
+		DB:                    db,
+		AutomigrateEnabled:    true,
+	})
+
+	if err != nil {
+		t.Fatalf("NewStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// the migration is idempotent
+	if err := store.AutoMigrate(); err != nil {
+		t.Fatalf("AutoMigrate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// the added columns are indexed
+	for _, index := range []string{
+		"vault_legacy_token_namespace_idx",
+		"vault_legacy_value_hmac_idx",
+		"vault_legacy_blind_index_idx",
+		"vault_legacy_blind_index_prefix_idx",
+		"vault_legacy_blind_index_suffix_idx",
+	} {
+		count := 0
+
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, index).Scan(&count); err != nil {
+			t.Fatalf("QueryRow: Expected [err] to be nil received [%v]", err.Error())
+		}
+
+		if count != 1 {
+			t.Fatalf("AutoMigrate: Expected index [%v] to be created", index)
+		}
+	}
+
+	ctx := context.Background()
+
+	value, err := store.TokenRead(ctx, "tk_legacy", "test_pass")
+
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if value != "legacy_secret" {
+		t.Fatalf("TokenRead: Expected [legacy_secret] received [%v]", value)
+	}
+
+	if err := store.TokenUpdate(ctx, "tk_legacy", "new_secret", "test_pass"); err != nil {
+		t.Fatalf("TokenUpdate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokenCreate(ctx, "secret", "test_pass", 20); err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	versions, err := store.TokenVersions(ctx, "tk_legacy")
+
+	if err != nil {
+		t.Fatalf("TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if len(versions) != 2 {
+		t.Fatalf("TokenVersions: Expected [2] versions received [%v]", len(versions))
+	}
+}
+
 func Test_createRandomBlock(t *testing.T) {
 	s := createRandomBlock(10)
 	if len(s) != 10 {
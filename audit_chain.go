@@ -0,0 +1,261 @@
+package vaultstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dromara/carbon/v2"
+	"github.com/gouniverse/base/database"
+	"github.com/samber/lo"
+)
+
+// auditAppendAttempts is the number of times entries are linked to the end
+// of the audit chain, when a concurrent writer appended entries first
+const auditAppendAttempts = 3
+
+// auditVerifyBatchSize is the number of entries read at once by VerifyAuditChain
+const auditVerifyBatchSize = 1000
+
+// AuditChainError reports the first broken link of the audit chain,
+// it matches ErrAuditChainBroken with errors.Is
+type AuditChainError struct {
+	// Sequence is the sequence of the first entry failing verification
+	Sequence int64
+	// EntryID is the ID of the entry, empty if the entry is missing
+	EntryID string
+	// Reason describes why the link is broken
+	Reason string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at sequence %d (entry %s): %s", e.Sequence, e.EntryID, e.Reason)
+}
+
+func (e *AuditChainError) Is(target error) bool {
+	return target == ErrAuditChainBroken
+}
+
+// VerifyAuditChain walks the audit chain from the first entry,
+// and reports the first broken link
+//
+// Business logic:
+//  1. The sequences must be contiguous from 1, a gap is a deleted entry
+//  2. Each entry must hold the hash of the previous entry
+//  3. The hash of each entry must match its content
+//  4. The HMAC of each entry must match, keyed with the AuditHmacKey,
+//     which detects entries edited and re-hashed
+//
+// Entries deleted from the end of the chain cannot be detected,
+// compare the verified count with a count kept outside of the database.
+//
+// # If a link is broken, an *AuditChainError is returned
+//
+// Parameters:
+// - ctx: The context
+//
+// Returns:
+// - verified: The number of entries verified before the first broken link
+// - err: An error if something went wrong
+func (st *Store) VerifyAuditChain(ctx context.Context) (verified int64, err error) {
+	if len(st.auditHmacKey) == 0 {
+		return 0, errors.New("vault store: AuditHmacKey is required to verify the audit chain")
+	}
+
+	prevHash := ""
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return verified, err
+		}
+
+		sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+			From(st.auditTableName).
+			Prepared(true).
+			Where(goqu.C(COLUMN_SEQUENCE).Gt(verified)).
+			Order(goqu.C(COLUMN_SEQUENCE).Asc()).
+			Limit(auditVerifyBatchSize).
+			ToSQL()
+
+		if err != nil {
+			return verified, err
+		}
+
+		if st.debugEnabled {
+			log.Println(sqlStr)
+		}
+
+		rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+		if err != nil {
+			return verified, err
+		}
+
+		for _, row := range rows {
+			entry := NewAuditEntryFromExistingData(row)
+
+			if reason := st.auditEntryVerify(entry, verified+1, prevHash); reason != "" {
+				entryID := entry.GetID()
+
+				if entry.GetSequence() != verified+1 {
+					entryID = ""
+				}
+
+				return verified, &AuditChainError{Sequence: verified + 1, EntryID: entryID, Reason: reason}
+			}
+
+			prevHash = entry.GetHash()
+			verified++
+		}
+
+		if len(rows) < auditVerifyBatchSize {
+			return verified, nil
+		}
+	}
+}
+
+// auditEntryVerify checks an entry against its expected position in the chain,
+// returns the reason the link is broken, or an empty string
+func (st *Store) auditEntryVerify(entry AuditEntryInterface, sequence int64, prevHash string) string {
+	if entry.GetSequence() != sequence {
+		return "entry missing, next sequence is " + strconv.FormatInt(entry.GetSequence(), 10)
+	}
+
+	if entry.GetPrevHash() != prevHash {
+		return "previous hash mismatch"
+	}
+
+	if !hmac.Equal([]byte(entry.GetHash()), []byte(auditEntryHash(entry))) {
+		return "hash mismatch"
+	}
+
+	if entry.GetHmac() == "" {
+		return "hmac missing"
+	}
+
+	if !hmac.Equal([]byte(entry.GetHmac()), []byte(auditEntryHmac(st.auditHmacKey, entry.GetHash()))) {
+		return "hmac mismatch"
+	}
+
+	return ""
+}
+
+// auditAppend links the entries to the end of the audit chain and saves them
+//
+// Each sequence is unique, so a concurrent writer taking the same
+// sequence fails, the entries are then linked to the new end of the chain
+func (st *Store) auditAppend(ctx context.Context, entries []AuditEntryInterface) (err error) {
+	attempts := auditAppendAttempts
+
+	// a failed statement may abort the transaction of the caller
+	if st.toQuerableContext(ctx).IsTx() {
+		attempts = 1
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		err = st.runInTransaction(ctx, func(txCtx context.Context) error {
+			return st.auditAppendLinked(txCtx, entries)
+		})
+
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// auditAppendLinked links the entries to the last entry of the chain, and inserts them,
+// chunked to the parameter limit of the database
+func (st *Store) auditAppendLinked(ctx context.Context, entries []AuditEntryInterface) error {
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		From(st.auditTableName).
+		Prepared(true).
+		Select(COLUMN_SEQUENCE, COLUMN_HASH).
+		Order(goqu.C(COLUMN_SEQUENCE).Desc()).
+		Limit(1).
+		ToSQL()
+
+	if err != nil {
+		return err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	last, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return err
+	}
+
+	sequence, prevHash := int64(0), ""
+
+	if len(last) > 0 {
+		lastEntry := NewAuditEntryFromExistingData(last[0])
+		sequence, prevHash = lastEntry.GetSequence(), lastEntry.GetHash()
+	}
+
+	rows := lo.Map(entries, func(entry AuditEntryInterface, _ int) goqu.Record {
+		sequence++
+
+		entry.SetSequence(sequence).SetPrevHash(prevHash)
+		entry.SetHash(auditEntryHash(entry))
+		entry.SetHmac(auditEntryHmac(st.auditHmacKey, entry.GetHash()))
+
+		prevHash = entry.GetHash()
+
+		row := goqu.Record{}
+
+		for column, value := range entry.Data() {
+			row[column] = value
+		}
+
+		return row
+	})
+
+	return st.batchInsert(ctx, st.auditTableName, rows)
+}
+
+// auditEntryHash returns the hex SHA-256 of the content of the entry,
+// including the hash of the previous entry
+//
+// Each field is prefixed with its length, so the fields cannot be
+// shifted into each other. The timestamp is normalized, as databases
+// return datetimes in different formats.
+func auditEntryHash(entry AuditEntryInterface) string {
+	fields := []string{
+		strconv.FormatInt(entry.GetSequence(), 10),
+		entry.GetID(),
+		entry.GetAction(),
+		entry.GetToken(),
+		entry.GetNamespace(),
+		entry.GetActor(),
+		entry.GetPurpose(),
+		entry.GetOutcome(),
+		carbon.Parse(entry.GetCreatedAt(), carbon.UTC).ToDateTimeString(carbon.UTC),
+		entry.GetPrevHash(),
+	}
+
+	h := sha256.New()
+
+	for _, field := range fields {
+		h.Write([]byte(strconv.Itoa(len(field)) + ":" + field))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditEntryHmac returns the hex HMAC-SHA256 of the entry hash
+func auditEntryHmac(key []byte, hash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,153 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// auditChainSeed records 6 audit entries, including a missing token
+func auditChainSeed(t *testing.T, store StoreInterface) {
+	ctx := WithAuditActor(context.Background(), "alice")
+
+	token, err := store.TokenCreate(ctx, "value", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokensRead(ctx, []string{token, "tk_missing"}, "test_pass"); err == nil {
+		t.Fatal("TokensRead: Expected error for missing token")
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.TokenRead(ctx, token, "test_pass"); err != nil {
+			t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+		}
+	}
+}
+
+func Test_Store_VerifyAuditChain(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.VaultTableName = "vault_chained"
+		options.AuditEnabled = true
+		options.AuditHmacKey = testKey(7)
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	auditChainSeed(t, store)
+
+	ctx := context.Background()
+
+	verified, err := store.VerifyAuditChain(ctx)
+	if err != nil {
+		t.Fatalf("VerifyAuditChain: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if verified != 6 {
+		t.Fatalf("VerifyAuditChain: Expected [6] verified entries received [%v]", verified)
+	}
+
+	entries, err := store.AuditList(ctx, AuditQuery().SetOrderBy(COLUMN_SEQUENCE).SetSortOrder("asc"))
+	if err != nil {
+		t.Fatalf("AuditList: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if entries[0].GetPrevHash() != "" || entries[1].GetPrevHash() != entries[0].GetHash() || entries[1].GetHmac() == "" {
+		t.Fatal("AuditList: Expected the entries to be chained")
+	}
+}
+
+func Test_Store_VerifyAuditChain_Tampered(t *testing.T) {
+	cases := []struct {
+		name     string
+		sql      string
+		sequence int64
+	}{
+		{"edited", `UPDATE vault_chained_audit SET actor = 'mallory' WHERE sequence = 3`, 3},
+		{"deleted", `DELETE FROM vault_chained_audit WHERE sequence = 2`, 2},
+		{"rehashed", `UPDATE vault_chained_audit SET hash = 'x', prev_hash = 'x' WHERE sequence >= 4`, 4},
+	}
+
+	for _, c := range cases {
+		store, err := initStore(":memory:", func(options *NewStoreOptions) {
+			options.VaultTableName = "vault_chained"
+			options.AuditEnabled = true
+			options.AuditHmacKey = testKey(7)
+		})
+		if err != nil {
+			t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+		}
+
+		auditChainSeed(t, store)
+
+		ctx := context.Background()
+
+		if _, err := store.(*Store).db.Exec(c.sql); err != nil {
+			t.Fatalf("%s: Expected [err] to be nil received [%v]", c.name, err.Error())
+		}
+
+		verified, err := store.VerifyAuditChain(ctx)
+
+		var chainErr *AuditChainError
+		if !errors.As(err, &chainErr) || !errors.Is(err, ErrAuditChainBroken) {
+			t.Fatalf("%s: Expected [%v] received [%v]", c.name, ErrAuditChainBroken, err)
+		}
+		if chainErr.Sequence != c.sequence || verified != c.sequence-1 {
+			t.Fatalf("%s: Expected broken link at [%v] received [%v] after [%v] verified", c.name, c.sequence, chainErr.Sequence, verified)
+		}
+	}
+}
+
+func Test_Store_VerifyAuditChain_HmacKey(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.VaultTableName = "vault_chained"
+		options.AuditEnabled = true
+		options.AuditHmacKey = testKey(7)
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	auditChainSeed(t, store)
+
+	ctx := context.Background()
+
+	// an attacker with write access to the database recomputes every hash
+	entries, err := store.AuditList(ctx, AuditQuery().SetOrderBy(COLUMN_SEQUENCE).SetSortOrder("asc"))
+	if err != nil {
+		t.Fatalf("AuditList: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	prevHash := ""
+	for _, entry := range entries {
+		entry.SetActor("mallory").SetPrevHash(prevHash)
+		entry.SetHash(auditEntryHash(entry))
+		prevHash = entry.GetHash()
+
+		if _, err := store.(*Store).db.Exec(`UPDATE vault_chained_audit SET actor = ?, prev_hash = ?, hash = ? WHERE id = ?`,
+			entry.GetActor(), entry.GetPrevHash(), entry.GetHash(), entry.GetID()); err != nil {
+			t.Fatalf("Exec: Expected [err] to be nil received [%v]", err.Error())
+		}
+	}
+
+	// the HMAC of the re-hashed entries does not match
+	verified, err := store.VerifyAuditChain(ctx)
+
+	var chainErr *AuditChainError
+	if !errors.As(err, &chainErr) {
+		t.Fatalf("VerifyAuditChain: Expected [%v] received [%v]", ErrAuditChainBroken, err)
+	}
+	if verified != 0 || chainErr.Sequence != 1 || chainErr.Reason != "hmac mismatch" {
+		t.Fatalf("VerifyAuditChain: Expected hmac mismatch at [1] received [%v] at [%v]", chainErr.Reason, chainErr.Sequence)
+	}
+
+	db := store.(*Store).db
+
+	if _, err := NewStore(NewStoreOptions{VaultTableName: "vault_no_key", DB: db, AuditEnabled: true}); err == nil {
+		t.Fatal("NewStore: Expected error for AuditEnabled without AuditHmacKey")
+	}
+
+	if _, err := NewStore(NewStoreOptions{VaultTableName: "vault_short_key", DB: db, AuditEnabled: true, AuditHmacKey: []byte("short")}); err == nil {
+		t.Fatal("NewStore: Expected error for short AuditHmacKey")
+	}
+}
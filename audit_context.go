@@ -0,0 +1,34 @@
+package vaultstore
+
+import "context"
+
+type auditContextKey string
+
+const auditActorContextKey auditContextKey = "vaultstore_audit_actor"
+const auditPurposeContextKey auditContextKey = "vaultstore_audit_purpose"
+
+// WithAuditActor returns a copy of the context carrying the actor,
+// i.e. the user or service, recorded in the audit log
+func WithAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorContextKey, actor)
+}
+
+// WithAuditPurpose returns a copy of the context carrying the purpose
+// of the access, i.e. a ticket number, recorded in the audit log
+func WithAuditPurpose(ctx context.Context, purpose string) context.Context {
+	return context.WithValue(ctx, auditPurposeContextKey, purpose)
+}
+
+// AuditActorFromContext returns the audit actor carried by the context,
+// or an empty string if none
+func AuditActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(auditActorContextKey).(string)
+	return actor
+}
+
+// AuditPurposeFromContext returns the audit purpose carried by the context,
+// or an empty string if none
+func AuditPurposeFromContext(ctx context.Context) string {
+	purpose, _ := ctx.Value(auditPurposeContextKey).(string)
+	return purpose
+}
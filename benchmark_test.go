@@ -10,6 +10,6 @@ var test_val = createRandomBlock(1000000)
 
 func BenchmarkEnc(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		encode(test_val, "test_password")
+		encode(test_val, "test_password", KdfOptions{}, nil)
 	}
 }
@@ -0,0 +1,199 @@
+package vaultstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Blind index kinds, mixed into the HMAC so the indexes of
+// the value, its prefix and its suffix never match each other
+const BLIND_INDEX_KIND_VALUE = "value"
+const BLIND_INDEX_KIND_PREFIX = "prefix"
+const BLIND_INDEX_KIND_SUFFIX = "suffix"
+
+// BlindIndexOptions define the blind indexes kept for each value,
+// keyed HMACs of the normalized value, searchable without decryption
+type BlindIndexOptions struct {
+	// Key keys the HMAC of the indexes, it must be at least 32 bytes,
+	// and kept apart from the vault passwords. Blind indexes are
+	// disabled without a key.
+	Key []byte
+
+	// Normalize normalizes the values before indexing and searching,
+	// defaults to NormalizeBlindIndexValue
+	Normalize func(value string) string
+
+	// PrefixLength indexes the first characters of the normalized
+	// value, i.e. 6 for the BIN of a card number (default: 0, disabled)
+	PrefixLength int
+
+	// SuffixLength indexes the last characters of the normalized
+	// value, i.e. 4 for the last-4 digits (default: 0, disabled)
+	SuffixLength int
+}
+
+// NormalizeBlindIndexValue is the default blind index normalization,
+// lower cases the value, and removes the white space and dashes, so
+// "123-45-6789" and "123 45 6789" have the same blind index
+func NormalizeBlindIndexValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, value)
+}
+
+// validate checks the blind index options
+func (o BlindIndexOptions) validate() error {
+	if len(o.Key) > 0 && len(o.Key) < 32 {
+		return errors.New("blind index key must be at least 32 bytes")
+	}
+
+	if o.PrefixLength < 0 || o.SuffixLength < 0 {
+		return errors.New("blind index prefix and suffix length cannot be negative")
+	}
+
+	return nil
+}
+
+// withDefaults returns the options with the default normalization set
+func (o BlindIndexOptions) withDefaults() BlindIndexOptions {
+	if o.Normalize == nil {
+		o.Normalize = NormalizeBlindIndexValue
+	}
+
+	return o
+}
+
+// BlindIndex returns the blind index of a value, to search
+// the records holding it with RecordQuery().SetBlindIndex
+//
+// # If blind indexes are disabled, ErrBlindIndexKeyRequired is returned
+//
+// Parameters:
+// - ctx: The context, the blind indexes are scoped to its namespace
+// - value: The value to search for
+//
+// Returns:
+// - blindIndex: The blind index of the value
+// - err: An error if something went wrong
+func (st *Store) BlindIndex(ctx context.Context, value string) (string, error) {
+	if len(st.blindIndex.Key) == 0 {
+		return "", ErrBlindIndexKeyRequired
+	}
+
+	return st.blindIndexHmac(ctx, BLIND_INDEX_KIND_VALUE, st.blindIndex.Normalize(value)), nil
+}
+
+// BlindIndexPrefix returns the blind index of the prefix of a value, to
+// search the records with RecordQuery().SetBlindIndexPrefix. The value
+// is either the full value or its prefix, i.e. the first 6 digits.
+//
+// # If blind indexes are disabled, ErrBlindIndexKeyRequired is returned
+func (st *Store) BlindIndexPrefix(ctx context.Context, value string) (string, error) {
+	return st.blindIndexPart(ctx, BLIND_INDEX_KIND_PREFIX, value)
+}
+
+// BlindIndexSuffix returns the blind index of the suffix of a value, to
+// search the records with RecordQuery().SetBlindIndexSuffix. The value
+// is either the full value or its suffix, i.e. the last 4 digits.
+//
+// # If blind indexes are disabled, ErrBlindIndexKeyRequired is returned
+func (st *Store) BlindIndexSuffix(ctx context.Context, value string) (string, error) {
+	return st.blindIndexPart(ctx, BLIND_INDEX_KIND_SUFFIX, value)
+}
+
+// blindIndexPart returns the blind index of the prefix or suffix of the value
+func (st *Store) blindIndexPart(ctx context.Context, kind string, value string) (string, error) {
+	if len(st.blindIndex.Key) == 0 {
+		return "", ErrBlindIndexKeyRequired
+	}
+
+	length := st.blindIndex.PrefixLength
+
+	if kind == BLIND_INDEX_KIND_SUFFIX {
+		length = st.blindIndex.SuffixLength
+	}
+
+	if length == 0 {
+		return "", errors.New("blind index " + kind + " is disabled")
+	}
+
+	part, ok := blindIndexCut(kind, st.blindIndex.Normalize(value), length)
+
+	if !ok {
+		return "", errors.New("blind index " + kind + ": value is too short")
+	}
+
+	return st.blindIndexHmac(ctx, kind, part), nil
+}
+
+// blindIndexSet sets the blind indexes of the value on the record,
+// nothing is set if blind indexes are disabled
+//
+// Business logic:
+//  1. The value is normalized
+//  2. The value index is always set
+//  3. The prefix and suffix indexes are set when enabled, and left
+//     empty if the value is shorter than their length
+func (st *Store) blindIndexSet(ctx context.Context, record RecordInterface, value string) {
+	if len(st.blindIndex.Key) == 0 {
+		return
+	}
+
+	normalized := st.blindIndex.Normalize(value)
+
+	record.SetBlindIndex(st.blindIndexHmac(ctx, BLIND_INDEX_KIND_VALUE, normalized))
+	record.SetBlindIndexPrefix("")
+	record.SetBlindIndexSuffix("")
+
+	if prefix, ok := blindIndexCut(BLIND_INDEX_KIND_PREFIX, normalized, st.blindIndex.PrefixLength); ok {
+		record.SetBlindIndexPrefix(st.blindIndexHmac(ctx, BLIND_INDEX_KIND_PREFIX, prefix))
+	}
+
+	if suffix, ok := blindIndexCut(BLIND_INDEX_KIND_SUFFIX, normalized, st.blindIndex.SuffixLength); ok {
+		record.SetBlindIndexSuffix(st.blindIndexHmac(ctx, BLIND_INDEX_KIND_SUFFIX, suffix))
+	}
+}
+
+// blindIndexCut returns the prefix or suffix of the normalized value,
+// false if disabled (length 0) or the value is too short
+func blindIndexCut(kind string, normalized string, length int) (string, bool) {
+	runes := []rune(normalized)
+
+	if length < 1 || len(runes) < length {
+		return "", false
+	}
+
+	if kind == BLIND_INDEX_KIND_SUFFIX {
+		return string(runes[len(runes)-length:]), true
+	}
+
+	return string(runes[:length]), true
+}
+
+// blindIndexHmac returns the hex HMAC-SHA256 of the kind, namespace and
+// normalized value, length prefixed so the fields cannot run into each other
+func (st *Store) blindIndexHmac(ctx context.Context, kind string, normalized string) string {
+	namespace, _ := st.namespaceFromContext(ctx)
+
+	mac := hmac.New(sha256.New, st.blindIndex.Key)
+
+	for _, field := range []string{kind, namespace} {
+		length := make([]byte, 8)
+		binary.BigEndian.PutUint64(length, uint64(len(field)))
+		mac.Write(length)
+		mac.Write([]byte(field))
+	}
+
+	mac.Write([]byte(normalized))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
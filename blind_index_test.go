@@ -0,0 +1,152 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func Test_Store_BlindIndex(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.BlindIndex = BlindIndexOptions{
+			Key:          []byte("0123456789abcdef0123456789abcdef"),
+			PrefixLength: 3,
+			SuffixLength: 4,
+		}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	tokens := []string{}
+
+	for _, ssn := range []string{"123-45-6789", "987-65-6789", "123-45-0000"} {
+		token, err := store.TokenCreate(ctx, ssn, "test_pass", 20)
+		if err != nil {
+			t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+		}
+		tokens = append(tokens, token)
+	}
+
+	// the normalization ignores the dashes and white space
+	blindIndex, err := store.BlindIndex(ctx, "123 45 6789")
+	if err != nil {
+		t.Fatalf("BlindIndex: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	records, err := store.RecordList(ctx, RecordQuery().SetBlindIndex(blindIndex))
+	if err != nil {
+		t.Fatalf("RecordList: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(records) != 1 || records[0].GetToken() != tokens[0] {
+		t.Fatalf("RecordList: Expected [%v] received [%v] records", tokens[0], len(records))
+	}
+
+	suffix, err := store.BlindIndexSuffix(ctx, "6789")
+	if err != nil {
+		t.Fatalf("BlindIndexSuffix: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	count, err := store.RecordCount(ctx, RecordQuery().SetBlindIndexSuffix(suffix))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 2 {
+		t.Fatalf("RecordCount: Expected [2] received [%v]", count)
+	}
+
+	prefix, err := store.BlindIndexPrefix(ctx, "123-45-0000")
+	if err != nil {
+		t.Fatalf("BlindIndexPrefix: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	count, err = store.RecordCount(ctx, RecordQuery().SetBlindIndexPrefix(prefix).SetBlindIndexSuffix(suffix))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 1 {
+		t.Fatalf("RecordCount: Expected [1] received [%v]", count)
+	}
+
+	if _, err := store.BlindIndexSuffix(ctx, "89"); err == nil {
+		t.Fatalf("BlindIndexSuffix: Expected [err] for a short value received [nil]")
+	}
+}
+
+func Test_Store_BlindIndex_UpdateAndRollback(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.BlindIndex = BlindIndexOptions{
+			Key:          []byte("0123456789abcdef0123456789abcdef"),
+			PrefixLength: 3,
+			SuffixLength: 4,
+		}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "123-45-6789", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenUpdate(ctx, token, "555-55-5555", "test_pass"); err != nil {
+		t.Fatalf("TokenUpdate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	oldIndex, _ := store.BlindIndex(ctx, "123-45-6789")
+	newIndex, _ := store.BlindIndex(ctx, "555-55-5555")
+
+	count, err := store.RecordCount(ctx, RecordQuery().SetBlindIndex(oldIndex))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 0 {
+		t.Fatalf("RecordCount: Expected [0] after update received [%v]", count)
+	}
+
+	count, err = store.RecordCount(ctx, RecordQuery().SetBlindIndex(newIndex))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 1 {
+		t.Fatalf("RecordCount: Expected [1] after update received [%v]", count)
+	}
+
+	if err := store.TokenRollback(ctx, token, 1); err != nil {
+		t.Fatalf("TokenRollback: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	count, err = store.RecordCount(ctx, RecordQuery().SetBlindIndex(oldIndex))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 1 {
+		t.Fatalf("RecordCount: Expected [1] after rollback received [%v]", count)
+	}
+}
+
+func Test_Store_BlindIndex_Disabled(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.BlindIndex(context.Background(), "123-45-6789"); !errors.Is(err, ErrBlindIndexKeyRequired) {
+		t.Fatalf("BlindIndex: Expected [%v] received [%v]", ErrBlindIndexKeyRequired, err)
+	}
+}
+
+func Test_NormalizeBlindIndexValue(t *testing.T) {
+	if got := NormalizeBlindIndexValue(" 123-45 6789 "); got != "123456789" {
+		t.Fatalf("NormalizeBlindIndexValue: Expected [123456789] received [%v]", got)
+	}
+
+	if got := NormalizeBlindIndexValue("Jane@Example.COM"); got != "jane@example.com" {
+		t.Fatalf("NormalizeBlindIndexValue: Expected [jane@example.com] received [%v]", got)
+	}
+}
@@ -1,10 +1,54 @@
 package vaultstore
 
+const COLUMN_ACL = "acl"
+const COLUMN_ACTION = "action"
+const COLUMN_ACTOR = "actor"
+const COLUMN_BLIND_INDEX = "blind_index"
+const COLUMN_BLIND_INDEX_PREFIX = "blind_index_prefix"
+const COLUMN_BLIND_INDEX_SUFFIX = "blind_index_suffix"
 const COLUMN_CREATED_AT = "created_at"
+const COLUMN_EXPIRES_AT = "expires_at"
+const COLUMN_HASH = "hash"
+const COLUMN_HMAC = "hmac"
 const COLUMN_SOFT_DELETED_AT = "soft_deleted_at"
 const COLUMN_ID = "id"
+const COLUMN_METADATA = "metadata"
+const COLUMN_NAMESPACE = "namespace"
+const COLUMN_OUTCOME = "outcome"
+const COLUMN_OWNER = "owner"
+const COLUMN_PREV_HASH = "prev_hash"
+const COLUMN_PURPOSE = "purpose"
+const COLUMN_READS_REMAINING = "reads_remaining"
+const COLUMN_RECORD_ID = "record_id"
+const COLUMN_REVISION = "revision"
+const COLUMN_SEQUENCE = "sequence"
 const COLUMN_UPDATED_AT = "updated_at"
 const COLUMN_VAULT_TOKEN = "vault_token"
+const COLUMN_VALUE_HMAC = "value_hmac"
 const COLUMN_VAULT_VALUE = "vault_value"
+const COLUMN_VERSION = "version"
 
 const TOKEN_PREFIX = "tk_"
+
+// READS_UNLIMITED is the reads remaining of a token without a read limit
+const READS_UNLIMITED = -1
+
+// Audit actions, recorded for each audited token method
+const AUDIT_ACTION_TOKEN_CREATE = "token_create"
+const AUDIT_ACTION_TOKEN_DELETE = "token_delete"
+const AUDIT_ACTION_TOKEN_FIND_BY_VALUE = "token_find_by_value"
+const AUDIT_ACTION_TOKEN_READ = "token_read"
+const AUDIT_ACTION_TOKEN_READ_VERSION = "token_read_version"
+const AUDIT_ACTION_TOKEN_RESTORE = "token_restore"
+const AUDIT_ACTION_TOKEN_ROLLBACK = "token_rollback"
+const AUDIT_ACTION_TOKEN_SOFT_DELETE = "token_soft_delete"
+const AUDIT_ACTION_TOKEN_UPDATE = "token_update"
+const AUDIT_ACTION_TOKEN_UPDATE_EXPIRATION = "token_update_expiration"
+
+// Audit outcomes, the result of an audited call
+const AUDIT_OUTCOME_ERROR = "error"
+const AUDIT_OUTCOME_INTEGRITY_FAILURE = "integrity_failure"
+const AUDIT_OUTCOME_INVALID_PASSWORD = "invalid_password"
+const AUDIT_OUTCOME_NOT_FOUND = "not_found"
+const AUDIT_OUTCOME_PERMISSION_DENIED = "permission_denied"
+const AUDIT_OUTCOME_SUCCESS = "success"
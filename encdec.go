@@ -1,13 +1,257 @@
 package vaultstore
 
 import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"errors"
-	"math/rand/v2"
+	mathrand "math/rand/v2"
 	"strconv"
 	"strings"
 )
 
-func decode(value string, password string) (string, error) {
+// envelopeCipher is an authenticated cipher that can be referenced
+// by its ID from the envelope of an encrypted value
+type envelopeCipher interface {
+	NonceSize() int
+	Seal(key, nonce, plaintext, additionalData []byte) ([]byte, error)
+	Open(key, nonce, ciphertext, additionalData []byte) ([]byte, error)
+}
+
+// envelopeCiphers lists the supported ciphers by envelope cipher ID.
+// New ciphers are added here, existing values keep their cipher ID.
+var envelopeCiphers = map[string]envelopeCipher{
+	CIPHER_AES_256_GCM: aesGcmCipher{},
+}
+
+// decode decrypts a value previously encrypted with encode
+//
+// Business logic:
+//  1. Parse the envelope to find the cipher and key derivation
+//  2. Legacy values without an envelope are decrypted with the XOR scheme
+//  3. Derive the key with the KDF and parameters saved in the envelope
+//  4. Decrypt with the cipher saved in the envelope, authenticating
+//     the associated data
+func decode(value string, password string, associatedData []byte) (string, error) {
+	e, err := parseEnvelope(value)
+
+	if err != nil {
+		return "", err
+	}
+
+	if e.Cipher == CIPHER_XOR {
+		return decodeXor(value, password)
+	}
+
+	key, err := deriveEnvelopeKey(e, password)
+
+	if err != nil {
+		return "", err
+	}
+
+	return openEnvelope(e, key, associatedData)
+}
+
+// encode encrypts a value with AES-256-GCM using a fresh random nonce
+// and a key derived from the password and a fresh random salt
+//
+// The cipher, the KDF and its cost parameters are saved in the envelope,
+// so that decode does not depend on the current store options.
+// The associated data is authenticated, but not saved in the envelope.
+func encode(value string, password string, kdf KdfOptions, associatedData []byte) (string, error) {
+	kdf = kdf.withDefaults()
+
+	if err := kdf.validate(); err != nil {
+		return "", err
+	}
+
+	e := envelope{
+		Version:   ENVELOPE_VERSION,
+		Cipher:    CIPHER_AES_256_GCM,
+		Kdf:       kdf.Algorithm,
+		KdfParams: kdf.paramsString(),
+		Salt:      make([]byte, kdfSaltLength),
+	}
+
+	if _, err := rand.Read(e.Salt); err != nil {
+		return "", err
+	}
+
+	key, err := kdf.deriveKey(password, e.Salt)
+
+	if err != nil {
+		return "", err
+	}
+
+	return sealEnvelope(e, key, value, associatedData)
+}
+
+// sealEnvelope encrypts the value with the key and the envelope cipher,
+// using a fresh random nonce, and returns the serialized envelope
+func sealEnvelope(e envelope, key []byte, value string, associatedData []byte) (string, error) {
+	c, ok := envelopeCiphers[e.Cipher]
+
+	if !ok {
+		return "", errors.New("envelope cipher not supported: " + e.Cipher)
+	}
+
+	e.Nonce = make([]byte, c.NonceSize())
+
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext, err := c.Seal(key, e.Nonce, []byte(value), associatedData)
+
+	if err != nil {
+		return "", err
+	}
+
+	e.KeyCheck = keyCheck(key)
+	e.Ciphertext = ciphertext
+
+	return e.String(), nil
+}
+
+// openEnvelope decrypts the envelope ciphertext with the key
+//
+// The key check is verified first, so that a failure to open
+// is reported as an integrity error, not as a wrong password
+func openEnvelope(e envelope, key []byte, associatedData []byte) (string, error) {
+	c, ok := envelopeCiphers[e.Cipher]
+
+	if !ok {
+		return "", errors.New("envelope cipher not supported: " + e.Cipher)
+	}
+
+	if !hmac.Equal(e.KeyCheck, keyCheck(key)) {
+		return "", ErrInvalidPassword
+	}
+
+	plaintext, err := c.Open(key, e.Nonce, e.Ciphertext, associatedData)
+
+	if err != nil {
+		return "", ErrValueIntegrity
+	}
+
+	return string(plaintext), nil
+}
+
+// keyCheck returns a short HMAC of a constant under the key, used
+// to verify the key before decrypting
+func keyCheck(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("vaultstore key check"))
+	return mac.Sum(nil)[:8]
+}
+
+// recordAssociatedData returns the associated data binding a value
+// to the ID and token of its record, so that a value copied to
+// another record fails to decrypt
+func recordAssociatedData(recordID string, token string) []byte {
+	return []byte(strconv.Itoa(len(recordID)) + ":" + recordID + token)
+}
+
+// encodeValue encrypts a value with the password, or with a data key
+// wrapped by the store key provider when the password is empty.
+// The value is bound to the ID and token of the record.
+func (st *Store) encodeValue(ctx context.Context, record RecordInterface, value string, password string) (string, error) {
+	associatedData := recordAssociatedData(record.GetID(), record.GetToken())
+
+	if password == "" {
+		if st.keyProvider == nil {
+			return "", ErrEmptyPassword
+		}
+
+		return encodeWithKeyProvider(ctx, value, st.keyProvider, associatedData)
+	}
+
+	return encode(value, password, st.kdf, associatedData)
+}
+
+// decodeValue decrypts the value of a record, values encrypted with a wrapped
+// data key are decrypted with the store key provider, and the password is ignored
+func (st *Store) decodeValue(ctx context.Context, record RecordInterface, password string) (string, error) {
+	value := record.GetValue()
+	associatedData := recordAssociatedData(record.GetID(), record.GetToken())
+
+	e, err := parseEnvelope(value)
+
+	if err == nil && e.Kdf == KDF_KEY_PROVIDER {
+		if st.keyProvider == nil {
+			return "", errors.New("key provider is required to decrypt value")
+		}
+
+		return decodeWithKeyProvider(ctx, e, st.keyProvider, associatedData)
+	}
+
+	return decode(value, password, associatedData)
+}
+
+// deriveEnvelopeKey derives the key with the KDF saved in the envelope
+func deriveEnvelopeKey(e envelope, password string) ([]byte, error) {
+	kdf, err := kdfOptionsFromHeader(e.Kdf, e.KdfParams)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return kdf.deriveKey(password, e.Salt)
+}
+
+// aesGcmCipher implements AES-256-GCM
+type aesGcmCipher struct{}
+
+func (aesGcmCipher) NonceSize() int {
+	return 12
+}
+
+func (c aesGcmCipher) Seal(key, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := c.aead(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+func (c aesGcmCipher) Open(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := c.aead(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("nonce size incorrect")
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
+
+	if err != nil {
+		// GCM does not distinguish a wrong key from a tampered value
+		return nil, ErrInvalidPassword
+	}
+
+	return plaintext, nil
+}
+
+func (aesGcmCipher) aead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// decodeXor decrypts a value encrypted with the legacy XOR scheme
+func decodeXor(value string, password string) (string, error) {
 	strongPassword := strongifyPassword(password)
 	first, err := xorDecrypt(value, strongPassword)
 
@@ -16,7 +260,7 @@ func decode(value string, password string) (string, error) {
 	}
 
 	if !isBase64(first) {
-		return "", errors.New("vault password incorrect")
+		return "", ErrInvalidPassword
 	}
 
 	v4, err := base64Decode(first)
@@ -28,7 +272,7 @@ func decode(value string, password string) (string, error) {
 	parts := strings.Split(string(v4), "_")
 
 	if len(parts) < 2 {
-		return "", errors.New("vault password incorrect")
+		return "", ErrInvalidPassword
 	}
 
 	upTo, err := strconv.Atoi(parts[0])
@@ -49,7 +293,11 @@ func decode(value string, password string) (string, error) {
 	return string(v2), nil
 }
 
-func encode(value string, password string) string {
+// encodeXor encrypts a value with the legacy XOR scheme
+//
+// Deprecated: kept only to verify that legacy values can still be
+// decoded. New values are always encrypted with encode.
+func encodeXor(value string, password string) string {
 	strongPassword := strongifyPassword(password)
 	v1 := base64Encode([]byte(value))
 	v2 := strconv.Itoa(len(v1)) + "_" + v1
@@ -80,7 +328,7 @@ func createRandomBlock(length int) string {
 	const characters = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	result := make([]byte, length)
 	for i := range result {
-		result[i] = characters[rand.IntN(len(characters))]
+		result[i] = characters[mathrand.IntN(len(characters))]
 	}
 	return string(result)
 }
@@ -1,6 +1,10 @@
 package vaultstore
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+)
 
 func Test_xorEncrypt(t *testing.T) {
 	str := xorEncrypt("input", "key")
@@ -43,9 +47,12 @@ func Test_xorEncryptDecryptLargeInput(t *testing.T) {
 func Test_decode(t *testing.T) {
 	test_val := "test_value"
 	test_pass := "test_password"
-	encoded_str := encode(test_val, test_pass)
+	encoded_str, err := encode(test_val, test_pass, KdfOptions{}, nil)
+	if err != nil {
+		t.Fatalf("encode Failure [%v]", err.Error())
+	}
 
-	str, err := decode(encoded_str, test_pass)
+	str, err := decode(encoded_str, test_pass, nil)
 	if err != nil {
 		t.Fatalf("decode Failure [%v]", err.Error())
 	}
@@ -57,9 +64,16 @@ func Test_decode(t *testing.T) {
 func Test_encode(t *testing.T) {
 	test_val := "test_value"
 	test_pass := "test_password"
-	encoded_str := encode(test_val, test_pass)
+	encoded_str, err := encode(test_val, test_pass, KdfOptions{}, nil)
+	if err != nil {
+		t.Fatalf("encode Failure [%v]", err.Error())
+	}
 
-	str, err := decode(encoded_str, test_pass)
+	if !strings.HasPrefix(encoded_str, ENVELOPE_MAGIC+"1$aes-256-gcm$argon2id$") {
+		t.Fatalf("encode Failure: Expected envelope header, received [%v]", encoded_str)
+	}
+
+	str, err := decode(encoded_str, test_pass, nil)
 	if err != nil {
 		t.Fatalf("encode Failure [%v]", err.Error())
 	}
@@ -67,3 +81,126 @@ func Test_encode(t *testing.T) {
 		t.Fatalf("encoded String Match Failure: Expected [%v], received [%v]", test_val, str)
 	}
 }
+
+func Test_encode_UniqueNonce(t *testing.T) {
+	first, err := encode("test_value", "test_password", KdfOptions{}, nil)
+	if err != nil {
+		t.Fatalf("encode Failure [%v]", err.Error())
+	}
+
+	second, err := encode("test_value", "test_password", KdfOptions{}, nil)
+	if err != nil {
+		t.Fatalf("encode Failure [%v]", err.Error())
+	}
+
+	if first == second {
+		t.Fatal("encode Failure: Expected different ciphertexts for the same value")
+	}
+}
+
+func Test_decode_WrongPassword(t *testing.T) {
+	encoded_str, err := encode("test_value", "test_password", KdfOptions{}, nil)
+	if err != nil {
+		t.Fatalf("encode Failure [%v]", err.Error())
+	}
+
+	_, err = decode(encoded_str, "wrong_password", nil)
+	if err == nil {
+		t.Fatal("decode Failure: Expected error for wrong password")
+	}
+	if errors.Is(err, ErrValueIntegrity) {
+		t.Fatal("decode Failure: Expected wrong password not to be reported as an integrity error")
+	}
+}
+
+func Test_decode_Tampered(t *testing.T) {
+	encoded_str, err := encode("test_value", "test_password", KdfOptions{}, nil)
+	if err != nil {
+		t.Fatalf("encode Failure [%v]", err.Error())
+	}
+
+	headerEnd := strings.LastIndex(encoded_str, "$") + 1
+	raw, err := base64Decode(encoded_str[headerEnd:])
+	if err != nil {
+		t.Fatalf("base64Decode Failure [%v]", err.Error())
+	}
+
+	raw[len(raw)-1] ^= 0x01
+	tampered := encoded_str[:headerEnd] + base64Encode(raw)
+
+	_, err = decode(tampered, "test_password", nil)
+	if !errors.Is(err, ErrValueIntegrity) {
+		t.Fatalf("decode Failure: Expected [%v] for tampered value received [%v]", ErrValueIntegrity, err)
+	}
+}
+
+func Test_decode_LegacyXor(t *testing.T) {
+	test_val := "test_value"
+	test_pass := "test_password"
+	legacy := encodeXor(test_val, test_pass)
+
+	str, err := decode(legacy, test_pass, nil)
+	if err != nil {
+		t.Fatalf("decode Failure [%v]", err.Error())
+	}
+	if str != test_val {
+		t.Fatalf("decoded String Match Failure: Expected [%v], received [%v]", test_val, str)
+	}
+}
+
+func Test_encode_Scrypt(t *testing.T) {
+	test_val := "test_value"
+	test_pass := "test_password"
+
+	encoded_str, err := encode(test_val, test_pass, KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}, nil)
+	if err != nil {
+		t.Fatalf("encode Failure [%v]", err.Error())
+	}
+
+	if !strings.HasPrefix(encoded_str, ENVELOPE_MAGIC+"1$aes-256-gcm$scrypt$n=1024,r=8,p=1$") {
+		t.Fatalf("encode Failure: Expected scrypt header, received [%v]", encoded_str)
+	}
+
+	// Decoding must use the parameters in the header, not the defaults
+	str, err := decode(encoded_str, test_pass, nil)
+	if err != nil {
+		t.Fatalf("decode Failure [%v]", err.Error())
+	}
+	if str != test_val {
+		t.Fatalf("decoded String Match Failure: Expected [%v], received [%v]", test_val, str)
+	}
+}
+
+func Test_decode_UnsupportedCipher(t *testing.T) {
+	encoded_str, err := encode("test_value", "test_password", KdfOptions{}, nil)
+	if err != nil {
+		t.Fatalf("encode Failure [%v]", err.Error())
+	}
+
+	unknown := strings.Replace(encoded_str, CIPHER_AES_256_GCM, "chacha20-poly1305", 1)
+
+	_, err = decode(unknown, "test_password", nil)
+	if err == nil {
+		t.Fatal("decode Failure: Expected error for unsupported cipher")
+	}
+}
+
+func Test_decode_AssociatedDataMismatch(t *testing.T) {
+	encoded_str, err := encode("test_value", "test_password", KdfOptions{}, recordAssociatedData("id1", "tk_1"))
+	if err != nil {
+		t.Fatalf("encode Failure [%v]", err.Error())
+	}
+
+	str, err := decode(encoded_str, "test_password", recordAssociatedData("id1", "tk_1"))
+	if err != nil {
+		t.Fatalf("decode Failure [%v]", err.Error())
+	}
+	if str != "test_value" {
+		t.Fatalf("decoded String Match Failure: Expected [test_value], received [%v]", str)
+	}
+
+	_, err = decode(encoded_str, "test_password", recordAssociatedData("id2", "tk_2"))
+	if !errors.Is(err, ErrValueIntegrity) {
+		t.Fatalf("decode Failure: Expected [%v] received [%v]", ErrValueIntegrity, err)
+	}
+}
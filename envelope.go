@@ -0,0 +1,115 @@
+package vaultstore
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ENVELOPE_MAGIC is the prefix of every self-describing encrypted value
+const ENVELOPE_MAGIC = "$vs$"
+
+// ENVELOPE_VERSION is the format version written by encode
+const ENVELOPE_VERSION = 1
+
+const CIPHER_AES_256_GCM = "aes-256-gcm"
+
+// CIPHER_XOR identifies the legacy XOR scheme, values without the magic prefix
+const CIPHER_XOR = "xor"
+
+// envelope is the parsed form of an encrypted vault value
+//
+// Format (version 1):
+//
+//	$vs$1$<cipher>$<kdf>$<kdf params>$<base64 salt>$<base64 nonce>$<base64 key check>$<base64 ciphertext>
+//
+// Example:
+//
+//	$vs$1$aes-256-gcm$argon2id$m=65536,t=1,p=4$<salt>$<nonce>$<key check>$<ciphertext>
+//
+// The ciphertext authenticates the record ID and token as associated
+// data, and the key check tells a wrong password apart from a tampered
+// value. Values without the magic prefix are legacy XOR values, parsed
+// as version 0.
+type envelope struct {
+	Version    int
+	Cipher     string
+	Kdf        string
+	KdfParams  string
+	Salt       []byte
+	Nonce      []byte
+	KeyCheck   []byte
+	Ciphertext []byte
+}
+
+// String serializes the envelope in the current format version
+func (e envelope) String() string {
+	return ENVELOPE_MAGIC + strings.Join([]string{
+		strconv.Itoa(ENVELOPE_VERSION),
+		e.Cipher,
+		e.Kdf,
+		e.KdfParams,
+		base64Encode(e.Salt),
+		base64Encode(e.Nonce),
+		base64Encode(e.KeyCheck),
+		base64Encode(e.Ciphertext),
+	}, "$")
+}
+
+// parseEnvelope parses an encrypted value, or a legacy XOR value
+func parseEnvelope(value string) (envelope, error) {
+	if !strings.HasPrefix(value, ENVELOPE_MAGIC) {
+		return envelope{Version: 0, Cipher: CIPHER_XOR}, nil
+	}
+
+	versionStr, body, _ := strings.Cut(strings.TrimPrefix(value, ENVELOPE_MAGIC), "$")
+
+	version, err := strconv.Atoi(versionStr)
+
+	if err != nil {
+		return envelope{}, errors.New("envelope version malformed: " + versionStr)
+	}
+
+	if version != ENVELOPE_VERSION {
+		return envelope{}, errors.New("envelope version not supported: " + versionStr)
+	}
+
+	parts := strings.Split(body, "$")
+
+	if len(parts) != 7 {
+		return envelope{}, errors.New("envelope header malformed")
+	}
+
+	decoded := make([][]byte, len(parts)-3)
+
+	for i, part := range parts[3:] {
+		decoded[i], err = base64Decode(part)
+
+		if err != nil {
+			return envelope{}, errors.New("envelope malformed. " + err.Error())
+		}
+	}
+
+	return envelope{
+		Version:    version,
+		Cipher:     parts[0],
+		Kdf:        parts[1],
+		KdfParams:  parts[2],
+		Salt:       decoded[0],
+		Nonce:      decoded[1],
+		KeyCheck:   decoded[2],
+		Ciphertext: decoded[3],
+	}, nil
+}
+
+// isOutdated checks if the value is a legacy XOR value, or was
+// written with key derivation settings other than the given ones
+func (e envelope) isOutdated(kdf KdfOptions) bool {
+	kdf = kdf.withDefaults()
+
+	if e.Version < ENVELOPE_VERSION {
+		return true
+	}
+
+	return e.Kdf != kdf.Algorithm || e.KdfParams != kdf.paramsString()
+}
@@ -0,0 +1,63 @@
+package vaultstore
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_envelope_String(t *testing.T) {
+	e := envelope{
+		Version:    ENVELOPE_VERSION,
+		Cipher:     CIPHER_AES_256_GCM,
+		Kdf:        KDF_ARGON2ID,
+		KdfParams:  "m=1024,t=1,p=1",
+		Salt:       []byte("salt"),
+		Nonce:      []byte("nonce"),
+		KeyCheck:   []byte("check"),
+		Ciphertext: []byte("ciphertext"),
+	}
+
+	parsed, err := parseEnvelope(e.String())
+	if err != nil {
+		t.Fatalf("parseEnvelope: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if parsed.Version != ENVELOPE_VERSION {
+		t.Fatalf("Expected version [%v] received [%v]", ENVELOPE_VERSION, parsed.Version)
+	}
+
+	if parsed.Cipher != e.Cipher || parsed.Kdf != e.Kdf || parsed.KdfParams != e.KdfParams {
+		t.Fatalf("Expected header [%v] received [%v]", e, parsed)
+	}
+
+	if !bytes.Equal(parsed.Salt, e.Salt) || !bytes.Equal(parsed.Nonce, e.Nonce) || !bytes.Equal(parsed.KeyCheck, e.KeyCheck) || !bytes.Equal(parsed.Ciphertext, e.Ciphertext) {
+		t.Fatalf("Expected payload [%v] received [%v]", e, parsed)
+	}
+}
+
+func Test_parseEnvelope_Legacy(t *testing.T) {
+	e, err := parseEnvelope(encodeXor("test_value", "test_password"))
+	if err != nil {
+		t.Fatalf("parseEnvelope: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if e.Version != 0 || e.Cipher != CIPHER_XOR {
+		t.Fatalf("Expected legacy XOR envelope received [%v]", e)
+	}
+}
+
+func Test_parseEnvelope_Malformed(t *testing.T) {
+	malformed := []string{
+		"$vs$x$aes-256-gcm",
+		"$vs$9$aes-256-gcm$argon2id$m=1,t=1,p=1$AA==$AA==$AA==$AA==",
+		"$vs$1$aes-256-gcm$argon2id$m=1,t=1,p=1$AA==$AA==$AA==",
+		"$vs$1$aes-256-gcm$argon2id$m=1,t=1,p=1$!!$AA==$AA==$AA==",
+		"$vs$1$",
+	}
+
+	for _, value := range malformed {
+		if _, err := parseEnvelope(value); err == nil {
+			t.Fatalf("Expected error for malformed envelope [%v]", value)
+		}
+	}
+}
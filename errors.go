@@ -0,0 +1,148 @@
+package vaultstore
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrEmptyToken is returned when the supplied token is empty
+var ErrEmptyToken = errors.New("token is empty")
+
+// ErrEmptyRecordID is returned when the supplied record ID is empty
+var ErrEmptyRecordID = errors.New("record id is empty")
+
+// ErrNilRecord is returned when the supplied record is nil
+var ErrNilRecord = errors.New("record is nil")
+
+// ErrEmptyPassword is returned when the supplied password is empty,
+// and the store has no KeyProvider to encrypt the value with
+var ErrEmptyPassword = errors.New("password is empty")
+
+// ErrTokenNotFound is returned when the token does not exist
+var ErrTokenNotFound = errors.New("token does not exist")
+
+// ErrRecordNotFound is returned when the record does not exist
+var ErrRecordNotFound = errors.New("record not found")
+
+// ErrInvalidPassword is returned when a value cannot be decrypted
+// with the supplied password
+var ErrInvalidPassword = errors.New("vault password incorrect")
+
+// ErrValueIntegrity is returned when the password is correct, but the
+// stored value was tampered with, or copied from another record
+var ErrValueIntegrity = errors.New("vault value integrity check failed")
+
+// ErrVersionNotFound is returned when the version of a token does not
+// exist, or was deleted as it exceeded the number of versions kept
+var ErrVersionNotFound = errors.New("token version does not exist")
+
+// ErrAuditChainBroken is returned by VerifyAuditChain when an audit
+// entry was edited or deleted, see AuditChainError
+var ErrAuditChainBroken = errors.New("audit chain broken")
+
+// ErrBlindIndexKeyRequired is returned when a blind index is requested,
+// but the store has no BlindIndex.Key
+var ErrBlindIndexKeyRequired = errors.New("blind index key is not configured")
+
+// ErrDeterministicKeyRequired is returned when a deterministic token
+// is requested, but the store has no DeterministicKey
+var ErrDeterministicKeyRequired = errors.New("deterministic key is not configured")
+
+// ErrDeterministicTokenImmutable is returned when updating the value of a
+// deterministic token, as its token is derived from the value
+var ErrDeterministicTokenImmutable = errors.New("deterministic token value cannot be changed")
+
+// ErrTokenCollision is returned when no free token was generated
+// within the retries, see TokenCollisionError
+var ErrTokenCollision = errors.New("token collision")
+
+// ErrTokenExists is returned when creating a custom token that is already taken
+var ErrTokenExists = errors.New("token already exists")
+
+// ErrRevisionConflict is returned when a record was updated concurrently,
+// and no longer has the expected revision, see RevisionConflictError
+var ErrRevisionConflict = errors.New("revision conflict")
+
+// ErrReadLimitedInTx is returned when reading a read limited token inside
+// a transaction, as a rollback would restore the reads it consumed
+var ErrReadLimitedInTx = errors.New("read limited token cannot be read inside a transaction")
+
+// ErrJanitorRunning is returned when starting the janitor of a store
+// whose janitor is already running, see StartJanitor
+var ErrJanitorRunning = errors.New("janitor is already running")
+
+// TokenCollisionError is returned when every generated token was
+// already taken, it matches ErrTokenCollision with errors.Is. Use
+// longer tokens, or raise NewStoreOptions.TokenCreateRetries.
+type TokenCollisionError struct {
+	Attempts int
+}
+
+func (e *TokenCollisionError) Error() string {
+	return "token collision: no free token after " + strconv.Itoa(e.Attempts) + " attempts"
+}
+
+func (e *TokenCollisionError) Is(target error) bool {
+	return target == ErrTokenCollision
+}
+
+// ErrPermissionDenied is returned when the principal of the context
+// may not access the token, see PermissionError
+var ErrPermissionDenied = errors.New("permission denied")
+
+// PermissionError is returned when the policy evaluator denies the
+// principal of the context access to a token, it matches
+// ErrPermissionDenied with errors.Is. The token is left empty when
+// it was looked up by its value, so the denial does not disclose it.
+type PermissionError struct {
+	Principal  string
+	Permission string
+	Token      string
+}
+
+func (e *PermissionError) Error() string {
+	message := "permission denied: principal [" + e.Principal + "] may not " + e.Permission + " token"
+
+	if e.Token != "" {
+		message += " " + e.Token
+	}
+
+	return message
+}
+
+func (e *PermissionError) Is(target error) bool {
+	return target == ErrPermissionDenied
+}
+
+// MissingTokensError is returned when some of the requested tokens
+// do not exist, it matches ErrTokenNotFound with errors.Is
+type MissingTokensError struct {
+	Tokens []string
+}
+
+func (e *MissingTokensError) Error() string {
+	return "missing tokens: " + strings.Join(e.Tokens, ", ")
+}
+
+func (e *MissingTokensError) Is(target error) bool {
+	return target == ErrTokenNotFound
+}
+
+// RevisionConflictError is returned when updating a record which no
+// longer has the expected revision, as it was updated or deleted since
+// it was read, it matches ErrRevisionConflict with errors.Is. Read the
+// record again, and retry the update.
+type RevisionConflictError struct {
+	RecordID string
+	Token    string
+	Revision int
+}
+
+func (e *RevisionConflictError) Error() string {
+	return "revision conflict: record " + e.RecordID + " is no longer at revision " + strconv.Itoa(e.Revision)
+}
+
+func (e *RevisionConflictError) Is(target error) bool {
+	return target == ErrRevisionConflict
+}
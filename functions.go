@@ -7,7 +7,6 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
-	"fmt"
 	"os"
 	"regexp"
 )
@@ -41,9 +40,7 @@ func isBase64(value string) bool {
 //  1. Generate random lowercase string
 //  2. Prefix with "tk_"
 func generateToken(tokenLength int) (string, error) {
-	token := randomFromGamma(tokenLength-len(TOKEN_PREFIX), "abcdefghijklmnopqrstuvwxyz0123456789")
-
-	return fmt.Sprintf("%s%s", TOKEN_PREFIX, token), nil
+	return DefaultTokenFormat().generate(tokenLength)
 }
 
 // randomFromGamma generates random string of specified length with the characters specified in the gamma string
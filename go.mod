@@ -8,6 +8,7 @@ require (
 	github.com/gouniverse/base v0.7.0
 	github.com/gouniverse/uid v1.5.0
 	github.com/samber/lo v1.47.0
+	golang.org/x/crypto v0.31.0
 	modernc.org/sqlite v1.34.2
 )
 
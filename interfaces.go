@@ -2,6 +2,8 @@ package vaultstore
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/doug-martin/goqu/v9"
 )
@@ -12,22 +14,146 @@ type RecordInterface interface {
 	DataChanged() map[string]string
 
 	// Getters
+	GetAcl() ([]AclEntry, error)
 	GetCreatedAt() string
+	GetExpiresAt() string
 	GetSoftDeletedAt() string
 	GetID() string
+	GetBlindIndex() string
+	GetBlindIndexPrefix() string
+	GetBlindIndexSuffix() string
+	GetMetadata() (map[string]string, error)
+	GetNamespace() string
+	GetOwner() string
+	GetValueHmac() string
+	GetReadsRemaining() int
+	GetRevision() int
 	GetToken() string
 	GetUpdatedAt() string
 	GetValue() string
 
 	// Setters
+	SetAcl(acl []AclEntry) RecordInterface
 	SetCreatedAt(createdAt string) RecordInterface
+	SetExpiresAt(expiresAt string) RecordInterface
 	SetSoftDeletedAt(softDeletedAt string) RecordInterface
 	SetID(id string) RecordInterface
+	SetBlindIndex(blindIndex string) RecordInterface
+	SetBlindIndexPrefix(blindIndexPrefix string) RecordInterface
+	SetBlindIndexSuffix(blindIndexSuffix string) RecordInterface
+	SetMetadata(metadata map[string]string) RecordInterface
+	SetNamespace(namespace string) RecordInterface
+	SetOwner(owner string) RecordInterface
+	SetValueHmac(valueHmac string) RecordInterface
+	SetReadsRemaining(readsRemaining int) RecordInterface
+	SetRevision(revision int) RecordInterface
 	SetToken(token string) RecordInterface
 	SetUpdatedAt(updatedAt string) RecordInterface
 	SetValue(value string) RecordInterface
 }
 
+// AuditEntryInterface defines the methods that an AuditEntry must implement
+type AuditEntryInterface interface {
+	Data() map[string]string
+	DataChanged() map[string]string
+
+	// Getters
+	GetAction() string
+	GetActor() string
+	GetCreatedAt() string
+	GetHash() string
+	GetHmac() string
+	GetID() string
+	GetNamespace() string
+	GetOutcome() string
+	GetPrevHash() string
+	GetPurpose() string
+	GetSequence() int64
+	GetToken() string
+
+	// Setters
+	SetAction(action string) AuditEntryInterface
+	SetActor(actor string) AuditEntryInterface
+	SetCreatedAt(createdAt string) AuditEntryInterface
+	SetHash(hash string) AuditEntryInterface
+	SetHmac(hmac string) AuditEntryInterface
+	SetID(id string) AuditEntryInterface
+	SetNamespace(namespace string) AuditEntryInterface
+	SetOutcome(outcome string) AuditEntryInterface
+	SetPrevHash(prevHash string) AuditEntryInterface
+	SetPurpose(purpose string) AuditEntryInterface
+	SetSequence(sequence int64) AuditEntryInterface
+	SetToken(token string) AuditEntryInterface
+}
+
+type AuditQueryInterface interface {
+	Validate() error
+	toSelectDataset(store StoreInterface) (selectDataset *goqu.SelectDataset, columns []any, err error)
+
+	GetColumns() []string
+	SetColumns(columns []string) AuditQueryInterface
+
+	IsIDSet() bool
+	GetID() string
+	SetID(id string) AuditQueryInterface
+
+	IsActionSet() bool
+	GetAction() string
+	SetAction(action string) AuditQueryInterface
+
+	IsActionInSet() bool
+	GetActionIn() []string
+	SetActionIn(actionIn []string) AuditQueryInterface
+
+	IsActorSet() bool
+	GetActor() string
+	SetActor(actor string) AuditQueryInterface
+
+	IsOutcomeSet() bool
+	GetOutcome() string
+	SetOutcome(outcome string) AuditQueryInterface
+
+	IsTokenSet() bool
+	GetToken() string
+	SetToken(token string) AuditQueryInterface
+
+	IsNamespaceSet() bool
+	GetNamespace() string
+	SetNamespace(namespace string) AuditQueryInterface
+
+	IsNamespaceAllSet() bool
+	GetNamespaceAll() bool
+	SetNamespaceAll(namespaceAll bool) AuditQueryInterface
+
+	IsCreatedAtGteSet() bool
+	GetCreatedAtGte() string
+	SetCreatedAtGte(createdAtGte string) AuditQueryInterface
+
+	IsCreatedAtLteSet() bool
+	GetCreatedAtLte() string
+	SetCreatedAtLte(createdAtLte string) AuditQueryInterface
+
+	IsOffsetSet() bool
+	GetOffset() int
+	SetOffset(offset int) AuditQueryInterface
+
+	IsOrderBySet() bool
+	GetOrderBy() string
+	SetOrderBy(orderBy string) AuditQueryInterface
+
+	IsLimitSet() bool
+	GetLimit() int
+	SetLimit(limit int) AuditQueryInterface
+
+	IsCountOnlySet() bool
+	GetCountOnly() bool
+	SetCountOnly(countOnly bool) AuditQueryInterface
+
+	IsSortOrderSet() bool
+	GetSortOrder() string
+	SetSortOrder(sortOrder string) AuditQueryInterface
+}
+
 type RecordQueryInterface interface {
 	Validate() error
 	toSelectDataset(store StoreInterface) (selectDataset *goqu.SelectDataset, columns []any, err error)
@@ -39,14 +165,50 @@ type RecordQueryInterface interface {
 	GetID() string
 	SetID(id string) RecordQueryInterface
 
+	IsIDGtSet() bool
+	GetIDGt() string
+	SetIDGt(idGt string) RecordQueryInterface
+
 	IsIDInSet() bool
 	GetIDIn() []string
 	SetIDIn(idIn []string) RecordQueryInterface
 
+	IsLabelsSet() bool
+	GetLabels() map[string]string
+	SetLabel(key string, value string) RecordQueryInterface
+
+	IsMetadataContainsSet() bool
+	GetMetadataContains() map[string]string
+	SetMetadataContains(metadata map[string]string) RecordQueryInterface
+
+	IsNamespaceSet() bool
+	GetNamespace() string
+	SetNamespace(namespace string) RecordQueryInterface
+
+	IsNamespaceAllSet() bool
+	GetNamespaceAll() bool
+	SetNamespaceAll(namespaceAll bool) RecordQueryInterface
+
 	IsTokenSet() bool
 	GetToken() string
 	SetToken(token string) RecordQueryInterface
 
+	IsValueHmacSet() bool
+	GetValueHmac() string
+	SetValueHmac(valueHmac string) RecordQueryInterface
+
+	IsBlindIndexSet() bool
+	GetBlindIndex() string
+	SetBlindIndex(blindIndex string) RecordQueryInterface
+
+	IsBlindIndexPrefixSet() bool
+	GetBlindIndexPrefix() string
+	SetBlindIndexPrefix(blindIndexPrefix string) RecordQueryInterface
+
+	IsBlindIndexSuffixSet() bool
+	GetBlindIndexSuffix() string
+	SetBlindIndexSuffix(blindIndexSuffix string) RecordQueryInterface
+
 	IsTokenInSet() bool
 	GetTokenIn() []string
 	SetTokenIn(tokenIn []string) RecordQueryInterface
@@ -74,14 +236,46 @@ type RecordQueryInterface interface {
 	IsSoftDeletedIncludeSet() bool
 	GetSoftDeletedInclude() bool
 	SetSoftDeletedInclude(softDeletedInclude bool) RecordQueryInterface
+
+	IsExpiredIncludeSet() bool
+	GetExpiredInclude() bool
+	SetExpiredInclude(expiredInclude bool) RecordQueryInterface
+
+	IsExpiredOnlySet() bool
+	GetExpiredOnly() bool
+	SetExpiredOnly(expiredOnly bool) RecordQueryInterface
 }
 
 type StoreInterface interface {
 	AutoMigrate() error
 	EnableDebug(debug bool)
 
+	AuditCount(ctx context.Context, query AuditQueryInterface) (int64, error)
+	AuditList(ctx context.Context, query AuditQueryInterface) ([]AuditEntryInterface, error)
+	VerifyAuditChain(ctx context.Context) (verified int64, err error)
+
+	GetAuditTableName() string
 	GetDbDriverName() string
+	GetNamespace() string
+	GetTx() *sql.Tx
 	GetVaultTableName() string
+	GetVaultVersionTableName() string
+
+	BlindIndex(ctx context.Context, value string) (string, error)
+	BlindIndexPrefix(ctx context.Context, value string) (string, error)
+	BlindIndexSuffix(ctx context.Context, value string) (string, error)
+
+	IsToken(ctx context.Context, s string) bool
+
+	JanitorRun(ctx context.Context) JanitorReport
+	StartJanitor(ctx context.Context, interval time.Duration) (stop func(), err error)
+
+	Namespace(namespace string) StoreInterface
+	NamespaceCounts(ctx context.Context) (map[string]int64, error)
+	NamespacePurge(ctx context.Context, namespace string) (int64, error)
+
+	PurgeSoftDeleted(ctx context.Context, olderThan time.Duration) (int64, error)
+	PurgeSoftDeletedCount(ctx context.Context, olderThan time.Duration) (int64, error)
 
 	RecordCount(ctx context.Context, query RecordQueryInterface) (int64, error)
 	RecordCreate(ctx context.Context, record RecordInterface) error
@@ -90,17 +284,37 @@ type StoreInterface interface {
 	RecordFindByID(ctx context.Context, recordID string) (RecordInterface, error)
 	RecordFindByToken(ctx context.Context, token string) (RecordInterface, error)
 	RecordList(ctx context.Context, query RecordQueryInterface) ([]RecordInterface, error)
+	RecordRestoreByID(ctx context.Context, recordID string) error
 	RecordSoftDelete(ctx context.Context, record RecordInterface) error
 	RecordSoftDeleteByID(ctx context.Context, recordID string) error
 	RecordSoftDeleteByToken(ctx context.Context, token string) error
 	RecordUpdate(ctx context.Context, record RecordInterface) error
 
+	RekeyAll(ctx context.Context, oldPassword string, newPassword string, opts RekeyOptions) (RekeyProgress, error)
+
 	TokenCreate(ctx context.Context, value string, password string, tokenLength int) (token string, err error)
 	TokenCreateCustom(ctx context.Context, token string, value string, password string) (err error)
+	TokenCreateWithOptions(ctx context.Context, value string, password string, tokenLength int, opts TokenCreateOptions) (token string, err error)
 	TokenDelete(ctx context.Context, token string) error
 	TokenExists(ctx context.Context, token string) (bool, error)
+	TokenFindByValue(ctx context.Context, value string) (token string, err error)
 	TokenRead(ctx context.Context, token string, password string) (string, error)
+	TokenReadVersion(ctx context.Context, token string, version int, password string) (string, error)
+	TokenRestore(ctx context.Context, token string) error
+	TokenRevision(ctx context.Context, token string) (int, error)
+	TokenRollback(ctx context.Context, token string, version int) error
 	TokenSoftDelete(ctx context.Context, token string) error
 	TokenUpdate(ctx context.Context, token string, value string, password string) error
+	TokenUpdateExpiration(ctx context.Context, token string, expiresAt time.Time) error
+	TokenUpdateIfRevision(ctx context.Context, token string, revision int, value string, password string) error
+	TokenVersions(ctx context.Context, token string) ([]TokenVersion, error)
+	TokensCreate(ctx context.Context, values []string, password string, tokenLength int) ([]string, error)
+	TokensDelete(ctx context.Context, tokens []string) error
 	TokensRead(ctx context.Context, tokens []string, password string) (map[string]string, error)
+	TokensRestore(ctx context.Context, tokens []string) error
+	TokensRestoreCount(ctx context.Context, tokens []string) (int64, error)
+	TokensSoftDelete(ctx context.Context, tokens []string) error
+	TokensUpdate(ctx context.Context, values map[string]string, password string) error
+
+	WithTx(ctx context.Context, fn func(tx StoreInterface) error) error
 }
@@ -1,7 +1,8 @@
 package vaultstore
 
-import "strings"
-
+// IsToken returns true if the string has the default token format,
+// use Store.IsToken for stores with a custom TokenFormat. Format
+// preserving tokens are not recognized, see Store.TokenExists.
 func IsToken(s string) bool {
-	return strings.HasPrefix(s, TOKEN_PREFIX)
+	return DefaultTokenFormat().IsToken(s)
 }
@@ -39,6 +39,27 @@ func TestIsToken(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name: "is not token, shorter than the min length",
+			args: args{
+				s: "tk_1",
+			},
+			want: false,
+		},
+		{
+			name: "is not token, longer than the token column",
+			args: args{
+				s: "tk_12345678901234567890123456789012345678",
+			},
+			want: false,
+		},
+		{
+			name: "is not token, character outside of the alphabet",
+			args: args{
+				s: "tk_12A45",
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,190 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dromara/carbon/v2"
+)
+
+// JANITOR_SOFT_DELETED_RETENTION_DEFAULT is the default time the soft
+// deleted records are kept, before the janitor purges them
+const JANITOR_SOFT_DELETED_RETENTION_DEFAULT = 30 * 24 * time.Hour
+
+// JanitorOptions define the purge of the soft deleted and expired
+// records, see StartJanitor and JanitorRun
+type JanitorOptions struct {
+	// SoftDeletedRetention is the time the soft deleted records are kept
+	// before being purged (default: 30 days)
+	SoftDeletedRetention time.Duration
+
+	// BatchSize is the number of records purged per transaction
+	// (default: PURGE_BATCH_SIZE)
+	BatchSize int
+
+	// OnRun is called with the report of every run, i.e. to log the run
+	// or export metrics
+	OnRun func(report JanitorReport)
+}
+
+// JanitorReport describes a janitor run
+type JanitorReport struct {
+	// StartedAt is the time the run started
+	StartedAt time.Time
+
+	// Duration is the time the run took
+	Duration time.Duration
+
+	// SoftDeletedPurged is the number of soft deleted records purged
+	SoftDeletedPurged int64
+
+	// ExpiredPurged is the number of expired records purged
+	ExpiredPurged int64
+
+	// Err is the error which ended the run early, nil on success
+	Err error
+}
+
+func (o JanitorOptions) withDefaults() JanitorOptions {
+	if o.SoftDeletedRetention == 0 {
+		o.SoftDeletedRetention = JANITOR_SOFT_DELETED_RETENTION_DEFAULT
+	}
+
+	if o.BatchSize == 0 {
+		o.BatchSize = PURGE_BATCH_SIZE
+	}
+
+	return o
+}
+
+func (o JanitorOptions) validate() error {
+	if o.SoftDeletedRetention < 0 {
+		return errors.New("janitor soft deleted retention cannot be negative")
+	}
+
+	if o.BatchSize < 0 {
+		return errors.New("janitor batch size cannot be negative")
+	}
+
+	return nil
+}
+
+// janitorState guards the janitor goroutine, it is shared by the
+// copies of the store, i.e. the namespaced and transaction bound stores
+type janitorState struct {
+	mutex   sync.Mutex
+	running bool
+}
+
+// StartJanitor starts purging the soft deleted records older than the
+// retention, and the expired records, in the background every interval
+//
+// The first run starts after one interval. The janitor stops when the
+// context is cancelled, or stop is called, a run in progress stops after
+// its current batch. The retention, batch size and report callback are
+// taken from NewStoreOptions.Janitor. A scoped store only purges its
+// namespace. Only one janitor runs per store, including its namespaces.
+//
+// # If the janitor is already running, ErrJanitorRunning is returned
+//
+// Parameters:
+// - ctx: The context, cancel it to stop the janitor
+// - interval: The time between the runs
+//
+// Returns:
+// - stop: Stops the janitor, and waits until it has stopped
+// - err: An error if the interval is not positive, or the janitor is running
+func (st *Store) StartJanitor(ctx context.Context, interval time.Duration) (stop func(), err error) {
+	if interval <= 0 {
+		return nil, errors.New("janitor interval must be positive")
+	}
+
+	st.janitorState.mutex.Lock()
+	defer st.janitorState.mutex.Unlock()
+
+	if st.janitorState.running {
+		return nil, ErrJanitorRunning
+	}
+
+	st.janitorState.running = true
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		defer func() {
+			st.janitorState.mutex.Lock()
+			st.janitorState.running = false
+			st.janitorState.mutex.Unlock()
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// the errors are reported to OnRun, the next run retries
+				st.JanitorRun(ctx)
+			}
+		}
+	}()
+
+	stop = func() {
+		cancel()
+		<-done
+	}
+
+	return stop, nil
+}
+
+// JanitorRun runs the janitor once, purging the soft deleted records
+// older than the retention, and the expired records, in batches
+//
+// The report is also passed to the OnRun callback of the janitor options.
+//
+// Parameters:
+// - ctx: The context
+//
+// Returns:
+// - report: What the run purged, and the error which ended it early
+func (st *Store) JanitorRun(ctx context.Context) (report JanitorReport) {
+	report.StartedAt = time.Now()
+
+	defer func() {
+		report.Duration = time.Since(report.StartedAt)
+
+		if st.janitor.OnRun != nil {
+			st.janitor.OnRun(report)
+		}
+	}()
+
+	report.SoftDeletedPurged, report.Err = st.purgeSoftDeleted(ctx, st.janitor.SoftDeletedRetention, st.janitor.BatchSize)
+
+	if report.Err != nil {
+		return report
+	}
+
+	report.ExpiredPurged, report.Err = st.purgeExpired(ctx, st.janitor.BatchSize)
+
+	return report
+}
+
+// purgeExpired hard deletes the expired records, and the records
+// without reads remaining, in batches of batchSize records
+func (st *Store) purgeExpired(ctx context.Context, batchSize int) (purged int64, err error) {
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	// records without an expiration or read limit (NULL) never expire
+	return st.purgeBatches(ctx, goqu.Or(
+		goqu.C(COLUMN_EXPIRES_AT).Lte(now),
+		goqu.C(COLUMN_READS_REMAINING).Eq(0),
+	), batchSize)
+}
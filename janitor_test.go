@@ -0,0 +1,150 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_Store_JanitorRun(t *testing.T) {
+	reports := []JanitorReport{}
+
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+		options.Janitor = JanitorOptions{
+			SoftDeletedRetention: 24 * time.Hour,
+			BatchSize:            2,
+			OnRun: func(report JanitorReport) {
+				reports = append(reports, report)
+			},
+		}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	tokens, err := store.TokensCreate(ctx, []string{"one", "two", "three", "four", "five"}, "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokensCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// soft deleted past the retention, soft deleted within it,
+	// expired, and 2 active tokens
+	softDeleteAt(t, store, tokens[0], time.Now().UTC().AddDate(0, 0, -2).Format(time.DateTime))
+
+	if err := store.TokenSoftDelete(ctx, tokens[1]); err != nil {
+		t.Fatalf("TokenSoftDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenUpdateExpiration(ctx, tokens[2], time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("TokenUpdateExpiration: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	report := store.JanitorRun(ctx)
+	if report.Err != nil {
+		t.Fatalf("JanitorRun: Expected [err] to be nil received [%v]", report.Err.Error())
+	}
+	if report.SoftDeletedPurged != 1 || report.ExpiredPurged != 1 {
+		t.Fatalf("JanitorRun: Expected [1] soft deleted and [1] expired purged received [%v] and [%v]", report.SoftDeletedPurged, report.ExpiredPurged)
+	}
+
+	if len(reports) != 1 || reports[0].ExpiredPurged != 1 {
+		t.Fatalf("OnRun: Expected the report received [%v]", reports)
+	}
+
+	count, err := store.RecordCount(ctx, RecordQuery().SetSoftDeletedInclude(true).SetExpiredInclude(true))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 3 {
+		t.Fatalf("RecordCount: Expected [3] received [%v]", count)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	report = store.JanitorRun(cancelled)
+	if report.Err != context.Canceled {
+		t.Fatalf("JanitorRun: Expected [%v] received [%v]", context.Canceled, report.Err)
+	}
+}
+
+func Test_Store_StartJanitor(t *testing.T) {
+	runs := make(chan JanitorReport, 10)
+
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.Janitor = JanitorOptions{
+			OnRun: func(report JanitorReport) {
+				runs <- report
+			},
+		}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := store.StartJanitor(ctx, 0); err == nil {
+		t.Fatal("StartJanitor: Expected [err] for a zero interval received [nil]")
+	}
+
+	stop, err := store.StartJanitor(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("StartJanitor: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// a second janitor is refused, also from a namespace of the store
+	if _, err := store.StartJanitor(ctx, 10*time.Millisecond); !errors.Is(err, ErrJanitorRunning) {
+		t.Fatalf("StartJanitor: Expected [%v] received [%v]", ErrJanitorRunning, err)
+	}
+	if _, err := store.Namespace("acme").StartJanitor(ctx, 10*time.Millisecond); !errors.Is(err, ErrJanitorRunning) {
+		t.Fatalf("StartJanitor: Expected [%v] received [%v]", ErrJanitorRunning, err)
+	}
+
+	select {
+	case report := <-runs:
+		if report.Err != nil {
+			t.Fatalf("JanitorRun: Expected [err] to be nil received [%v]", report.Err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("StartJanitor: Expected a run within 5 seconds")
+	}
+
+	// stop waits for the janitor, a run in progress has reported by then
+	stop()
+	stop()
+
+	for len(runs) > 0 {
+		<-runs
+	}
+
+	select {
+	case <-runs:
+		t.Fatal("StartJanitor: Expected no run after the janitor is stopped")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the stopped janitor can be started again, and stops with its context
+	restartCtx, restartCancel := context.WithCancel(context.Background())
+
+	stop, err = store.StartJanitor(restartCtx, time.Hour)
+	if err != nil {
+		t.Fatalf("StartJanitor: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	restartCancel()
+	stop()
+
+	if _, err := NewStore(NewStoreOptions{
+		VaultTableName: "vault_janitor_negative",
+		DB:             store.(*Store).db,
+		Janitor:        JanitorOptions{SoftDeletedRetention: -time.Second},
+	}); err == nil {
+		t.Fatal("NewStore: Expected [err] for a negative janitor retention received [nil]")
+	}
+}
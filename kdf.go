@@ -0,0 +1,195 @@
+package vaultstore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const KDF_ARGON2ID = "argon2id"
+const KDF_SCRYPT = "scrypt"
+
+const kdfKeyLength = 32
+const kdfSaltLength = 16
+
+// Upper bounds of the cost parameters, 16 times the defaults, so the
+// header of a tampered value cannot make a read allocate unbounded memory
+const kdfMemoryMax = 1 << 30 // bytes, argon2id m * 1024 or scrypt 128 * n * r
+const kdfArgon2TimeMax = 16
+const kdfScryptPMax = 16
+
+// KdfOptions define the key derivation function, and its cost parameters,
+// used to derive an encryption key from a password
+//
+// Zero values are replaced with the defaults. The parameters are saved
+// in the header of each encrypted value, so they can be raised later
+// without breaking existing records.
+type KdfOptions struct {
+	// Algorithm is either KDF_ARGON2ID (default) or KDF_SCRYPT
+	Algorithm string
+
+	// Argon2Time is the number of passes over the memory (default: 1)
+	Argon2Time uint32
+	// Argon2Memory is the memory size in KiB (default: 64 MiB)
+	Argon2Memory uint32
+	// Argon2Threads is the degree of parallelism (default: 4)
+	Argon2Threads uint8
+
+	// ScryptN is the CPU/memory cost, must be a power of two (default: 32768)
+	ScryptN int
+	// ScryptR is the block size (default: 8)
+	ScryptR int
+	// ScryptP is the parallelization (default: 1)
+	ScryptP int
+}
+
+// withDefaults returns a copy of the options with the zero values
+// replaced by the recommended defaults
+func (o KdfOptions) withDefaults() KdfOptions {
+	if o.Algorithm == "" {
+		o.Algorithm = KDF_ARGON2ID
+	}
+
+	if o.Argon2Time == 0 {
+		o.Argon2Time = 1
+	}
+
+	if o.Argon2Memory == 0 {
+		o.Argon2Memory = 64 * 1024
+	}
+
+	if o.Argon2Threads == 0 {
+		o.Argon2Threads = 4
+	}
+
+	if o.ScryptN == 0 {
+		o.ScryptN = 32768
+	}
+
+	if o.ScryptR == 0 {
+		o.ScryptR = 8
+	}
+
+	if o.ScryptP == 0 {
+		o.ScryptP = 1
+	}
+
+	return o
+}
+
+// validate checks the algorithm is supported, and the cost parameters
+// are within the bounds accepted when reading the values back
+func (o KdfOptions) validate() error {
+	if o.Algorithm != KDF_ARGON2ID && o.Algorithm != KDF_SCRYPT {
+		return errors.New("kdf algorithm not supported: " + o.Algorithm)
+	}
+
+	if o.Algorithm == KDF_SCRYPT && (o.ScryptN < 2 || o.ScryptN&(o.ScryptN-1) != 0) {
+		return errors.New("kdf scrypt N must be a power of two greater than 1")
+	}
+
+	if o.exceedsCostMax() {
+		return errors.New("kdf cost exceeds the maximum: " + o.paramsString())
+	}
+
+	return nil
+}
+
+// exceedsCostMax returns true if the memory or time cost of the
+// algorithm is above the upper bounds
+func (o KdfOptions) exceedsCostMax() bool {
+	switch o.Algorithm {
+	case KDF_ARGON2ID:
+		return uint64(o.Argon2Memory)*1024 > kdfMemoryMax || o.Argon2Time > kdfArgon2TimeMax
+	case KDF_SCRYPT:
+		// compared by division, as the product may overflow
+		return o.ScryptN > kdfMemoryMax/128 || o.ScryptR > kdfMemoryMax/128/max(o.ScryptN, 1) || o.ScryptP > kdfScryptPMax
+	}
+
+	return false
+}
+
+// deriveKey derives an encryption key from the password and salt
+func (o KdfOptions) deriveKey(password string, salt []byte) ([]byte, error) {
+	switch o.Algorithm {
+	case KDF_ARGON2ID:
+		return argon2.IDKey([]byte(password), salt, o.Argon2Time, o.Argon2Memory, o.Argon2Threads, kdfKeyLength), nil
+	case KDF_SCRYPT:
+		return scrypt.Key([]byte(password), salt, o.ScryptN, o.ScryptR, o.ScryptP, kdfKeyLength)
+	}
+
+	return nil, errors.New("kdf algorithm not supported: " + o.Algorithm)
+}
+
+// paramsString serializes the cost parameters for the value header
+//
+// Example:
+//   - argon2id: "m=65536,t=1,p=4"
+//   - scrypt: "n=32768,r=8,p=1"
+func (o KdfOptions) paramsString() string {
+	if o.Algorithm == KDF_SCRYPT {
+		return fmt.Sprintf("n=%d,r=%d,p=%d", o.ScryptN, o.ScryptR, o.ScryptP)
+	}
+
+	return fmt.Sprintf("m=%d,t=%d,p=%d", o.Argon2Memory, o.Argon2Time, o.Argon2Threads)
+}
+
+// kdfOptionsFromHeader parses the algorithm and cost parameters
+// saved in the value header
+//
+// # If the cost parameters exceed the upper bounds, ErrValueIntegrity is returned
+func kdfOptionsFromHeader(algorithm string, params string) (KdfOptions, error) {
+	o := KdfOptions{Algorithm: algorithm}
+
+	values := map[string]int{}
+
+	for _, pair := range strings.Split(params, ",") {
+		key, value, found := strings.Cut(pair, "=")
+
+		if !found {
+			return o, errors.New("kdf params malformed: " + params)
+		}
+
+		number, err := strconv.Atoi(value)
+
+		if err != nil || number < 1 {
+			return o, errors.New("kdf params malformed: " + params)
+		}
+
+		values[key] = number
+	}
+
+	// checked before the conversions, which could overflow
+	for _, number := range values {
+		if number > kdfMemoryMax {
+			return o, ErrValueIntegrity
+		}
+	}
+
+	switch algorithm {
+	case KDF_ARGON2ID:
+		if values["m"] == 0 || values["t"] == 0 || values["p"] == 0 || values["p"] > 255 {
+			return o, errors.New("kdf params malformed: " + params)
+		}
+		o.Argon2Memory = uint32(values["m"])
+		o.Argon2Time = uint32(values["t"])
+		o.Argon2Threads = uint8(values["p"])
+	case KDF_SCRYPT:
+		if values["n"] == 0 || values["r"] == 0 || values["p"] == 0 {
+			return o, errors.New("kdf params malformed: " + params)
+		}
+		o.ScryptN = values["n"]
+		o.ScryptR = values["r"]
+		o.ScryptP = values["p"]
+	}
+
+	if o.exceedsCostMax() {
+		return o, ErrValueIntegrity
+	}
+
+	return o, o.validate()
+}
@@ -0,0 +1,108 @@
+package vaultstore
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func Test_KdfOptions_withDefaults(t *testing.T) {
+	o := KdfOptions{}.withDefaults()
+
+	if o.Algorithm != KDF_ARGON2ID {
+		t.Fatalf("Expected algorithm [%v] received [%v]", KDF_ARGON2ID, o.Algorithm)
+	}
+
+	if o.Argon2Memory != 64*1024 || o.Argon2Time != 1 || o.Argon2Threads != 4 {
+		t.Fatalf("Unexpected argon2id defaults [%v]", o.paramsString())
+	}
+
+	custom := KdfOptions{Argon2Time: 3}.withDefaults()
+
+	if custom.Argon2Time != 3 {
+		t.Fatalf("Expected custom time [3] received [%v]", custom.Argon2Time)
+	}
+}
+
+func Test_KdfOptions_validate(t *testing.T) {
+	if err := (KdfOptions{Algorithm: "md5"}).withDefaults().validate(); err == nil {
+		t.Fatal("Expected error for unsupported algorithm")
+	}
+
+	if err := (KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1000}).withDefaults().validate(); err == nil {
+		t.Fatal("Expected error for scrypt N not a power of two")
+	}
+
+	if err := (KdfOptions{Algorithm: KDF_SCRYPT}).withDefaults().validate(); err != nil {
+		t.Fatalf("Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := (KdfOptions{Argon2Memory: 4 * 1024 * 1024}).withDefaults().validate(); err == nil {
+		t.Fatal("Expected error for argon2id memory above the maximum")
+	}
+}
+
+func Test_KdfOptions_deriveKey(t *testing.T) {
+	o := KdfOptions{Argon2Memory: 1024}.withDefaults()
+
+	key1, err := o.deriveKey("password", []byte("salt_salt_salt_1"))
+	if err != nil {
+		t.Fatalf("Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if len(key1) != kdfKeyLength {
+		t.Fatalf("Expected key length [%v] received [%v]", kdfKeyLength, len(key1))
+	}
+
+	key2, err := o.deriveKey("password", []byte("salt_salt_salt_2"))
+	if err != nil {
+		t.Fatalf("Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if bytes.Equal(key1, key2) {
+		t.Fatal("Expected different keys for different salts")
+	}
+}
+
+func Test_kdfOptionsFromHeader(t *testing.T) {
+	o, err := kdfOptionsFromHeader(KDF_ARGON2ID, "m=1024,t=2,p=1")
+	if err != nil {
+		t.Fatalf("Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if o.Argon2Memory != 1024 || o.Argon2Time != 2 || o.Argon2Threads != 1 {
+		t.Fatalf("Unexpected argon2id params [%v]", o.paramsString())
+	}
+
+	o, err = kdfOptionsFromHeader(KDF_SCRYPT, "n=1024,r=8,p=1")
+	if err != nil {
+		t.Fatalf("Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if o.paramsString() != "n=1024,r=8,p=1" {
+		t.Fatalf("Unexpected scrypt params [%v]", o.paramsString())
+	}
+
+	malformed := []string{"", "m=1024", "m=x,t=1,p=1", "m=1024,t=0,p=1"}
+
+	for _, params := range malformed {
+		if _, err := kdfOptionsFromHeader(KDF_ARGON2ID, params); err == nil {
+			t.Fatalf("Expected error for malformed params [%v]", params)
+		}
+	}
+
+	// a tampered header must not allocate unbounded memory
+	tampered := map[string]string{
+		"m=4294967295,t=1,p=4": KDF_ARGON2ID,
+		"m=65536,t=1000,p=4":   KDF_ARGON2ID,
+		"n=1073741824,r=8,p=1": KDF_SCRYPT,
+		"n=32768,r=1024,p=1":   KDF_SCRYPT,
+		"n=32768,r=8,p=1000":   KDF_SCRYPT,
+	}
+
+	for params, algorithm := range tampered {
+		if _, err := kdfOptionsFromHeader(algorithm, params); !errors.Is(err, ErrValueIntegrity) {
+			t.Fatalf("Expected [%v] for params [%v] received [%v]", ErrValueIntegrity, params, err)
+		}
+	}
+}
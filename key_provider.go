@@ -0,0 +1,162 @@
+package vaultstore
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+)
+
+// KDF_KEY_PROVIDER identifies values encrypted with a random data key,
+// which is wrapped by a KeyProvider. The envelope KDF params hold the
+// ID of the key encryption key, and the salt holds the wrapped data key.
+const KDF_KEY_PROVIDER = "kek"
+
+// KeyProvider wraps and unwraps the per-record data keys (DEK)
+// with a key encryption key (KEK) it manages
+//
+// Implementations can keep the key encryption keys in a KMS or HSM,
+// so the calling services do not need to hold the vault password.
+type KeyProvider interface {
+	// WrapKey encrypts the data key with the current key encryption key,
+	// and returns the ID of the key encryption key used
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrappedKey []byte, err error)
+
+	// UnwrapKey decrypts a data key wrapped with the identified key encryption key
+	UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte) (dataKey []byte, err error)
+}
+
+// encodeWithKeyProvider encrypts a value with a fresh random data key,
+// which is wrapped by the key provider and saved in the envelope
+func encodeWithKeyProvider(ctx context.Context, value string, provider KeyProvider, associatedData []byte) (string, error) {
+	dataKey := make([]byte, kdfKeyLength)
+
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	keyID, wrappedKey, err := provider.WrapKey(ctx, dataKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	if keyID == "" || strings.ContainsAny(keyID, "$,=") {
+		return "", errors.New("key provider: key id is invalid: " + keyID)
+	}
+
+	e := envelope{
+		Version:   ENVELOPE_VERSION,
+		Cipher:    CIPHER_AES_256_GCM,
+		Kdf:       KDF_KEY_PROVIDER,
+		KdfParams: "kid=" + keyID,
+		Salt:      wrappedKey,
+	}
+
+	return sealEnvelope(e, dataKey, value, associatedData)
+}
+
+// decodeWithKeyProvider unwraps the data key saved in the envelope
+// with the key provider, and decrypts the value
+func decodeWithKeyProvider(ctx context.Context, e envelope, provider KeyProvider, associatedData []byte) (string, error) {
+	keyID, found := strings.CutPrefix(e.KdfParams, "kid=")
+
+	if !found || keyID == "" {
+		return "", errors.New("kdf params malformed: " + e.KdfParams)
+	}
+
+	dataKey, err := provider.UnwrapKey(ctx, keyID, e.Salt)
+
+	if err != nil {
+		return "", err
+	}
+
+	return openEnvelope(e, dataKey, associatedData)
+}
+
+// == LOCAL KEY PROVIDER =====================================================
+
+// localKeyProvider is a KeyProvider keeping the key encryption keys in memory
+type localKeyProvider struct {
+	currentKeyID string
+	keys         map[string][]byte
+}
+
+var _ KeyProvider = (*localKeyProvider)(nil) // verify it extends the interface
+
+// NewLocalKeyProvider creates a KeyProvider keeping the key encryption
+// keys in memory, suitable for tests and single node deployments
+//
+// New data keys are wrapped with the current key, the other keys are
+// kept to unwrap data keys wrapped before a key rotation.
+//
+// Parameters:
+// - currentKeyID: The ID of the key used to wrap new data keys
+// - keys: The 32 byte key encryption keys by ID
+//
+// Returns:
+// - provider: The key provider
+// - err: An error if the keys are invalid
+func NewLocalKeyProvider(currentKeyID string, keys map[string][]byte) (KeyProvider, error) {
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, errors.New("key provider: current key not found: " + currentKeyID)
+	}
+
+	copied := map[string][]byte{}
+
+	for keyID, key := range keys {
+		if keyID == "" || strings.ContainsAny(keyID, "$,=") {
+			return nil, errors.New("key provider: key id is invalid: " + keyID)
+		}
+
+		if len(key) != kdfKeyLength {
+			return nil, errors.New("key provider: key must be 32 bytes: " + keyID)
+		}
+
+		copied[keyID] = append([]byte{}, key...)
+	}
+
+	return &localKeyProvider{
+		currentKeyID: currentKeyID,
+		keys:         copied,
+	}, nil
+}
+
+func (p *localKeyProvider) WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrappedKey []byte, err error) {
+	c := aesGcmCipher{}
+	nonce := make([]byte, c.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+
+	sealed, err := c.Seal(p.keys[p.currentKeyID], nonce, dataKey, []byte(p.currentKeyID))
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return p.currentKeyID, append(nonce, sealed...), nil
+}
+
+func (p *localKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte) (dataKey []byte, err error) {
+	key, ok := p.keys[keyID]
+
+	if !ok {
+		return nil, errors.New("key provider: key not found: " + keyID)
+	}
+
+	c := aesGcmCipher{}
+
+	if len(wrappedKey) < c.NonceSize() {
+		return nil, errors.New("key provider: wrapped key too short")
+	}
+
+	dataKey, err = c.Open(key, wrappedKey[:c.NonceSize()], wrappedKey[c.NonceSize():], []byte(keyID))
+
+	if err != nil {
+		return nil, errors.New("key provider: unwrap failed")
+	}
+
+	return dataKey, nil
+}
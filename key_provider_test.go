@@ -0,0 +1,132 @@
+package vaultstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func Test_NewLocalKeyProvider_Errors(t *testing.T) {
+	if _, err := NewLocalKeyProvider("k1", map[string][]byte{"k2": testKey(2)}); err == nil {
+		t.Fatal("Expected error for missing current key")
+	}
+
+	if _, err := NewLocalKeyProvider("k1", map[string][]byte{"k1": []byte("short")}); err == nil {
+		t.Fatal("Expected error for short key")
+	}
+
+	if _, err := NewLocalKeyProvider("k$1", map[string][]byte{"k$1": testKey(1)}); err == nil {
+		t.Fatal("Expected error for invalid key id")
+	}
+}
+
+func Test_LocalKeyProvider_WrapUnwrap(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := NewLocalKeyProvider("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatalf("Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	dataKey := testKey(9)
+
+	keyID, wrapped, err := provider.WrapKey(ctx, dataKey)
+	if err != nil {
+		t.Fatalf("WrapKey: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if keyID != "k1" {
+		t.Fatalf("WrapKey: Expected key id [k1] received [%v]", keyID)
+	}
+
+	if bytes.Contains(wrapped, dataKey) {
+		t.Fatal("WrapKey: Expected data key not to be stored in the clear")
+	}
+
+	unwrapped, err := provider.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		t.Fatalf("UnwrapKey: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Fatal("UnwrapKey: Expected the original data key")
+	}
+
+	if _, err := provider.UnwrapKey(ctx, "k2", wrapped); err == nil {
+		t.Fatal("UnwrapKey: Expected error for unknown key id")
+	}
+}
+
+func Test_Store_KeyProvider(t *testing.T) {
+	provider, err := NewLocalKeyProvider("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatalf("Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.KeyProvider = provider
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "provider_value", "", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	passwordToken, err := store.TokenCreate(ctx, "password_value", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	value, err := store.TokenRead(ctx, token, "")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "provider_value" {
+		t.Fatalf("TokenRead: Expected [provider_value] received [%v]", value)
+	}
+
+	value, err = store.TokenRead(ctx, passwordToken, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "password_value" {
+		t.Fatalf("TokenRead: Expected [password_value] received [%v]", value)
+	}
+
+	// Rotate the key encryption key, old values stay readable
+	rotated, err := NewLocalKeyProvider("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if err != nil {
+		t.Fatalf("Expected [err] to be nil received [%v]", err.Error())
+	}
+	store.(*Store).keyProvider = rotated
+
+	value, err = store.TokenRead(ctx, token, "")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "provider_value" {
+		t.Fatalf("TokenRead: Expected [provider_value] received [%v]", value)
+	}
+
+	// Without the key provider the value cannot be read
+	store.(*Store).keyProvider = nil
+
+	if _, err := store.TokenRead(ctx, token, "test_pass"); err == nil {
+		t.Fatal("TokenRead: Expected error without key provider")
+	}
+
+	// Without the key provider an empty password is refused
+	if _, err := store.TokenCreate(ctx, "provider_value", "", 20); !errors.Is(err, ErrEmptyPassword) {
+		t.Fatalf("TokenCreate: Expected [%v] received [%v]", ErrEmptyPassword, err)
+	}
+}
@@ -0,0 +1,211 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"path"
+
+	"github.com/samber/lo"
+)
+
+// Permissions checked by the policy evaluator
+const PERMISSION_READ = "read"
+const PERMISSION_UPDATE = "update"
+const PERMISSION_DELETE = "delete"
+
+type principalContextKey string
+
+const principalKey principalContextKey = "vaultstore_principal"
+
+// WithPrincipal returns a copy of the context carrying the principal,
+// i.e. the user or service, checked by the policy evaluator
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFromContext returns the principal carried by the context,
+// or an empty string if none
+func PrincipalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey).(string)
+	return principal
+}
+
+// AclEntry grants permissions on a single token
+type AclEntry struct {
+	// Principal is a glob pattern matched against the principal, i.e. "svc-billing-*"
+	Principal string `json:"principal"`
+
+	// Permissions are the permissions granted, i.e. PERMISSION_READ
+	Permissions []string `json:"permissions"`
+}
+
+// Policy grants permissions on the tokens matching its patterns
+type Policy struct {
+	// Principal is a glob pattern matched against the principal
+	Principal string
+
+	// Token is a glob pattern matched against the token, empty matches any token
+	Token string
+
+	// Owner is a glob pattern matched against the token owner, empty matches any owner
+	Owner string
+
+	// Labels are glob patterns matched against the token metadata by key,
+	// i.e. {"service": "billing-*"}, a token missing a label never matches
+	Labels map[string]string
+
+	// Permissions are the permissions granted, i.e. PERMISSION_READ
+	Permissions []string
+}
+
+// PolicyEvaluator decides if a principal may perform an action on a token
+type PolicyEvaluator interface {
+	// Evaluate returns true if the principal has the permission on the record
+	Evaluate(ctx context.Context, principal string, permission string, record RecordInterface) (allowed bool, err error)
+}
+
+// == POLICY EVALUATOR =======================================================
+
+// policyEvaluator is the PolicyEvaluator created by NewPolicyEvaluator
+type policyEvaluator struct {
+	policies []Policy
+}
+
+var _ PolicyEvaluator = (*policyEvaluator)(nil) // verify it extends the interface
+
+// NewPolicyEvaluator creates a PolicyEvaluator allowing an action if:
+//  1. the principal is the owner of the token, or
+//  2. an entry of the token ACL grants the permission to the principal, or
+//  3. one of the policies grants the permission on the token to the principal
+//
+// Everything else is denied, including any action without a principal.
+//
+// Parameters:
+// - policies: The store wide policies
+//
+// Returns:
+// - evaluator: The policy evaluator
+// - err: An error if a glob pattern is malformed
+func NewPolicyEvaluator(policies []Policy) (PolicyEvaluator, error) {
+	for _, policy := range policies {
+		if policy.Principal == "" {
+			return nil, errors.New("policy: principal pattern is required")
+		}
+
+		patterns := append([]string{policy.Principal, policy.Token, policy.Owner}, lo.Values(policy.Labels)...)
+
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, errors.New("policy: malformed pattern: " + pattern)
+			}
+		}
+	}
+
+	return &policyEvaluator{policies: policies}, nil
+}
+
+func (e *policyEvaluator) Evaluate(ctx context.Context, principal string, permission string, record RecordInterface) (bool, error) {
+	if principal == "" {
+		return false, nil
+	}
+
+	if record.GetOwner() != "" && record.GetOwner() == principal {
+		return true, nil
+	}
+
+	acl, err := record.GetAcl()
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range acl {
+		if globMatch(entry.Principal, principal) && lo.Contains(entry.Permissions, permission) {
+			return true, nil
+		}
+	}
+
+	for _, policy := range e.policies {
+		if !globMatch(policy.Principal, principal) || !lo.Contains(policy.Permissions, permission) {
+			continue
+		}
+
+		if policy.Token != "" && !globMatch(policy.Token, record.GetToken()) {
+			continue
+		}
+
+		if policy.Owner != "" && !globMatch(policy.Owner, record.GetOwner()) {
+			continue
+		}
+
+		labelsMatch, err := policyLabelsMatch(policy.Labels, record)
+
+		if err != nil {
+			return false, err
+		}
+
+		if !labelsMatch {
+			continue
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// policyLabelsMatch returns true if every label pattern matches the label
+// of the record metadata with the same key
+func policyLabelsMatch(labels map[string]string, record RecordInterface) (bool, error) {
+	if len(labels) == 0 {
+		return true, nil
+	}
+
+	metadata, err := record.GetMetadata()
+
+	if err != nil {
+		return false, err
+	}
+
+	for key, pattern := range labels {
+		value, exists := metadata[key]
+
+		if !exists || !globMatch(pattern, value) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// globMatch matches a value against a glob pattern, malformed patterns never match
+func globMatch(pattern string, value string) bool {
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
+
+// tokenAuthorize checks the principal of the context has the permission
+// on the record, always allowed if the store has no policy evaluator
+func (st *Store) tokenAuthorize(ctx context.Context, permission string, record RecordInterface) error {
+	if st.policyEvaluator == nil {
+		return nil
+	}
+
+	principal := PrincipalFromContext(ctx)
+
+	allowed, err := st.policyEvaluator.Evaluate(ctx, principal, permission, record)
+
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return &PermissionError{
+			Principal:  principal,
+			Permission: permission,
+			Token:      record.GetToken(),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func Test_Store_Policy_Owner(t *testing.T) {
+	evaluator, err := NewPolicyEvaluator(nil)
+	if err != nil {
+		t.Fatalf("NewPolicyEvaluator: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.PolicyEvaluator = evaluator
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	billing := WithPrincipal(context.Background(), "svc-billing")
+	shipping := WithPrincipal(context.Background(), "svc-shipping")
+
+	token, err := store.TokenCreate(billing, "card_number", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokenRead(billing, token, "test_pass"); err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	_, err = store.TokenRead(shipping, token, "test_pass")
+
+	var permissionErr *PermissionError
+	if !errors.As(err, &permissionErr) || !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokenRead: Expected [%v] received [%v]", ErrPermissionDenied, err)
+	}
+	if permissionErr.Principal != "svc-shipping" || permissionErr.Permission != PERMISSION_READ || permissionErr.Token != token {
+		t.Fatalf("TokenRead: Unexpected permission error [%v]", permissionErr)
+	}
+
+	if _, err := store.TokenRead(context.Background(), token, "test_pass"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokenRead: Expected [%v] without principal received [%v]", ErrPermissionDenied, err)
+	}
+
+	if _, err := store.TokensRead(shipping, []string{token}, "test_pass"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokensRead: Expected [%v] received [%v]", ErrPermissionDenied, err)
+	}
+
+	if err := store.TokenUpdate(shipping, token, "other", "test_pass"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokenUpdate: Expected [%v] received [%v]", ErrPermissionDenied, err)
+	}
+
+	if _, err := store.TokenVersions(shipping, token); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokenVersions: Expected [%v] received [%v]", ErrPermissionDenied, err)
+	}
+
+	if _, err := store.TokenRevision(shipping, token); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokenRevision: Expected [%v] received [%v]", ErrPermissionDenied, err)
+	}
+
+	if _, err := store.TokenVersions(billing, token); err != nil {
+		t.Fatalf("TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenSoftDelete(shipping, token); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokenSoftDelete: Expected [%v] received [%v]", ErrPermissionDenied, err)
+	}
+
+	if err := store.TokenDelete(shipping, token); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokenDelete: Expected [%v] received [%v]", ErrPermissionDenied, err)
+	}
+
+	if err := store.TokenDelete(billing, token); err != nil {
+		t.Fatalf("TokenDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+}
+
+func Test_Store_Policy_Acl(t *testing.T) {
+	evaluator, err := NewPolicyEvaluator(nil)
+	if err != nil {
+		t.Fatalf("NewPolicyEvaluator: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.PolicyEvaluator = evaluator
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	billing := WithPrincipal(context.Background(), "svc-billing")
+
+	token, err := store.TokenCreateWithOptions(billing, "card_number", "test_pass", 20, TokenCreateOptions{
+		Acl: []AclEntry{{Principal: "svc-report-*", Permissions: []string{PERMISSION_READ}}},
+	})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	report := WithPrincipal(context.Background(), "svc-report-daily")
+
+	if _, err := store.TokenRead(report, token, "test_pass"); err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenUpdate(report, token, "other", "test_pass"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokenUpdate: Expected [%v] received [%v]", ErrPermissionDenied, err)
+	}
+
+	if _, err := store.TokenCreateWithOptions(billing, "value", "test_pass", 20, TokenCreateOptions{
+		Acl: []AclEntry{{Principal: "[", Permissions: []string{PERMISSION_READ}}},
+	}); err == nil {
+		t.Fatal("TokenCreateWithOptions: Expected error for malformed ACL pattern")
+	}
+}
+
+func Test_Store_Policy_Patterns(t *testing.T) {
+	evaluator, err := NewPolicyEvaluator([]Policy{
+		{Principal: "svc-admin", Permissions: []string{PERMISSION_READ, PERMISSION_UPDATE, PERMISSION_DELETE}},
+		{Principal: "svc-audit-*", Owner: "svc-billing", Permissions: []string{PERMISSION_READ}},
+		{Principal: "svc-pay", Token: "tk_pay_*", Permissions: []string{PERMISSION_READ}},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicyEvaluator: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.PolicyEvaluator = evaluator
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	billing := WithPrincipal(context.Background(), "svc-billing")
+
+	token, err := store.TokenCreate(billing, "card_number", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenCreateCustom(billing, "tk_pay_1", "pay_value", "test_pass"); err != nil {
+		t.Fatalf("TokenCreateCustom: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	cases := []struct {
+		principal string
+		token     string
+		allowed   bool
+	}{
+		{"svc-admin", token, true},
+		{"svc-audit-eu", token, true},
+		{"svc-pay", token, false},
+		{"svc-pay", "tk_pay_1", true},
+		{"svc-other", "tk_pay_1", false},
+	}
+
+	for _, c := range cases {
+		_, err := store.TokenRead(WithPrincipal(context.Background(), c.principal), c.token, "test_pass")
+
+		if c.allowed && err != nil {
+			t.Fatalf("TokenRead: Expected [%v] to read [%v] received [%v]", c.principal, c.token, err)
+		}
+
+		if !c.allowed && !errors.Is(err, ErrPermissionDenied) {
+			t.Fatalf("TokenRead: Expected [%v] to be denied [%v] received [%v]", c.principal, c.token, err)
+		}
+	}
+
+	if _, err := NewPolicyEvaluator([]Policy{{Principal: "svc-[", Permissions: []string{PERMISSION_READ}}}); err == nil {
+		t.Fatal("NewPolicyEvaluator: Expected error for malformed pattern")
+	}
+}
+
+func Test_Store_Policy_Labels(t *testing.T) {
+	evaluator, err := NewPolicyEvaluator([]Policy{
+		{Principal: "svc-support", Labels: map[string]string{"kind": "contact_*"}, Permissions: []string{PERMISSION_READ}},
+		{Principal: "svc-eu", Labels: map[string]string{"kind": "*", "region": "eu"}, Permissions: []string{PERMISSION_READ}},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicyEvaluator: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.PolicyEvaluator = evaluator
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	billing := WithPrincipal(context.Background(), "svc-billing")
+
+	email, err := store.TokenCreateWithOptions(billing, "user@example.com", "test_pass", 20, TokenCreateOptions{
+		Metadata: map[string]string{"kind": "contact_email", "region": "eu"},
+	})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	card, err := store.TokenCreateWithOptions(billing, "4111111111111111", "test_pass", 20, TokenCreateOptions{
+		Metadata: map[string]string{"kind": "card"},
+	})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	cases := []struct {
+		principal string
+		token     string
+		allowed   bool
+	}{
+		{"svc-support", email, true},
+		{"svc-support", card, false},
+		{"svc-eu", email, true},
+		// a token missing a label never matches
+		{"svc-eu", card, false},
+	}
+
+	for _, c := range cases {
+		_, err := store.TokenRead(WithPrincipal(context.Background(), c.principal), c.token, "test_pass")
+
+		if c.allowed && err != nil {
+			t.Fatalf("TokenRead: Expected [%v] to read [%v] received [%v]", c.principal, c.token, err)
+		}
+
+		if !c.allowed && !errors.Is(err, ErrPermissionDenied) {
+			t.Fatalf("TokenRead: Expected [%v] to be denied [%v] received [%v]", c.principal, c.token, err)
+		}
+	}
+
+	if _, err := NewPolicyEvaluator([]Policy{{Principal: "svc-support", Labels: map[string]string{"kind": "contact_["}, Permissions: []string{PERMISSION_READ}}}); err == nil {
+		t.Fatal("NewPolicyEvaluator: Expected error for malformed label pattern")
+	}
+}
@@ -1,40 +1,388 @@
 package vaultstore
 
-import "github.com/gouniverse/sb"
+import (
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gouniverse/sb"
+	"github.com/samber/lo"
+)
 
 // SqlCreateTable returns a SQL string for creating the setting table
 func (store *Store) SqlCreateTable() string {
-	sql := sb.NewBuilder(sb.DatabaseDriverName(store.db)).
-		Table(store.vaultTableName).
-		Column(sb.Column{
+	return store.sqlCreateTable(store.vaultTableName, vaultTableColumns())
+}
+
+// vaultTableColumns returns the columns of the vault table
+func vaultTableColumns() []sb.Column {
+	return []sb.Column{
+		{
 			Name:       COLUMN_ID,
 			Type:       sb.COLUMN_TYPE_STRING,
 			Length:     40,
 			PrimaryKey: true,
-		}).
-		Column(sb.Column{
+		},
+		{
 			Name:   COLUMN_VAULT_TOKEN,
 			Type:   sb.COLUMN_TYPE_STRING,
 			Length: 40,
-			Unique: true,
-		}).
-		Column(sb.Column{
+		},
+		{
 			Name: COLUMN_VAULT_VALUE,
 			Type: sb.COLUMN_TYPE_LONGTEXT,
-		}).
-		Column(sb.Column{
+		},
+		{
 			Name: COLUMN_CREATED_AT,
 			Type: sb.COLUMN_TYPE_DATETIME,
-		}).
-		Column(sb.Column{
+		},
+		{
 			Name: COLUMN_UPDATED_AT,
 			Type: sb.COLUMN_TYPE_DATETIME,
-		}).
-		Column(sb.Column{
+		},
+		{
 			Name: COLUMN_SOFT_DELETED_AT,
 			Type: sb.COLUMN_TYPE_DATETIME,
-		}).
-		CreateIfNotExists()
+		},
+		{
+			Name: COLUMN_EXPIRES_AT,
+			Type: sb.COLUMN_TYPE_DATETIME,
+		},
+		{
+			Name: COLUMN_READS_REMAINING,
+			Type: sb.COLUMN_TYPE_INTEGER,
+		},
+		{
+			Name:   COLUMN_NAMESPACE,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 255,
+		},
+		{
+			Name:   COLUMN_OWNER,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 255,
+		},
+		{
+			Name: COLUMN_ACL,
+			Type: sb.COLUMN_TYPE_LONGTEXT,
+		},
+		{
+			Name: COLUMN_METADATA,
+			Type: sb.COLUMN_TYPE_LONGTEXT,
+		},
+		{
+			Name:   COLUMN_VALUE_HMAC,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 64,
+		},
+		{
+			Name:   COLUMN_BLIND_INDEX,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 64,
+		},
+		{
+			Name:   COLUMN_BLIND_INDEX_PREFIX,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 64,
+		},
+		{
+			Name:   COLUMN_BLIND_INDEX_SUFFIX,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 64,
+		},
+		{
+			Name: COLUMN_REVISION,
+			Type: sb.COLUMN_TYPE_INTEGER,
+		},
+	}
+}
+
+// SqlCreateAuditTable returns a SQL string for creating the audit table
+func (store *Store) SqlCreateAuditTable() string {
+	return store.sqlCreateTable(store.auditTableName, auditTableColumns())
+}
+
+// auditTableColumns returns the columns of the audit table
+func auditTableColumns() []sb.Column {
+	return []sb.Column{
+		{
+			Name:       COLUMN_ID,
+			Type:       sb.COLUMN_TYPE_STRING,
+			Length:     40,
+			PrimaryKey: true,
+		},
+		{
+			Name:   COLUMN_SEQUENCE,
+			Type:   sb.COLUMN_TYPE_INTEGER,
+			Unique: true,
+		},
+		{
+			Name:   COLUMN_ACTION,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 40,
+		},
+		{
+			Name:   COLUMN_VAULT_TOKEN,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 40,
+		},
+		{
+			Name:   COLUMN_NAMESPACE,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 255,
+		},
+		{
+			Name:   COLUMN_ACTOR,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 255,
+		},
+		{
+			Name:   COLUMN_PURPOSE,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 255,
+		},
+		{
+			Name:   COLUMN_OUTCOME,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 40,
+		},
+		{
+			Name: COLUMN_CREATED_AT,
+			Type: sb.COLUMN_TYPE_DATETIME,
+		},
+		{
+			Name:   COLUMN_PREV_HASH,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 64,
+		},
+		{
+			Name:   COLUMN_HASH,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 64,
+		},
+		{
+			Name:   COLUMN_HMAC,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 64,
+		},
+	}
+}
+
+// SqlCreateVersionTable returns a SQL string for creating the version
+// table, which keeps the version history of the vault values
+func (store *Store) SqlCreateVersionTable() string {
+	return store.sqlCreateTable(store.vaultVersionTableName, versionTableColumns())
+}
+
+// versionTableColumns returns the columns of the version table
+func versionTableColumns() []sb.Column {
+	return []sb.Column{
+		{
+			Name:       COLUMN_ID,
+			Type:       sb.COLUMN_TYPE_STRING,
+			Length:     40,
+			PrimaryKey: true,
+		},
+		{
+			Name:   COLUMN_RECORD_ID,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 40,
+		},
+		{
+			Name: COLUMN_VERSION,
+			Type: sb.COLUMN_TYPE_INTEGER,
+		},
+		{
+			Name: COLUMN_VAULT_VALUE,
+			Type: sb.COLUMN_TYPE_LONGTEXT,
+		},
+		{
+			Name:   COLUMN_BLIND_INDEX,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 64,
+		},
+		{
+			Name:   COLUMN_BLIND_INDEX_PREFIX,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 64,
+		},
+		{
+			Name:   COLUMN_BLIND_INDEX_SUFFIX,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 64,
+		},
+		{
+			Name: COLUMN_CREATED_AT,
+			Type: sb.COLUMN_TYPE_DATETIME,
+		},
+	}
+}
+
+// tableIndex is an index of a table created by AutoMigrate
+type tableIndex struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// vaultTableIndexes returns the indexes of the vault table, the unique
+// token per namespace, and the lookups on the keyed hashes of the values
+func vaultTableIndexes() []tableIndex {
+	return []tableIndex{
+		{
+			Name:    "token_namespace",
+			Columns: []string{COLUMN_VAULT_TOKEN, COLUMN_NAMESPACE},
+			Unique:  true,
+		},
+		{
+			Name:    COLUMN_VALUE_HMAC,
+			Columns: []string{COLUMN_VALUE_HMAC},
+		},
+		{
+			Name:    COLUMN_BLIND_INDEX,
+			Columns: []string{COLUMN_BLIND_INDEX},
+		},
+		{
+			Name:    COLUMN_BLIND_INDEX_PREFIX,
+			Columns: []string{COLUMN_BLIND_INDEX_PREFIX},
+		},
+		{
+			Name:    COLUMN_BLIND_INDEX_SUFFIX,
+			Columns: []string{COLUMN_BLIND_INDEX_SUFFIX},
+		},
+	}
+}
+
+// versionTableIndexes returns the indexes of the version table, the unique
+// version per record guards against concurrent updates saving the same version
+func versionTableIndexes() []tableIndex {
+	return []tableIndex{
+		{
+			Name:    "record_version",
+			Columns: []string{COLUMN_RECORD_ID, COLUMN_VERSION},
+			Unique:  true,
+		},
+	}
+}
+
+// sqlCreateTable returns a SQL string for creating the table, if it does not exist
+func (store *Store) sqlCreateTable(tableName string, columns []sb.Column) string {
+	builder := sb.NewBuilder(sb.DatabaseDriverName(store.db)).
+		Table(tableName)
+
+	for _, column := range columns {
+		builder = builder.Column(column)
+	}
+
+	return builder.CreateIfNotExists()
+}
+
+// sqlAddMissingColumns returns the SQL strings adding the columns missing
+// from an existing table, i.e. a table created by an earlier release
+//
+// The columns are added as nullable, so the existing rows are kept
+// with NULL values. A unique column is indexed after it is added.
+func (store *Store) sqlAddMissingColumns(tableName string, columns []sb.Column) ([]string, error) {
+	existing, err := store.tableColumnNames(tableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	builder := sb.NewBuilder(sb.DatabaseDriverName(store.db))
+	sqls := []string{}
+
+	for _, column := range columns {
+		if existing[strings.ToLower(column.Name)] {
+			continue
+		}
+
+		unique := column.Unique
+		column.Unique = false
+		column.Nullable = true
+
+		sql, err := builder.TableColumnAdd(tableName, column)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sqls = append(sqls, sql)
+
+		if unique {
+			sqls = append(sqls, "CREATE UNIQUE INDEX "+tableName+"_"+column.Name+"_unique ON "+tableName+" ("+column.Name+")")
+		}
+	}
+
+	return sqls, nil
+}
+
+// sqlCreateMissingIndexes returns the SQL strings creating the indexes of
+// a table, which was created or had some of the indexed columns added
+//
+// The indexes are created along with their columns, so AutoMigrate does
+// not need to look up the existing indexes, which differs per database.
+//
+// Parameters:
+// - tableName: The name of the table
+// - indexes: The indexes of the table
+// - existing: The lower case names of the columns before the migration, empty for a new table
+func (store *Store) sqlCreateMissingIndexes(tableName string, indexes []tableIndex, existing map[string]bool) []string {
+	builder := sb.NewBuilder(sb.DatabaseDriverName(store.db)).
+		Table(tableName)
+
+	sqls := []string{}
+
+	for _, index := range indexes {
+		missing := lo.ContainsBy(index.Columns, func(column string) bool {
+			return !existing[strings.ToLower(column)]
+		})
+
+		if !missing {
+			continue
+		}
+
+		sql := builder.CreateIndex(tableName+"_"+index.Name+"_idx", index.Columns...)
+
+		if index.Unique {
+			sql = "CREATE UNIQUE INDEX" + strings.TrimPrefix(sql, "CREATE INDEX")
+		}
+
+		sqls = append(sqls, sql)
+	}
+
+	return sqls
+}
+
+// tableColumnNames returns the lower case names of the columns of the table
+func (store *Store) tableColumnNames(tableName string) (map[string]bool, error) {
+	sqlStr, _, err := goqu.Dialect(store.dbDriverName).
+		From(tableName).
+		Where(goqu.L("1 = 0")).
+		ToSQL()
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := store.db.Query(sqlStr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	names, err := rows.Columns()
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]bool{}
+
+	for _, name := range names {
+		columns[strings.ToLower(name)] = true
+	}
 
-	return sql
+	return columns, rows.Err()
 }
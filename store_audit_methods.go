@@ -0,0 +1,206 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gouniverse/base/database"
+	"github.com/samber/lo"
+)
+
+// AuditCount counts the audit entries matching the query
+func (store *Store) AuditCount(ctx context.Context, query AuditQueryInterface) (int64, error) {
+	query = store.auditNamespaceQuery(ctx, query).SetCountOnly(true)
+	dataset, _, err := query.toSelectDataset(store)
+
+	if err != nil {
+		return -1, err
+	}
+
+	sqlStr, sqlParams, errSql := dataset.Limit(1).
+		Select(goqu.COUNT(goqu.Star()).As("count")).
+		Prepared(true).
+		ToSQL()
+
+	if errSql != nil {
+		return -1, errSql
+	}
+
+	if store.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	mapped, err := database.SelectToMapString(store.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return -1, err
+	}
+
+	if len(mapped) < 1 {
+		return -1, errors.New("count query returned no rows")
+	}
+
+	return strconv.ParseInt(mapped[0]["count"], 10, 64)
+}
+
+// AuditList lists the audit entries matching the query
+func (store *Store) AuditList(ctx context.Context, query AuditQueryInterface) ([]AuditEntryInterface, error) {
+	dataset, columns, err := store.auditNamespaceQuery(ctx, query).toSelectDataset(store)
+
+	if err != nil {
+		return []AuditEntryInterface{}, err
+	}
+
+	sqlStr, sqlParams, errSql := dataset.Select(columns...).Prepared(true).ToSQL()
+
+	if errSql != nil {
+		return []AuditEntryInterface{}, errSql
+	}
+
+	if store.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	modelMaps, err := database.SelectToMapString(store.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return []AuditEntryInterface{}, err
+	}
+
+	list := lo.Map(modelMaps, func(modelMap map[string]string, _ int) AuditEntryInterface {
+		return NewAuditEntryFromExistingData(modelMap)
+	})
+
+	return list, nil
+}
+
+// auditLog records a call of a token method in the audit log,
+// one entry per token, the values are never recorded
+//
+// Business logic:
+//  1. Nothing is recorded if the audit log is disabled
+//  2. The actor, purpose and namespace are taken from the context
+//  3. The outcome is derived from the error returned by the call
+//  4. The entries are appended to the hash chain, see VerifyAuditChain
+//  5. If the call succeeded, but the entry cannot be recorded, the audit
+//     error is returned, so a secret is never disclosed unaudited,
+//     if the call failed, the audit error goes to the AuditErrorHandler
+//  6. Inside WithTx, the entries of failed calls and of reads are written
+//     again once the transaction (or savepoint) is rolled back, so they
+//     are kept, as the values were disclosed regardless of the rollback
+//
+// Returns:
+// - err: The error of the call, or the audit error
+func (st *Store) auditLog(ctx context.Context, action string, tokens []string, callErr error) error {
+	tokens = lo.Compact(tokens)
+
+	if !st.auditEnabled || len(tokens) == 0 {
+		return callErr
+	}
+
+	var missing *MissingTokensError
+	errors.As(callErr, &missing)
+
+	// the principal checked by the policy evaluator is the default actor
+	actor := AuditActorFromContext(ctx)
+
+	if actor == "" {
+		actor = PrincipalFromContext(ctx)
+	}
+
+	namespace, _ := st.namespaceFromContext(ctx)
+
+	entries := []AuditEntryInterface{}
+
+	for _, token := range tokens {
+		outcome := auditOutcome(callErr)
+
+		// TokensRead fails as a whole, only the missing tokens were not found
+		if missing != nil && !lo.Contains(missing.Tokens, token) {
+			outcome = AUDIT_OUTCOME_ERROR
+		}
+
+		entry := NewAuditEntry().
+			SetAction(action).
+			SetToken(token).
+			SetNamespace(namespace).
+			SetActor(actor).
+			SetPurpose(AuditPurposeFromContext(ctx)).
+			SetOutcome(outcome)
+
+		entries = append(entries, entry)
+	}
+
+	err := st.auditAppend(ctx, entries)
+
+	if (callErr != nil || auditKeptOnRollback(action)) && st.txAuditKept != nil {
+		*st.txAuditKept = append(*st.txAuditKept, entries...)
+	}
+
+	if err != nil && callErr == nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+
+	if err != nil {
+		st.auditError(fmt.Errorf("audit log: %w", err))
+	}
+
+	return callErr
+}
+
+// auditRewrite writes again the entries of failed calls and reads, which
+// were rolled back with the transaction or savepoint they were written in
+func (st *Store) auditRewrite(ctx context.Context, entries []AuditEntryInterface) {
+	if len(entries) == 0 {
+		return
+	}
+
+	if err := st.auditAppend(ctx, entries); err != nil {
+		st.auditError(fmt.Errorf("audit log: %w", err))
+	}
+}
+
+// auditError reports an audit error which cannot be returned to the
+// caller, to the AuditErrorHandler, or to the log in debug mode
+func (st *Store) auditError(err error) {
+	if st.auditErrorHandler != nil {
+		st.auditErrorHandler(err)
+		return
+	}
+
+	if st.debugEnabled {
+		log.Println(err)
+	}
+}
+
+// auditKeptOnRollback returns true for the actions disclosing a value or
+// token, audited even when the transaction they ran in is rolled back
+func auditKeptOnRollback(action string) bool {
+	return lo.Contains([]string{
+		AUDIT_ACTION_TOKEN_READ,
+		AUDIT_ACTION_TOKEN_READ_VERSION,
+		AUDIT_ACTION_TOKEN_FIND_BY_VALUE,
+	}, action)
+}
+
+// auditOutcome derives the audit outcome from the error returned by a call
+func auditOutcome(err error) string {
+	switch {
+	case err == nil:
+		return AUDIT_OUTCOME_SUCCESS
+	case errors.Is(err, ErrPermissionDenied):
+		return AUDIT_OUTCOME_PERMISSION_DENIED
+	case errors.Is(err, ErrInvalidPassword):
+		return AUDIT_OUTCOME_INVALID_PASSWORD
+	case errors.Is(err, ErrValueIntegrity):
+		return AUDIT_OUTCOME_INTEGRITY_FAILURE
+	case errors.Is(err, ErrTokenNotFound), errors.Is(err, ErrRecordNotFound), errors.Is(err, ErrVersionNotFound):
+		return AUDIT_OUTCOME_NOT_FOUND
+	default:
+		return AUDIT_OUTCOME_ERROR
+	}
+}
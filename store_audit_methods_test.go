@@ -0,0 +1,298 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func Test_Store_Audit_TokenMethods(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.AuditEnabled = true
+		options.AuditHmacKey = testKey(7)
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := WithAuditPurpose(WithAuditActor(context.Background(), "alice"), "TICKET-1")
+
+	token, err := store.TokenCreate(ctx, "secret_value", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokenRead(ctx, token, "test_pass"); err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokenRead(ctx, token, "wrong_pass"); err == nil {
+		t.Fatal("TokenRead: Expected error for wrong password")
+	}
+
+	if err := store.TokenUpdate(ctx, token, "new_value", "test_pass"); err != nil {
+		t.Fatalf("TokenUpdate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokensRead(ctx, []string{token, "tk_missing"}, "test_pass"); err == nil {
+		t.Fatal("TokensRead: Expected error for missing token")
+	}
+
+	if err := store.TokenSoftDelete(ctx, token); err != nil {
+		t.Fatalf("TokenSoftDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenDelete(ctx, token); err != nil {
+		t.Fatalf("TokenDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	entries, err := store.AuditList(ctx, AuditQuery().SetToken(token).SetOrderBy(COLUMN_CREATED_AT).SetSortOrder("asc"))
+	if err != nil {
+		t.Fatalf("AuditList: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(entries) != 7 {
+		t.Fatalf("AuditList: Expected [7] entries received [%v]", len(entries))
+	}
+
+	for _, entry := range entries {
+		if entry.GetActor() != "alice" || entry.GetPurpose() != "TICKET-1" {
+			t.Fatalf("AuditList: Expected actor and purpose from the context received [%v] [%v]", entry.GetActor(), entry.GetPurpose())
+		}
+
+		for _, value := range entry.Data() {
+			if strings.Contains(value, "secret_value") || strings.Contains(value, "new_value") {
+				t.Fatal("AuditList: Expected the value never to be recorded")
+			}
+		}
+	}
+
+	invalidPassword, err := store.AuditCount(ctx, AuditQuery().
+		SetAction(AUDIT_ACTION_TOKEN_READ).
+		SetOutcome(AUDIT_OUTCOME_INVALID_PASSWORD))
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if invalidPassword != 1 {
+		t.Fatalf("AuditCount: Expected [1] invalid password entry received [%v]", invalidPassword)
+	}
+
+	notFound, err := store.AuditList(ctx, AuditQuery().SetOutcome(AUDIT_OUTCOME_NOT_FOUND))
+	if err != nil {
+		t.Fatalf("AuditList: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(notFound) != 1 || notFound[0].GetToken() != "tk_missing" {
+		t.Fatalf("AuditList: Expected the missing token to be not found received [%v]", len(notFound))
+	}
+
+	actions, err := store.AuditCount(ctx, AuditQuery().
+		SetActor("alice").
+		SetActionIn([]string{AUDIT_ACTION_TOKEN_CREATE, AUDIT_ACTION_TOKEN_DELETE, AUDIT_ACTION_TOKEN_SOFT_DELETE}))
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if actions != 3 {
+		t.Fatalf("AuditCount: Expected [3] entries received [%v]", actions)
+	}
+}
+
+func Test_Store_Audit_Disabled(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_Audit_Disabled: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokenCreate(context.Background(), "value", "test_pass", 20); err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// the audit table is not created when the audit log is disabled
+	if _, err := store.AuditCount(context.Background(), AuditQuery()); err == nil {
+		t.Fatal("AuditCount: Expected error as the audit table does not exist")
+	}
+}
+
+func Test_AuditQuery_Validate(t *testing.T) {
+	if err := AuditQuery().SetActor("").Validate(); err == nil {
+		t.Fatal("Validate: Expected error for empty actor")
+	}
+
+	if err := AuditQuery().SetLimit(-1).Validate(); err == nil {
+		t.Fatal("Validate: Expected error for negative limit")
+	}
+
+	if err := AuditQuery().SetActor("alice").SetLimit(10).Validate(); err != nil {
+		t.Fatalf("Validate: Expected [err] to be nil received [%v]", err.Error())
+	}
+}
+
+func Test_Store_Audit_TokensBatch(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.AuditEnabled = true
+		options.AuditHmacKey = testKey(7)
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	// more audit entries than fit in one statement with the sqlite parameter limit
+	values := []string{}
+	for i := 0; i < 200; i++ {
+		values = append(values, "value_"+strconv.Itoa(i))
+	}
+
+	tokens, err := store.TokensCreate(ctx, values, "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokensCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokensRead(ctx, tokens, "test_pass"); err != nil {
+		t.Fatalf("TokensRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokensSoftDelete(ctx, tokens); err != nil {
+		t.Fatalf("TokensSoftDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	count, err := store.AuditCount(ctx, AuditQuery())
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 600 {
+		t.Fatalf("AuditCount: Expected [600] entries received [%v]", count)
+	}
+
+	if _, err := store.VerifyAuditChain(ctx); err != nil {
+		t.Fatalf("VerifyAuditChain: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// the audit entries are written in the transaction of the batch,
+	// the records are not created when the audit log fails
+	if _, err := store.(*Store).db.Exec("DROP TABLE " + store.GetAuditTableName()); err != nil {
+		t.Fatalf("DROP TABLE: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	tokens, err = store.TokensCreate(ctx, values[:2], "test_pass", 20)
+	if err == nil {
+		t.Fatal("TokensCreate: Expected error as the audit log failed")
+	}
+	if len(tokens) != 0 {
+		t.Fatalf("TokensCreate: Expected no tokens received [%v]", len(tokens))
+	}
+
+	records, err := store.RecordCount(ctx, RecordQuery())
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if records != 0 {
+		t.Fatalf("RecordCount: Expected [0] received [%v]", records)
+	}
+}
+
+func Test_Store_Audit_WithTxRollback(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.AuditEnabled = true
+		options.AuditHmacKey = testKey(7)
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "secret_value", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// the failed read is kept, the rolled back update is not
+	err = store.WithTx(ctx, func(tx StoreInterface) error {
+		if err := tx.TokenUpdate(ctx, token, "new_value", "test_pass"); err != nil {
+			return err
+		}
+
+		_, err := tx.TokenRead(ctx, token, "wrong_pass")
+		return err
+	})
+	if !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("WithTx: Expected [%v] received [%v]", ErrInvalidPassword, err)
+	}
+
+	// the failed read in the rolled back savepoint is written once,
+	// in the transaction which commits
+	err = store.WithTx(ctx, func(tx StoreInterface) error {
+		err := tx.WithTx(ctx, func(inner StoreInterface) error {
+			_, err := inner.TokenRead(ctx, token, "wrong_pass")
+			return err
+		})
+		if !errors.Is(err, ErrInvalidPassword) {
+			t.Fatalf("WithTx: Expected [%v] received [%v]", ErrInvalidPassword, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	invalidPassword, err := store.AuditCount(ctx, AuditQuery().SetOutcome(AUDIT_OUTCOME_INVALID_PASSWORD))
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if invalidPassword != 2 {
+		t.Fatalf("AuditCount: Expected [2] invalid password entries received [%v]", invalidPassword)
+	}
+
+	updates, err := store.AuditCount(ctx, AuditQuery().SetAction(AUDIT_ACTION_TOKEN_UPDATE))
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if updates != 0 {
+		t.Fatalf("AuditCount: Expected [0] update entries received [%v]", updates)
+	}
+
+	if _, err := store.VerifyAuditChain(ctx); err != nil {
+		t.Fatalf("VerifyAuditChain: Expected [err] to be nil received [%v]", err.Error())
+	}
+}
+
+func Test_Store_Audit_ErrorHandler(t *testing.T) {
+	auditErrors := []error{}
+
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.AuditEnabled = true
+		options.AuditHmacKey = testKey(7)
+		options.AuditErrorHandler = func(err error) {
+			auditErrors = append(auditErrors, err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "secret_value", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.(*Store).db.Exec("DROP TABLE " + store.GetAuditTableName()); err != nil {
+		t.Fatalf("DROP TABLE: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// the failed call returns its own error, the audit error goes to the handler
+	if _, err := store.TokenRead(ctx, token, "wrong_pass"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("TokenRead: Expected [%v] received [%v]", ErrInvalidPassword, err)
+	}
+
+	if len(auditErrors) != 1 {
+		t.Fatalf("AuditErrorHandler: Expected [1] error received [%v]", len(auditErrors))
+	}
+	if !strings.HasPrefix(auditErrors[0].Error(), "audit log:") {
+		t.Fatalf("AuditErrorHandler: Expected an audit log error received [%v]", auditErrors[0])
+	}
+}
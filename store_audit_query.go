@@ -0,0 +1,429 @@
+package vaultstore
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gouniverse/sb"
+)
+
+// ============================================================================//
+// CONSTRUCTOR
+// ============================================================================//
+
+// AuditQuery creates a new audit entry query
+func AuditQuery() AuditQueryInterface {
+	return &auditQueryImpl{
+		properties: make(map[string]interface{}),
+	}
+}
+
+// ============================================================================//
+// TYPE auditQueryImpl
+// ============================================================================//
+
+// auditQueryImpl implements the AuditQueryInterface
+type auditQueryImpl struct {
+	properties map[string]interface{}
+}
+
+// verify it extends the interface
+var _ AuditQueryInterface = (*auditQueryImpl)(nil)
+
+// Validate validates the audit query
+func (q *auditQueryImpl) Validate() error {
+	if q.properties == nil {
+		return errors.New("properties cannot be nil")
+	}
+
+	if q.IsIDSet() && q.GetID() == "" {
+		return errors.New("id cannot be empty")
+	}
+	if q.IsActionSet() && q.GetAction() == "" {
+		return errors.New("action cannot be empty")
+	}
+	if q.IsActionInSet() && len(q.GetActionIn()) == 0 {
+		return errors.New("actionIn cannot be empty")
+	}
+	if q.IsActorSet() && q.GetActor() == "" {
+		return errors.New("actor cannot be empty")
+	}
+	if q.IsOutcomeSet() && q.GetOutcome() == "" {
+		return errors.New("outcome cannot be empty")
+	}
+	if q.IsTokenSet() && q.GetToken() == "" {
+		return errors.New("token cannot be empty")
+	}
+	if q.IsCreatedAtGteSet() && q.GetCreatedAtGte() == "" {
+		return errors.New("createdAtGte cannot be empty")
+	}
+	if q.IsCreatedAtLteSet() && q.GetCreatedAtLte() == "" {
+		return errors.New("createdAtLte cannot be empty")
+	}
+	if q.IsLimitSet() && q.GetLimit() < 0 {
+		return errors.New("limit cannot be negative")
+	}
+	if q.IsOffsetSet() && q.GetOffset() < 0 {
+		return errors.New("offset cannot be negative")
+	}
+	if q.IsSortOrderSet() && !strings.EqualFold(q.GetSortOrder(), sb.ASC) && !strings.EqualFold(q.GetSortOrder(), sb.DESC) {
+		return errors.New("sortOrder must be 'asc' or 'desc'")
+	}
+
+	if q.IsCountOnlySet() && (q.IsLimitSet() || q.IsOffsetSet()) {
+		return errors.New("countOnly cannot be used with limit or offset")
+	}
+	return nil
+}
+
+func (aq *auditQueryImpl) toSelectDataset(store StoreInterface) (selectDataset *goqu.SelectDataset, selectColumns []any, err error) {
+	if store == nil {
+		return nil, []any{}, errors.New("store is nil")
+	}
+
+	if err := aq.Validate(); err != nil {
+		return nil, []any{}, err
+	}
+
+	q := goqu.Dialect(store.GetDbDriverName()).From(store.GetAuditTableName())
+
+	// Entries are always filtered by namespace, like the records
+	if !aq.GetNamespaceAll() {
+		namespace := store.GetNamespace()
+
+		if aq.IsNamespaceSet() {
+			namespace = aq.GetNamespace()
+		}
+
+		q = q.Where(namespaceCondition(namespace))
+	}
+
+	if aq.IsIDSet() {
+		q = q.Where(goqu.C(COLUMN_ID).Eq(aq.GetID()))
+	}
+
+	if aq.IsActionSet() {
+		q = q.Where(goqu.C(COLUMN_ACTION).Eq(aq.GetAction()))
+	}
+
+	if aq.IsActionInSet() {
+		q = q.Where(goqu.C(COLUMN_ACTION).In(aq.GetActionIn()))
+	}
+
+	if aq.IsActorSet() {
+		q = q.Where(goqu.C(COLUMN_ACTOR).Eq(aq.GetActor()))
+	}
+
+	if aq.IsOutcomeSet() {
+		q = q.Where(goqu.C(COLUMN_OUTCOME).Eq(aq.GetOutcome()))
+	}
+
+	if aq.IsTokenSet() {
+		q = q.Where(goqu.C(COLUMN_VAULT_TOKEN).Eq(aq.GetToken()))
+	}
+
+	if aq.IsCreatedAtGteSet() {
+		q = q.Where(goqu.C(COLUMN_CREATED_AT).Gte(aq.GetCreatedAtGte()))
+	}
+
+	if aq.IsCreatedAtLteSet() {
+		q = q.Where(goqu.C(COLUMN_CREATED_AT).Lte(aq.GetCreatedAtLte()))
+	}
+
+	if !aq.IsCountOnlySet() {
+		if aq.IsLimitSet() && aq.GetLimit() > 0 {
+			q = q.Limit(uint(aq.GetLimit()))
+		}
+
+		if aq.IsOffsetSet() && aq.GetOffset() > 0 {
+			q = q.Offset(uint(aq.GetOffset()))
+		}
+	}
+
+	sortOrder := sb.DESC
+	if aq.IsSortOrderSet() && aq.GetSortOrder() != "" {
+		sortOrder = aq.GetSortOrder()
+	}
+
+	if aq.IsOrderBySet() && aq.GetOrderBy() != "" {
+		if strings.EqualFold(sortOrder, sb.ASC) {
+			q = q.Order(goqu.I(aq.GetOrderBy()).Asc())
+		} else {
+			q = q.Order(goqu.I(aq.GetOrderBy()).Desc())
+		}
+	}
+
+	columns := []any{}
+
+	for _, column := range aq.GetColumns() {
+		columns = append(columns, column)
+	}
+
+	return q, columns, nil
+}
+
+func (q *auditQueryImpl) IsColumnsSet() bool {
+	return q.hasProperty("columns")
+}
+
+func (q *auditQueryImpl) GetColumns() []string {
+	if q.IsColumnsSet() {
+		return q.properties["columns"].([]string)
+	}
+	return []string{}
+}
+
+func (q *auditQueryImpl) SetColumns(columns []string) AuditQueryInterface {
+	q.properties["columns"] = columns
+	return q
+}
+
+func (q *auditQueryImpl) IsIDSet() bool {
+	return q.hasProperty("id")
+}
+
+func (q *auditQueryImpl) GetID() string {
+	if q.IsIDSet() {
+		return q.properties["id"].(string)
+	}
+	return ""
+}
+
+func (q *auditQueryImpl) SetID(id string) AuditQueryInterface {
+	q.properties["id"] = id
+	return q
+}
+
+func (q *auditQueryImpl) IsActionSet() bool {
+	return q.hasProperty("action")
+}
+
+func (q *auditQueryImpl) GetAction() string {
+	if q.IsActionSet() {
+		return q.properties["action"].(string)
+	}
+	return ""
+}
+
+func (q *auditQueryImpl) SetAction(action string) AuditQueryInterface {
+	q.properties["action"] = action
+	return q
+}
+
+func (q *auditQueryImpl) IsActionInSet() bool {
+	return q.hasProperty("actionIn")
+}
+
+func (q *auditQueryImpl) GetActionIn() []string {
+	if q.IsActionInSet() {
+		return q.properties["actionIn"].([]string)
+	}
+	return []string{}
+}
+
+func (q *auditQueryImpl) SetActionIn(actionIn []string) AuditQueryInterface {
+	q.properties["actionIn"] = actionIn
+	return q
+}
+
+func (q *auditQueryImpl) IsActorSet() bool {
+	return q.hasProperty("actor")
+}
+
+func (q *auditQueryImpl) GetActor() string {
+	if q.IsActorSet() {
+		return q.properties["actor"].(string)
+	}
+	return ""
+}
+
+func (q *auditQueryImpl) SetActor(actor string) AuditQueryInterface {
+	q.properties["actor"] = actor
+	return q
+}
+
+func (q *auditQueryImpl) IsOutcomeSet() bool {
+	return q.hasProperty("outcome")
+}
+
+func (q *auditQueryImpl) GetOutcome() string {
+	if q.IsOutcomeSet() {
+		return q.properties["outcome"].(string)
+	}
+	return ""
+}
+
+func (q *auditQueryImpl) SetOutcome(outcome string) AuditQueryInterface {
+	q.properties["outcome"] = outcome
+	return q
+}
+
+func (q *auditQueryImpl) IsTokenSet() bool {
+	return q.hasProperty("token")
+}
+
+func (q *auditQueryImpl) GetToken() string {
+	if q.IsTokenSet() {
+		return q.properties["token"].(string)
+	}
+	return ""
+}
+
+func (q *auditQueryImpl) SetToken(token string) AuditQueryInterface {
+	q.properties["token"] = token
+	return q
+}
+
+func (q *auditQueryImpl) IsCreatedAtGteSet() bool {
+	return q.hasProperty("createdAtGte")
+}
+
+func (q *auditQueryImpl) GetCreatedAtGte() string {
+	if q.IsCreatedAtGteSet() {
+		return q.properties["createdAtGte"].(string)
+	}
+	return ""
+}
+
+func (q *auditQueryImpl) SetCreatedAtGte(createdAtGte string) AuditQueryInterface {
+	q.properties["createdAtGte"] = createdAtGte
+	return q
+}
+
+func (q *auditQueryImpl) IsCreatedAtLteSet() bool {
+	return q.hasProperty("createdAtLte")
+}
+
+func (q *auditQueryImpl) GetCreatedAtLte() string {
+	if q.IsCreatedAtLteSet() {
+		return q.properties["createdAtLte"].(string)
+	}
+	return ""
+}
+
+func (q *auditQueryImpl) SetCreatedAtLte(createdAtLte string) AuditQueryInterface {
+	q.properties["createdAtLte"] = createdAtLte
+	return q
+}
+
+func (q *auditQueryImpl) IsOffsetSet() bool {
+	return q.hasProperty("offset")
+}
+
+func (q *auditQueryImpl) GetOffset() int {
+	if q.IsOffsetSet() {
+		return q.properties["offset"].(int)
+	}
+	return 0
+}
+
+func (q *auditQueryImpl) SetOffset(offset int) AuditQueryInterface {
+	q.properties["offset"] = offset
+	return q
+}
+
+func (q *auditQueryImpl) IsOrderBySet() bool {
+	return q.hasProperty("orderBy")
+}
+
+func (q *auditQueryImpl) GetOrderBy() string {
+	if q.IsOrderBySet() {
+		return q.properties["orderBy"].(string)
+	}
+	return ""
+}
+
+func (q *auditQueryImpl) SetOrderBy(orderBy string) AuditQueryInterface {
+	q.properties["orderBy"] = orderBy
+	return q
+}
+
+func (q *auditQueryImpl) IsCountOnlySet() bool {
+	return q.hasProperty("countOnly")
+}
+
+func (q *auditQueryImpl) GetCountOnly() bool {
+	if q.IsCountOnlySet() {
+		return q.properties["countOnly"].(bool)
+	}
+	return false
+}
+
+func (q *auditQueryImpl) SetCountOnly(countOnly bool) AuditQueryInterface {
+	q.properties["countOnly"] = countOnly
+	return q
+}
+
+func (q *auditQueryImpl) IsSortOrderSet() bool {
+	return q.hasProperty("sortOrder")
+}
+
+func (q *auditQueryImpl) GetSortOrder() string {
+	if q.IsSortOrderSet() {
+		return q.properties["sortOrder"].(string)
+	}
+	return ""
+}
+
+func (q *auditQueryImpl) SetSortOrder(sortOrder string) AuditQueryInterface {
+	q.properties["sortOrder"] = sortOrder
+	return q
+}
+
+func (q *auditQueryImpl) IsLimitSet() bool {
+	return q.hasProperty("limit")
+}
+
+func (q *auditQueryImpl) GetLimit() int {
+	if q.IsLimitSet() {
+		return q.properties["limit"].(int)
+	}
+	return 0
+}
+
+func (q *auditQueryImpl) SetLimit(limit int) AuditQueryInterface {
+	q.properties["limit"] = limit
+	return q
+}
+
+func (q *auditQueryImpl) IsNamespaceSet() bool {
+	return q.hasProperty("namespace")
+}
+
+func (q *auditQueryImpl) GetNamespace() string {
+	if q.IsNamespaceSet() {
+		return q.properties["namespace"].(string)
+	}
+	return ""
+}
+
+// SetNamespace filters the entries by namespace, on a scoped store, or
+// with a namespace in the context, it is replaced by the scope namespace
+func (q *auditQueryImpl) SetNamespace(namespace string) AuditQueryInterface {
+	q.properties["namespace"] = namespace
+	return q
+}
+
+func (q *auditQueryImpl) IsNamespaceAllSet() bool {
+	return q.hasProperty("namespaceAll")
+}
+
+func (q *auditQueryImpl) GetNamespaceAll() bool {
+	if q.IsNamespaceAllSet() {
+		return q.properties["namespaceAll"].(bool)
+	}
+	return false
+}
+
+// SetNamespaceAll returns the entries of all namespaces,
+// ignored on a scoped store, or with a namespace in the context
+func (q *auditQueryImpl) SetNamespaceAll(namespaceAll bool) AuditQueryInterface {
+	q.properties["namespaceAll"] = namespaceAll
+	return q
+}
+
+func (q *auditQueryImpl) hasProperty(key string) bool {
+	_, ok := q.properties[key]
+	return ok
+}
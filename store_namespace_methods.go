@@ -0,0 +1,226 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gouniverse/base/database"
+)
+
+type namespaceContextKey string
+
+const namespaceKey namespaceContextKey = "vaultstore_namespace"
+
+// WithNamespace returns a copy of the context scoping the store calls
+// to the namespace, unless the store itself is scoped with Namespace
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceKey, namespace)
+}
+
+// NamespaceFromContext returns the namespace carried by the context,
+// and whether the context carries one
+func NamespaceFromContext(ctx context.Context) (namespace string, ok bool) {
+	namespace, ok = ctx.Value(namespaceKey).(string)
+	return namespace, ok
+}
+
+// Namespace returns a copy of the store scoped to the namespace
+//
+// All the records created by the scoped store are created in the
+// namespace, and all the records read, updated or deleted are
+// restricted to the namespace, regardless of the context.
+//
+// Parameters:
+// - namespace: The namespace, empty for the default namespace
+//
+// Returns:
+// - store: The scoped store
+func (st *Store) Namespace(namespace string) StoreInterface {
+	scoped := *st
+	scoped.namespace = namespace
+	scoped.namespaceScoped = true
+	return &scoped
+}
+
+// GetNamespace returns the namespace the store is scoped to,
+// or the default namespace (empty) if it is not scoped
+func (st *Store) GetNamespace() string {
+	return st.namespace
+}
+
+// NamespaceCounts counts the records per namespace, including
+// soft deleted and expired records
+//
+// A scoped store only counts the records in its namespace.
+//
+// Parameters:
+// - ctx: The context
+//
+// Returns:
+// - counts: The number of records by namespace, the default namespace is ""
+// - err: An error if something went wrong
+func (st *Store) NamespaceCounts(ctx context.Context) (counts map[string]int64, err error) {
+	q := goqu.Dialect(st.dbDriverName).
+		From(st.vaultTableName).
+		Prepared(true).
+		Select(goqu.C(COLUMN_NAMESPACE), goqu.COUNT(goqu.Star()).As("count")).
+		GroupBy(goqu.C(COLUMN_NAMESPACE))
+
+	if namespace, scoped := st.namespaceFromContext(ctx); scoped {
+		q = q.Where(namespaceCondition(namespace))
+	}
+
+	sqlStr, sqlParams, err := q.ToSQL()
+
+	if err != nil {
+		return map[string]int64{}, err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return map[string]int64{}, err
+	}
+
+	counts = map[string]int64{}
+
+	for _, row := range rows {
+		count, err := strconv.ParseInt(row["count"], 10, 64)
+
+		if err != nil {
+			return map[string]int64{}, err
+		}
+
+		// records without a namespace (NULL) are in the default namespace
+		counts[row[COLUMN_NAMESPACE]] += count
+	}
+
+	return counts, nil
+}
+
+// NamespacePurge hard deletes all the records of a namespace,
+// together with their version history, in one transaction
+//
+// # A scoped store can only purge its own namespace
+//
+// Parameters:
+// - ctx: The context
+// - namespace: The namespace to purge, empty for the default namespace
+//
+// Returns:
+// - purged: The number of records deleted
+// - err: An error if something went wrong
+func (st *Store) NamespacePurge(ctx context.Context, namespace string) (purged int64, err error) {
+	if scopedNamespace, scoped := st.namespaceFromContext(ctx); scoped && scopedNamespace != namespace {
+		return 0, errors.New("namespace is outside of the store scope: " + namespace)
+	}
+
+	recordIDs := goqu.Dialect(st.dbDriverName).
+		From(st.vaultTableName).
+		Select(COLUMN_ID).
+		Where(namespaceCondition(namespace))
+
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		Delete(st.vaultTableName).
+		Prepared(true).
+		Where(namespaceCondition(namespace)).
+		ToSQL()
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = st.runInTransaction(ctx, func(txCtx context.Context) error {
+		if err := st.versionsDelete(txCtx, goqu.C(COLUMN_RECORD_ID).In(recordIDs)); err != nil {
+			return err
+		}
+
+		if st.debugEnabled {
+			log.Println(sqlStr)
+		}
+
+		result, err := database.Execute(st.toQuerableContext(txCtx), sqlStr, sqlParams...)
+
+		if err != nil {
+			return err
+		}
+
+		purged, err = result.RowsAffected()
+
+		return err
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// namespaceFromContext returns the namespace the call is scoped to,
+// the store scope takes precedence over the context
+func (st *Store) namespaceFromContext(ctx context.Context) (namespace string, scoped bool) {
+	if st.namespaceScoped {
+		return st.namespace, true
+	}
+
+	return NamespaceFromContext(ctx)
+}
+
+// namespaceQuery scopes the query to the namespace of the call, when
+// scoped, any namespace set on the query is replaced
+func (st *Store) namespaceQuery(ctx context.Context, query RecordQueryInterface) RecordQueryInterface {
+	if namespace, scoped := st.namespaceFromContext(ctx); scoped {
+		return query.SetNamespaceAll(false).SetNamespace(namespace)
+	}
+
+	return query
+}
+
+// auditNamespaceQuery scopes the audit query to the namespace of the call,
+// when scoped, any namespace set on the query is replaced
+func (st *Store) auditNamespaceQuery(ctx context.Context, query AuditQueryInterface) AuditQueryInterface {
+	if namespace, scoped := st.namespaceFromContext(ctx); scoped {
+		return query.SetNamespaceAll(false).SetNamespace(namespace)
+	}
+
+	return query
+}
+
+// namespaceWhere returns the namespace condition for statements
+// targeting a record by ID or token, nil if the call is not scoped
+func (st *Store) namespaceWhere(ctx context.Context) goqu.Expression {
+	if namespace, scoped := st.namespaceFromContext(ctx); scoped {
+		return namespaceCondition(namespace)
+	}
+
+	return nil
+}
+
+// tokenNamespaceWhere returns the namespace condition for statements
+// targeting records by token, the default namespace if the call is not
+// scoped, as a token is unique within its namespace only
+func (st *Store) tokenNamespaceWhere(ctx context.Context) goqu.Expression {
+	namespace, _ := st.namespaceFromContext(ctx)
+	return namespaceCondition(namespace)
+}
+
+// namespaceCondition matches the records of the namespace, the records
+// without a namespace (NULL) are in the default namespace
+func namespaceCondition(namespace string) goqu.Expression {
+	if namespace == "" {
+		return goqu.Or(
+			goqu.C(COLUMN_NAMESPACE).IsNull(),
+			goqu.C(COLUMN_NAMESPACE).Eq(""),
+		)
+	}
+
+	return goqu.C(COLUMN_NAMESPACE).Eq(namespace)
+}
@@ -0,0 +1,372 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func Test_Store_Namespace_Isolation(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	acme := store.Namespace("acme")
+	globex := store.Namespace("globex")
+
+	if acme.GetNamespace() != "acme" {
+		t.Fatalf("GetNamespace: Expected [acme] received [%v]", acme.GetNamespace())
+	}
+
+	token, err := acme.TokenCreate(ctx, "acme_secret", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	value, err := acme.TokenRead(ctx, token, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "acme_secret" {
+		t.Fatalf("TokenRead: Expected [acme_secret] received [%v]", value)
+	}
+
+	if _, err := globex.TokenRead(ctx, token, "test_pass"); err == nil {
+		t.Fatalf("TokenRead: Expected [err] reading another namespace received [nil]")
+	}
+
+	if _, err := store.TokenRead(ctx, token, "test_pass"); err == nil {
+		t.Fatalf("TokenRead: Expected [err] reading from the default namespace received [nil]")
+	}
+
+	exists, err := globex.TokenExists(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenExists: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if exists {
+		t.Fatalf("TokenExists: Expected [false] in another namespace received [true]")
+	}
+
+	// a scoped store cannot escape its namespace through the query
+	count, err := globex.RecordCount(ctx, RecordQuery().SetNamespace("acme"))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 0 {
+		t.Fatalf("RecordCount: Expected [0] received [%v]", count)
+	}
+
+	count, err = store.RecordCount(ctx, RecordQuery().SetNamespace("acme"))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 1 {
+		t.Fatalf("RecordCount: Expected [1] received [%v]", count)
+	}
+
+	count, err = store.RecordCount(ctx, RecordQuery().SetNamespaceAll(true))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 1 {
+		t.Fatalf("RecordCount: Expected [1] across namespaces received [%v]", count)
+	}
+
+	if err := globex.TokenDelete(ctx, token); err != nil {
+		t.Fatalf("TokenDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := acme.TokenRead(ctx, token, "test_pass"); err != nil {
+		t.Fatalf("TokenRead: Expected delete from another namespace to be ignored received [%v]", err.Error())
+	}
+}
+
+func Test_Store_Namespace_CustomToken(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	acme := store.Namespace("acme")
+	globex := store.Namespace("globex")
+
+	if err := acme.TokenCreateCustom(ctx, "tk_shared", "acme_secret", "test_pass"); err != nil {
+		t.Fatalf("TokenCreateCustom: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// the token of another namespace is not revealed
+	if err := globex.TokenCreateCustom(ctx, "tk_shared", "globex_secret", "test_pass"); err != nil {
+		t.Fatalf("TokenCreateCustom: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenCreateCustom(ctx, "tk_shared", "default_secret", "test_pass"); err != nil {
+		t.Fatalf("TokenCreateCustom: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := globex.TokenCreateCustom(ctx, "tk_shared", "globex_again", "test_pass"); !errors.Is(err, ErrTokenExists) {
+		t.Fatalf("TokenCreateCustom: Expected [%v] in the same namespace received [%v]", ErrTokenExists, err)
+	}
+
+	cases := []struct {
+		store StoreInterface
+		value string
+	}{
+		{acme, "acme_secret"},
+		{globex, "globex_secret"},
+		{store, "default_secret"},
+	}
+
+	for _, c := range cases {
+		value, err := c.store.TokenRead(ctx, "tk_shared", "test_pass")
+		if err != nil {
+			t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+		}
+		if value != c.value {
+			t.Fatalf("TokenRead: Expected [%v] received [%v]", c.value, value)
+		}
+	}
+
+	// the unscoped store deletes the token of the default namespace only
+	if err := store.TokenDelete(ctx, "tk_shared"); err != nil {
+		t.Fatalf("TokenDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokensDelete(ctx, []string{"tk_shared"}); err != nil {
+		t.Fatalf("TokensDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	count, err := store.RecordCount(ctx, RecordQuery().SetNamespaceAll(true))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 2 {
+		t.Fatalf("RecordCount: Expected [2] received [%v]", count)
+	}
+
+	versions, err := acme.TokenVersions(ctx, "tk_shared")
+	if err != nil {
+		t.Fatalf("TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(versions) != 1 {
+		t.Fatalf("TokenVersions: Expected the versions to be kept received [%v]", len(versions))
+	}
+}
+
+func Test_Store_Namespace_Context(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	acmeCtx := WithNamespace(context.Background(), "acme")
+
+	token, err := store.TokenCreate(acmeCtx, "acme_secret", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.Namespace("acme").TokenRead(context.Background(), token, "test_pass"); err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokenRead(context.Background(), token, "test_pass"); err == nil {
+		t.Fatalf("TokenRead: Expected [err] without namespace received [nil]")
+	}
+
+	// the store scope takes precedence over the context
+	if _, err := store.Namespace("globex").TokenRead(acmeCtx, token, "test_pass"); err == nil {
+		t.Fatalf("TokenRead: Expected [err] from the globex store received [nil]")
+	}
+}
+
+func Test_Store_NamespaceCounts(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	for _, namespace := range []string{"", "acme", "acme", "globex"} {
+		if _, err := store.Namespace(namespace).TokenCreate(ctx, "secret", "test_pass", 20); err != nil {
+			t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+		}
+	}
+
+	counts, err := store.NamespaceCounts(ctx)
+	if err != nil {
+		t.Fatalf("NamespaceCounts: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if counts[""] != 1 || counts["acme"] != 2 || counts["globex"] != 1 || len(counts) != 3 {
+		t.Fatalf("NamespaceCounts: Unexpected counts [%v]", counts)
+	}
+
+	counts, err = store.Namespace("acme").NamespaceCounts(ctx)
+	if err != nil {
+		t.Fatalf("NamespaceCounts: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if counts["acme"] != 2 || len(counts) != 1 {
+		t.Fatalf("NamespaceCounts: Unexpected scoped counts [%v]", counts)
+	}
+}
+
+func Test_Store_NamespacePurge(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	acme := store.Namespace("acme")
+
+	acmeToken, err := acme.TokenCreate(ctx, "acme_secret", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := acme.TokenUpdate(ctx, acmeToken, "acme_secret_2", "test_pass"); err != nil {
+		t.Fatalf("TokenUpdate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	globexToken, err := store.Namespace("globex").TokenCreate(ctx, "globex_secret", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.Namespace("globex").NamespacePurge(ctx, "acme"); err == nil {
+		t.Fatalf("NamespacePurge: Expected [err] purging outside of the scope received [nil]")
+	}
+
+	purged, err := acme.NamespacePurge(ctx, "acme")
+	if err != nil {
+		t.Fatalf("NamespacePurge: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if purged != 1 {
+		t.Fatalf("NamespacePurge: Expected [1] received [%v]", purged)
+	}
+
+	if _, err := acme.TokenRead(ctx, acmeToken, "test_pass"); err == nil {
+		t.Fatalf("TokenRead: Expected [err] after purge received [nil]")
+	}
+
+	if _, err := store.Namespace("globex").TokenRead(ctx, globexToken, "test_pass"); err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+}
+
+func Test_Store_Namespace_DeleteKeepsVersions(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	acme := store.Namespace("acme")
+	globex := store.Namespace("globex")
+
+	token, err := acme.TokenCreate(ctx, "acme_secret", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	entry, err := acme.RecordFindByToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RecordFindByToken: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// deleting from another namespace deletes neither the record nor its history
+	if err := globex.TokenDelete(ctx, token); err != nil {
+		t.Fatalf("TokenDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := globex.RecordDeleteByID(ctx, entry.GetID()); err != nil {
+		t.Fatalf("RecordDeleteByID: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	versions, err := acme.TokenVersions(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(versions) != 1 {
+		t.Fatalf("TokenVersions: Expected [1] version received [%v]", len(versions))
+	}
+}
+
+func Test_Store_Namespace_Audit(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.AuditEnabled = true
+		options.AuditHmacKey = testKey(7)
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	acme := store.Namespace("acme")
+	globex := store.Namespace("globex")
+
+	acmeToken, err := acme.TokenCreate(ctx, "acme_secret", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := globex.TokenCreate(ctx, "globex_secret", "test_pass", 20); err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// a scoped store cannot escape its namespace through the query
+	entries, err := globex.AuditList(ctx, AuditQuery().SetNamespaceAll(true))
+	if err != nil {
+		t.Fatalf("AuditList: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(entries) != 1 || entries[0].GetNamespace() != "globex" {
+		t.Fatalf("AuditList: Expected [1] globex entry received [%v]", len(entries))
+	}
+
+	count, err := globex.AuditCount(ctx, AuditQuery().SetToken(acmeToken))
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 0 {
+		t.Fatalf("AuditCount: Expected [0] received [%v]", count)
+	}
+
+	count, err = store.AuditCount(WithNamespace(ctx, "acme"), AuditQuery().SetNamespace("globex"))
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 1 {
+		t.Fatalf("AuditCount: Expected [1] received [%v]", count)
+	}
+
+	// the unscoped store sees the default namespace, or all of them
+	count, err = store.AuditCount(ctx, AuditQuery())
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 0 {
+		t.Fatalf("AuditCount: Expected [0] received [%v]", count)
+	}
+
+	count, err = store.AuditCount(ctx, AuditQuery().SetNamespaceAll(true))
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 2 {
+		t.Fatalf("AuditCount: Expected [2] received [%v]", count)
+	}
+
+	if _, err := store.VerifyAuditChain(ctx); err != nil {
+		t.Fatalf("VerifyAuditChain: Expected [err] to be nil received [%v]", err.Error())
+	}
+}
@@ -9,21 +9,91 @@ import (
 // NewStore creates a new entity store
 func NewStore(opts NewStoreOptions) (*Store, error) {
 	store := &Store{
-		vaultTableName:     opts.VaultTableName,
-		automigrateEnabled: opts.AutomigrateEnabled,
-		db:                 opts.DB,
-		dbDriverName:       opts.DbDriverName,
-		debugEnabled:       opts.DebugEnabled,
+		vaultTableName:        opts.VaultTableName,
+		vaultVersionTableName: opts.VaultVersionTableName,
+		maxVersions:           opts.MaxVersions,
+		auditEnabled:          opts.AuditEnabled,
+		auditTableName:        opts.AuditTableName,
+		auditHmacKey:          opts.AuditHmacKey,
+		auditErrorHandler:     opts.AuditErrorHandler,
+		deterministicKey:      opts.DeterministicKey,
+		blindIndex:            opts.BlindIndex.withDefaults(),
+		defaultTokenFormat:    opts.TokenFormat,
+		tokenFormats:          opts.TokenFormats,
+		tokenCreateRetries:    opts.TokenCreateRetries,
+		janitor:               opts.Janitor.withDefaults(),
+		janitorState:          &janitorState{},
+		automigrateEnabled:    opts.AutomigrateEnabled,
+		db:                    opts.DB,
+		dbDriverName:          opts.DbDriverName,
+		debugEnabled:          opts.DebugEnabled,
+		kdf:                   opts.Kdf.withDefaults(),
+		keyProvider:           opts.KeyProvider,
+		policyEvaluator:       opts.PolicyEvaluator,
 	}
 
 	if store.vaultTableName == "" {
 		return nil, errors.New("vault store: vaultTableName is required")
 	}
 
+	if store.vaultVersionTableName == "" {
+		store.vaultVersionTableName = store.vaultTableName + "_version"
+	}
+
+	if store.auditTableName == "" {
+		store.auditTableName = store.vaultTableName + "_audit"
+	}
+
+	if store.auditEnabled && len(store.auditHmacKey) == 0 {
+		return nil, errors.New("vault store: AuditHmacKey is required when AuditEnabled is set")
+	}
+
+	if len(store.auditHmacKey) > 0 && len(store.auditHmacKey) < 32 {
+		return nil, errors.New("vault store: AuditHmacKey must be at least 32 bytes")
+	}
+
+	if len(store.deterministicKey) > 0 && len(store.deterministicKey) < 32 {
+		return nil, errors.New("vault store: DeterministicKey must be at least 32 bytes")
+	}
+
+	if err := store.blindIndex.validate(); err != nil {
+		return nil, errors.New("vault store: " + err.Error())
+	}
+
+	if err := store.defaultTokenFormat.validate(); err != nil {
+		return nil, errors.New("vault store: " + err.Error())
+	}
+
+	for namespace, format := range store.tokenFormats {
+		if err := format.validate(); err != nil {
+			return nil, errors.New("vault store: namespace " + namespace + ": " + err.Error())
+		}
+	}
+
+	if store.tokenCreateRetries < 0 {
+		return nil, errors.New("vault store: TokenCreateRetries cannot be negative")
+	}
+
+	if store.tokenCreateRetries == 0 {
+		store.tokenCreateRetries = TOKEN_CREATE_RETRIES_DEFAULT
+	}
+
+	if err := store.janitor.validate(); err != nil {
+		return nil, errors.New("vault store: " + err.Error())
+	}
+
+	if store.maxVersions < 0 {
+		return nil, errors.New("vault store: MaxVersions cannot be negative")
+	}
+
 	if store.db == nil {
 		return nil, errors.New("vault store: DB is required")
 	}
 
+	if err := store.kdf.validate(); err != nil {
+		return nil, errors.New("vault store: " + err.Error())
+	}
+
 	if store.dbDriverName == "" {
 		store.dbDriverName = database.DatabaseType(store.db)
 	}
@@ -4,9 +4,73 @@ import "database/sql"
 
 // NewStoreOptions define the options for creating a new session store
 type NewStoreOptions struct {
-	VaultTableName     string
+	VaultTableName string
+
+	// VaultVersionTableName is the table keeping the version history
+	// of the values (default: VaultTableName + "_version")
+	VaultVersionTableName string
+
+	// MaxVersions is the number of versions kept per token,
+	// older versions are deleted (default: 0, keeps all versions)
+	MaxVersions int
+
+	// AuditEnabled records every token access and mutation in the audit table
+	AuditEnabled bool
+
+	// AuditTableName is the table keeping the audit log
+	// (default: VaultTableName + "_audit")
+	AuditTableName string
+
+	// AuditHmacKey keys the HMAC of each audit entry, required with
+	// AuditEnabled. It must be at least 32 bytes, and kept apart from the
+	// database, the vault passwords and data keys, so someone able to
+	// edit the audit table cannot recompute the HMACs.
+	AuditHmacKey []byte
+
+	// AuditErrorHandler is called when the audit entries of a failed call
+	// cannot be recorded, as the error of the call is returned instead.
+	// When nil, the audit error is logged in debug mode only.
+	AuditErrorHandler func(err error)
+
+	// DeterministicKey keys the HMAC deterministic tokens are derived
+	// from, it must be at least 32 bytes. Changing it changes the token
+	// of every value tokenized afterwards.
+	DeterministicKey []byte
+
+	// BlindIndex defines the blind indexes kept for each value, to
+	// search the values without decrypting them, disabled without a key
+	BlindIndex BlindIndexOptions
+
+	// TokenFormat defines the format of the generated tokens,
+	// see DefaultTokenFormat for the defaults
+	TokenFormat TokenFormat
+
+	// TokenFormats overrides the token format per namespace
+	TokenFormats map[string]TokenFormat
+
+	// TokenCreateRetries is the number of retries with a fresh token,
+	// when the generated token is already taken (default: 3)
+	TokenCreateRetries int
+
 	DB                 *sql.DB
 	DbDriverName       string
 	AutomigrateEnabled bool
 	DebugEnabled       bool
+
+	// Kdf defines the key derivation used to turn passwords into
+	// encryption keys, defaults to Argon2id with recommended costs
+	Kdf KdfOptions
+
+	// KeyProvider wraps the per-record data keys, when set the Token
+	// methods can be called with an empty password
+	KeyProvider KeyProvider
+
+	// PolicyEvaluator checks the principal of the context (WithPrincipal)
+	// may read, update or delete a token, see NewPolicyEvaluator.
+	// When nil, every call is allowed.
+	PolicyEvaluator PolicyEvaluator
+
+	// Janitor defines the purge of the soft deleted and expired
+	// records, started with StartJanitor
+	Janitor JanitorOptions
 }
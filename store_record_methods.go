@@ -13,7 +13,7 @@ import (
 )
 
 func (store *Store) RecordCount(ctx context.Context, query RecordQueryInterface) (int64, error) {
-	query = query.SetCountOnly(true)
+	query = store.namespaceQuery(ctx, query).SetCountOnly(true)
 	dataset, _, err := query.toSelectDataset(store)
 
 	if err != nil {
@@ -26,7 +26,7 @@ func (store *Store) RecordCount(ctx context.Context, query RecordQueryInterface)
 		ToSQL()
 
 	if errSql != nil {
-		return -1, nil
+		return -1, errSql
 	}
 
 	if store.debugEnabled {
@@ -40,7 +40,7 @@ func (store *Store) RecordCount(ctx context.Context, query RecordQueryInterface)
 	}
 
 	if len(mapped) < 1 {
-		return -1, nil
+		return -1, errors.New("count query returned no rows")
 	}
 
 	countStr := mapped[0]["count"]
@@ -59,6 +59,14 @@ func (store *Store) RecordCreate(ctx context.Context, record RecordInterface) er
 	record.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
 	record.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
 
+	// the default namespace is saved as empty, never NULL, so the
+	// unique token per namespace index applies to it
+	if namespace, scoped := store.namespaceFromContext(ctx); scoped {
+		record.SetNamespace(namespace)
+	} else {
+		record.SetNamespace(record.GetNamespace())
+	}
+
 	data := record.Data()
 
 	sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
@@ -94,7 +102,7 @@ func (store *Store) RecordCreate(ctx context.Context, record RecordInterface) er
 
 func (store *Store) RecordDeleteByID(ctx context.Context, recordID string) error {
 	if recordID == "" {
-		return errors.New("record id is empty")
+		return ErrEmptyRecordID
 	}
 
 	q := goqu.Dialect(store.dbDriverName).
@@ -102,30 +110,36 @@ func (store *Store) RecordDeleteByID(ctx context.Context, recordID string) error
 		Prepared(true).
 		Where(goqu.C(COLUMN_ID).Eq(recordID))
 
+	if namespaceWhere := store.namespaceWhere(ctx); namespaceWhere != nil {
+		q = q.Where(namespaceWhere)
+	}
+
 	sqlStr, sqlParams, err := q.ToSQL()
 
 	if err != nil {
 		return err
 	}
 
-	_, err = database.Execute(store.toQuerableContext(ctx), sqlStr, sqlParams...)
+	return store.runInTransaction(ctx, func(txCtx context.Context) error {
+		if err := store.versionsDeleteByRecords(txCtx, goqu.C(COLUMN_ID).Eq(recordID)); err != nil {
+			return err
+		}
+
+		_, err := database.Execute(store.toQuerableContext(txCtx), sqlStr, sqlParams...)
 
-	if err != nil {
 		return err
-	}
-
-	return nil
+	})
 }
 
 func (store *Store) RecordDeleteByToken(ctx context.Context, token string) error {
 	if token == "" {
-		return errors.New("token is empty")
+		return ErrEmptyToken
 	}
 
 	q := goqu.Dialect(store.dbDriverName).
 		Delete(store.vaultTableName).
 		Prepared(true).
-		Where(goqu.C(COLUMN_VAULT_TOKEN).Eq(token))
+		Where(goqu.C(COLUMN_VAULT_TOKEN).Eq(token), store.tokenNamespaceWhere(ctx))
 
 	sqlStr, sqlParams, err := q.ToSQL()
 
@@ -133,19 +147,21 @@ func (store *Store) RecordDeleteByToken(ctx context.Context, token string) error
 		return err
 	}
 
-	_, err = database.Execute(store.toQuerableContext(ctx), sqlStr, sqlParams...)
+	return store.runInTransaction(ctx, func(txCtx context.Context) error {
+		if err := store.versionsDeleteByToken(txCtx, token); err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
-	}
+		_, err := database.Execute(store.toQuerableContext(txCtx), sqlStr, sqlParams...)
 
-	return nil
+		return err
+	})
 }
 
 // FindByID finds an entry by ID
 func (st *Store) RecordFindByID(ctx context.Context, id string) (RecordInterface, error) {
 	if id == "" {
-		return nil, errors.New("record id is empty")
+		return nil, ErrEmptyRecordID
 	}
 
 	// Use RecordList with a query to ensure consistent soft delete handling
@@ -164,7 +180,7 @@ func (st *Store) RecordFindByID(ctx context.Context, id string) (RecordInterface
 
 // RecordFindByToken finds a record entity by token
 //
-// # If the supplied token is empty, an error is returned
+// # If the supplied token is empty, ErrEmptyToken is returned
 //
 // Parameters:
 // - ctx: The context
@@ -175,7 +191,7 @@ func (st *Store) RecordFindByID(ctx context.Context, id string) (RecordInterface
 // - err: An error if something went wrong
 func (st *Store) RecordFindByToken(ctx context.Context, token string) (RecordInterface, error) {
 	if token == "" {
-		return nil, errors.New("token is empty")
+		return nil, ErrEmptyToken
 	}
 
 	// Use the query interface to properly handle soft deletion
@@ -192,6 +208,8 @@ func (st *Store) RecordFindByToken(ctx context.Context, token string) (RecordInt
 }
 
 func (store *Store) RecordList(ctx context.Context, query RecordQueryInterface) ([]RecordInterface, error) {
+	query = store.namespaceQuery(ctx, query)
+
 	err := query.Validate()
 
 	if err != nil {
@@ -207,7 +225,7 @@ func (store *Store) RecordList(ctx context.Context, query RecordQueryInterface)
 	sqlStr, sqlParams, errSql := dataset.Select(columns...).Prepared(true).ToSQL()
 
 	if errSql != nil {
-		return []RecordInterface{}, nil
+		return []RecordInterface{}, errSql
 	}
 
 	if store.debugEnabled {
@@ -233,7 +251,7 @@ func (store *Store) RecordList(ctx context.Context, query RecordQueryInterface)
 // RecordSoftDelete soft deletes a record by setting the soft_deleted_at column to the current time
 func (store *Store) RecordSoftDelete(ctx context.Context, record RecordInterface) error {
 	if record == nil {
-		return errors.New("record is nil")
+		return ErrNilRecord
 	}
 
 	// Set the soft_deleted_at field to the current time
@@ -245,7 +263,7 @@ func (store *Store) RecordSoftDelete(ctx context.Context, record RecordInterface
 // RecordSoftDeleteByID soft deletes a record by ID by setting the soft_deleted_at column to the current time
 func (store *Store) RecordSoftDeleteByID(ctx context.Context, recordID string) error {
 	if recordID == "" {
-		return errors.New("record id is empty")
+		return ErrEmptyRecordID
 	}
 
 	// Find the record first
@@ -255,7 +273,7 @@ func (store *Store) RecordSoftDeleteByID(ctx context.Context, recordID string) e
 	}
 
 	if record == nil {
-		return errors.New("record not found")
+		return ErrRecordNotFound
 	}
 
 	return store.RecordSoftDelete(ctx, record)
@@ -264,7 +282,7 @@ func (store *Store) RecordSoftDeleteByID(ctx context.Context, recordID string) e
 // RecordSoftDeleteByToken soft deletes a record by token by setting the soft_deleted_at column to the current time
 func (store *Store) RecordSoftDeleteByToken(ctx context.Context, token string) error {
 	if token == "" {
-		return errors.New("token is empty")
+		return ErrEmptyToken
 	}
 
 	// Find the record first
@@ -274,22 +292,30 @@ func (store *Store) RecordSoftDeleteByToken(ctx context.Context, token string) e
 	}
 
 	if record == nil {
-		return errors.New("record not found")
+		return ErrRecordNotFound
 	}
 
 	return store.RecordSoftDelete(ctx, record)
 }
 
+// RecordUpdate updates the changed columns of the record, if the record
+// still has the revision it was read with, and increments the revision
+//
+// # If the record was updated or deleted since it was read, a
+// *RevisionConflictError is returned, and nothing is updated
 func (store *Store) RecordUpdate(ctx context.Context, record RecordInterface) error {
 	if record == nil {
-		return errors.New("record is nil")
+		return ErrNilRecord
 	}
 
 	if record.GetID() == "" {
-		return errors.New("record id is empty")
+		return ErrEmptyRecordID
 	}
 
+	revision := record.GetRevision()
+
 	record.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+	record.SetRevision(revision + 1)
 
 	dataChanged := record.DataChanged()
 
@@ -300,12 +326,17 @@ func (store *Store) RecordUpdate(ctx context.Context, record RecordInterface) er
 		return nil
 	}
 
-	sqlStr, sqlParams, err := goqu.Dialect(store.dbDriverName).
+	q := goqu.Dialect(store.dbDriverName).
 		Update(store.vaultTableName).
 		Prepared(true).
 		Set(dataChanged).
-		Where(goqu.C(COLUMN_ID).Eq(record.GetID())).
-		ToSQL()
+		Where(goqu.C(COLUMN_ID).Eq(record.GetID()), revisionCondition(revision))
+
+	if namespaceWhere := store.namespaceWhere(ctx); namespaceWhere != nil {
+		q = q.Where(namespaceWhere)
+	}
+
+	sqlStr, sqlParams, err := q.ToSQL()
 
 	if err != nil {
 		return err
@@ -315,11 +346,40 @@ func (store *Store) RecordUpdate(ctx context.Context, record RecordInterface) er
 		log.Println(sqlStr)
 	}
 
-	_, err = database.Execute(store.toQuerableContext(ctx), sqlStr, sqlParams...)
+	result, err := database.Execute(store.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
 
 	if err != nil {
 		return err
 	}
 
+	if affected < 1 {
+		record.SetRevision(revision)
+
+		return &RevisionConflictError{
+			RecordID: record.GetID(),
+			Token:    record.GetToken(),
+			Revision: revision,
+		}
+	}
+
 	return nil
 }
+
+// revisionCondition matches the records at the revision, the records
+// created before revisions were added (NULL) are at revision 0
+func revisionCondition(revision int) goqu.Expression {
+	if revision < 1 {
+		return goqu.Or(
+			goqu.C(COLUMN_REVISION).IsNull(),
+			goqu.C(COLUMN_REVISION).Eq(0),
+		)
+	}
+
+	return goqu.C(COLUMN_REVISION).Eq(revision)
+}
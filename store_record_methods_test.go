@@ -663,3 +663,70 @@ func Test_Store_RecordSoftDeleteByToken(t *testing.T) {
 		t.Fatal("Test_Store_RecordSoftDeleteByToken: Expected error for non-existent token but got nil")
 	}
 }
+
+func Test_Store_RecordList_Labels(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	tokens := map[string]map[string]string{}
+
+	for _, metadata := range []map[string]string{
+		{"kind": "api_key", "user_id": "123"},
+		{"kind": "api_key", "user_id": "456"},
+		{"kind": "card", "user_id": "123"},
+		{"kind": "api_key", "user_id": "1234"},
+		{"kind": "api_key", "note": `"user_id":"123"`},
+	} {
+		token, err := store.TokenCreateWithOptions(ctx, "secret", "test_pass", 20, TokenCreateOptions{Metadata: metadata})
+		if err != nil {
+			t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+		}
+		tokens[token] = metadata
+	}
+
+	records, err := store.RecordList(ctx, RecordQuery().SetLabel("kind", "api_key").SetLabel("user_id", "123"))
+	if err != nil {
+		t.Fatalf("RecordList: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("RecordList: Expected [1] record received [%v]", len(records))
+	}
+
+	metadata, err := records[0].GetMetadata()
+	if err != nil {
+		t.Fatalf("GetMetadata: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if metadata["kind"] != "api_key" || metadata["user_id"] != "123" || len(tokens[records[0].GetToken()]) != 2 {
+		t.Fatalf("GetMetadata: Unexpected metadata [%v]", metadata)
+	}
+
+	count, err := store.RecordCount(ctx, RecordQuery().SetMetadataContains(map[string]string{"user_id": "123"}))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 2 {
+		t.Fatalf("RecordCount: Expected [2] received [%v]", count)
+	}
+
+	count, err = store.RecordCount(ctx, RecordQuery().SetLabel("kind", "api_%"))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 0 {
+		t.Fatalf("RecordCount: Expected wildcards to be escaped [0] received [%v]", count)
+	}
+
+	if _, err := store.RecordCount(ctx, RecordQuery().SetLabel("", "api_key")); err == nil {
+		t.Fatalf("RecordCount: Expected [err] for an empty label key received [nil]")
+	}
+
+	if _, err := store.TokenCreateWithOptions(ctx, "secret", "test_pass", 20, TokenCreateOptions{Metadata: map[string]string{"": "x"}}); err == nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] for an empty metadata key received [nil]")
+	}
+}
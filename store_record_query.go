@@ -1,12 +1,14 @@
 package vaultstore
 
 import (
+	"encoding/json"
 	"errors"
 	"strings"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/dromara/carbon/v2"
 	"github.com/gouniverse/sb"
+	"github.com/samber/lo"
 )
 
 // ============================================================================//
@@ -44,12 +46,36 @@ func (q *recordQueryImpl) Validate() error {
 	if q.IsTokenSet() && q.GetToken() == "" {
 		return errors.New("token cannot be empty")
 	}
+	if q.IsValueHmacSet() && q.GetValueHmac() == "" {
+		return errors.New("valueHmac cannot be empty")
+	}
+	if q.IsBlindIndexSet() && q.GetBlindIndex() == "" {
+		return errors.New("blindIndex cannot be empty")
+	}
+	if q.IsBlindIndexPrefixSet() && q.GetBlindIndexPrefix() == "" {
+		return errors.New("blindIndexPrefix cannot be empty")
+	}
+	if q.IsBlindIndexSuffixSet() && q.GetBlindIndexSuffix() == "" {
+		return errors.New("blindIndexSuffix cannot be empty")
+	}
+	if q.IsIDGtSet() && q.GetIDGt() == "" {
+		return errors.New("idGt cannot be empty")
+	}
 	if q.IsIDInSet() && len(q.GetIDIn()) == 0 {
 		return errors.New("idIn cannot be empty")
 	}
 	if q.IsTokenInSet() && len(q.GetTokenIn()) == 0 {
 		return errors.New("tokenIn cannot be empty")
 	}
+	if q.IsLabelsSet() && lo.HasKey(q.GetLabels(), "") {
+		return errors.New("label key cannot be empty")
+	}
+	if q.IsMetadataContainsSet() && len(q.GetMetadataContains()) == 0 {
+		return errors.New("metadataContains cannot be empty")
+	}
+	if q.IsMetadataContainsSet() && lo.HasKey(q.GetMetadataContains(), "") {
+		return errors.New("metadataContains key cannot be empty")
+	}
 	if q.IsLimitSet() && q.GetLimit() < 0 {
 		return errors.New("limit cannot be negative")
 	}
@@ -77,6 +103,18 @@ func (rq *recordQueryImpl) toSelectDataset(store StoreInterface) (selectDataset
 
 	q := goqu.Dialect(store.GetDbDriverName()).From(store.GetVaultTableName())
 
+	// Records are always filtered by namespace, the store namespace is
+	// the default namespace (empty) unless the store is scoped
+	if !rq.GetNamespaceAll() {
+		namespace := store.GetNamespace()
+
+		if rq.IsNamespaceSet() {
+			namespace = rq.GetNamespace()
+		}
+
+		q = q.Where(namespaceCondition(namespace))
+	}
+
 	if rq.IsIDSet() && rq.GetID() != "" {
 		q = q.Where(goqu.C(COLUMN_ID).Eq(rq.GetID()))
 	}
@@ -85,6 +123,26 @@ func (rq *recordQueryImpl) toSelectDataset(store StoreInterface) (selectDataset
 		q = q.Where(goqu.C(COLUMN_VAULT_TOKEN).Eq(rq.GetToken()))
 	}
 
+	if rq.IsValueHmacSet() && rq.GetValueHmac() != "" {
+		q = q.Where(goqu.C(COLUMN_VALUE_HMAC).Eq(rq.GetValueHmac()))
+	}
+
+	if rq.IsBlindIndexSet() && rq.GetBlindIndex() != "" {
+		q = q.Where(goqu.C(COLUMN_BLIND_INDEX).Eq(rq.GetBlindIndex()))
+	}
+
+	if rq.IsBlindIndexPrefixSet() && rq.GetBlindIndexPrefix() != "" {
+		q = q.Where(goqu.C(COLUMN_BLIND_INDEX_PREFIX).Eq(rq.GetBlindIndexPrefix()))
+	}
+
+	if rq.IsBlindIndexSuffixSet() && rq.GetBlindIndexSuffix() != "" {
+		q = q.Where(goqu.C(COLUMN_BLIND_INDEX_SUFFIX).Eq(rq.GetBlindIndexSuffix()))
+	}
+
+	if rq.IsIDGtSet() && rq.GetIDGt() != "" {
+		q = q.Where(goqu.C(COLUMN_ID).Gt(rq.GetIDGt()))
+	}
+
 	if rq.IsIDInSet() && len(rq.GetIDIn()) > 0 {
 		q = q.Where(goqu.C(COLUMN_ID).In(rq.GetIDIn()))
 	}
@@ -93,6 +151,14 @@ func (rq *recordQueryImpl) toSelectDataset(store StoreInterface) (selectDataset
 		q = q.Where(goqu.C(COLUMN_VAULT_TOKEN).In(rq.GetTokenIn()))
 	}
 
+	for key, value := range rq.GetLabels() {
+		q = q.Where(metadataCondition(key, value))
+	}
+
+	for key, value := range rq.GetMetadataContains() {
+		q = q.Where(metadataCondition(key, value))
+	}
+
 	if !rq.IsCountOnlySet() {
 		if rq.IsLimitSet() && rq.GetLimit() > 0 {
 			q = q.Limit(uint(rq.GetLimit()))
@@ -122,6 +188,27 @@ func (rq *recordQueryImpl) toSelectDataset(store StoreInterface) (selectDataset
 		columns = append(columns, column)
 	}
 
+	now := carbon.Now(carbon.UTC).ToDateTimeString()
+
+	// Records with no reads remaining are expired, they are
+	// about to be deleted by the reader that consumed the last read
+	if rq.GetExpiredOnly() {
+		q = q.Where(goqu.Or(
+			goqu.C(COLUMN_EXPIRES_AT).Lte(now),
+			goqu.C(COLUMN_READS_REMAINING).Eq(0),
+		))
+	} else if !rq.GetExpiredInclude() {
+		// Records without an expiration or read limit (NULL) never expire
+		q = q.Where(goqu.Or(
+			goqu.C(COLUMN_EXPIRES_AT).IsNull(),
+			goqu.C(COLUMN_EXPIRES_AT).Gt(now),
+		))
+		q = q.Where(goqu.Or(
+			goqu.C(COLUMN_READS_REMAINING).IsNull(),
+			goqu.C(COLUMN_READS_REMAINING).Neq(0),
+		))
+	}
+
 	if rq.IsSoftDeletedIncludeSet() {
 		// soft deleted requested specifically
 		return q, columns, nil
@@ -132,7 +219,7 @@ func (rq *recordQueryImpl) toSelectDataset(store StoreInterface) (selectDataset
 	// When a record is soft-deleted, soft_deleted_at is set to the current time
 	// By default, soft_deleted_at is set to MAX_DATETIME (not soft-deleted)
 	softDeletedFilter := goqu.C(COLUMN_SOFT_DELETED_AT).
-		Gt(carbon.Now(carbon.UTC).ToDateTimeString())
+		Gt(now)
 
 	return q.Where(softDeletedFilter), columns, nil
 }
@@ -169,6 +256,85 @@ func (q *recordQueryImpl) SetID(id string) RecordQueryInterface {
 	return q
 }
 
+func (q *recordQueryImpl) IsLabelsSet() bool {
+	return q.hasProperty("labels")
+}
+
+func (q *recordQueryImpl) GetLabels() map[string]string {
+	if q.IsLabelsSet() {
+		return q.properties["labels"].(map[string]string)
+	}
+	return map[string]string{}
+}
+
+// SetLabel filters the records having the metadata key set to the value,
+// can be called multiple times, the records must have all labels
+func (q *recordQueryImpl) SetLabel(key string, value string) RecordQueryInterface {
+	labels := map[string]string{}
+
+	for k, v := range q.GetLabels() {
+		labels[k] = v
+	}
+
+	labels[key] = value
+
+	q.properties["labels"] = labels
+	return q
+}
+
+func (q *recordQueryImpl) IsMetadataContainsSet() bool {
+	return q.hasProperty("metadataContains")
+}
+
+func (q *recordQueryImpl) GetMetadataContains() map[string]string {
+	if q.IsMetadataContainsSet() {
+		return q.properties["metadataContains"].(map[string]string)
+	}
+	return map[string]string{}
+}
+
+// SetMetadataContains filters the records having all the metadata entries
+func (q *recordQueryImpl) SetMetadataContains(metadata map[string]string) RecordQueryInterface {
+	q.properties["metadataContains"] = metadata
+	return q
+}
+
+func (q *recordQueryImpl) IsNamespaceSet() bool {
+	return q.hasProperty("namespace")
+}
+
+func (q *recordQueryImpl) GetNamespace() string {
+	if q.IsNamespaceSet() {
+		return q.properties["namespace"].(string)
+	}
+	return ""
+}
+
+// SetNamespace filters the records by namespace, on a scoped store, or
+// with a namespace in the context, it is replaced by the scope namespace
+func (q *recordQueryImpl) SetNamespace(namespace string) RecordQueryInterface {
+	q.properties["namespace"] = namespace
+	return q
+}
+
+func (q *recordQueryImpl) IsNamespaceAllSet() bool {
+	return q.hasProperty("namespaceAll")
+}
+
+func (q *recordQueryImpl) GetNamespaceAll() bool {
+	if q.IsNamespaceAllSet() {
+		return q.properties["namespaceAll"].(bool)
+	}
+	return false
+}
+
+// SetNamespaceAll returns the records of all namespaces,
+// ignored on a scoped store, or with a namespace in the context
+func (q *recordQueryImpl) SetNamespaceAll(namespaceAll bool) RecordQueryInterface {
+	q.properties["namespaceAll"] = namespaceAll
+	return q
+}
+
 func (q *recordQueryImpl) IsTokenSet() bool {
 	return q.hasProperty("token")
 }
@@ -185,6 +351,22 @@ func (q *recordQueryImpl) SetToken(token string) RecordQueryInterface {
 	return q
 }
 
+func (q *recordQueryImpl) IsIDGtSet() bool {
+	return q.hasProperty("idGt")
+}
+
+func (q *recordQueryImpl) GetIDGt() string {
+	if q.IsIDGtSet() {
+		return q.properties["idGt"].(string)
+	}
+	return ""
+}
+
+func (q *recordQueryImpl) SetIDGt(idGt string) RecordQueryInterface {
+	q.properties["idGt"] = idGt
+	return q
+}
+
 func (q *recordQueryImpl) IsIDInSet() bool {
 	return q.hasProperty("idIn")
 }
@@ -297,6 +479,38 @@ func (q *recordQueryImpl) SetSoftDeletedInclude(softDeletedInclude bool) RecordQ
 	return q
 }
 
+func (q *recordQueryImpl) IsExpiredIncludeSet() bool {
+	return q.hasProperty("expiredInclude")
+}
+
+func (q *recordQueryImpl) GetExpiredInclude() bool {
+	if q.IsExpiredIncludeSet() {
+		return q.properties["expiredInclude"].(bool)
+	}
+	return false
+}
+
+func (q *recordQueryImpl) SetExpiredInclude(expiredInclude bool) RecordQueryInterface {
+	q.properties["expiredInclude"] = expiredInclude
+	return q
+}
+
+func (q *recordQueryImpl) IsExpiredOnlySet() bool {
+	return q.hasProperty("expiredOnly")
+}
+
+func (q *recordQueryImpl) GetExpiredOnly() bool {
+	if q.IsExpiredOnlySet() {
+		return q.properties["expiredOnly"].(bool)
+	}
+	return false
+}
+
+func (q *recordQueryImpl) SetExpiredOnly(expiredOnly bool) RecordQueryInterface {
+	q.properties["expiredOnly"] = expiredOnly
+	return q
+}
+
 func (q *recordQueryImpl) IsLimitSet() bool {
 	return q.hasProperty("limit")
 }
@@ -317,3 +531,98 @@ func (q *recordQueryImpl) hasProperty(key string) bool {
 	_, ok := q.properties[key]
 	return ok
 }
+
+// metadataCondition matches the records having the metadata key set to
+// the value, portable across databases without JSON functions
+//
+// The metadata is saved as JSON with sorted keys and escaped strings,
+// so the "key":"value" pair appears verbatim, and cannot be forged by
+// a key or value containing quotes. The case sensitivity follows
+// the LIKE collation of the database.
+func metadataCondition(key string, value string) goqu.Expression {
+	encodedKey, _ := json.Marshal(key)
+	encodedValue, _ := json.Marshal(value)
+
+	pair := string(encodedKey) + ":" + string(encodedValue)
+
+	return goqu.L("? LIKE ? ESCAPE '!'", goqu.C(COLUMN_METADATA), "%"+likeEscape(pair)+"%")
+}
+
+// likeEscape escapes the LIKE wildcards with '!', including
+// the SQL Server character ranges
+func likeEscape(value string) string {
+	return strings.NewReplacer(
+		"!", "!!",
+		"%", "!%",
+		"_", "!_",
+		"[", "![",
+	).Replace(value)
+}
+
+func (q *recordQueryImpl) IsValueHmacSet() bool {
+	return q.hasProperty("valueHmac")
+}
+
+func (q *recordQueryImpl) GetValueHmac() string {
+	if q.IsValueHmacSet() {
+		return q.properties["valueHmac"].(string)
+	}
+	return ""
+}
+
+// SetValueHmac filters the deterministic tokens by the keyed HMAC of their value
+func (q *recordQueryImpl) SetValueHmac(valueHmac string) RecordQueryInterface {
+	q.properties["valueHmac"] = valueHmac
+	return q
+}
+
+func (q *recordQueryImpl) IsBlindIndexSet() bool {
+	return q.hasProperty("blindIndex")
+}
+
+func (q *recordQueryImpl) GetBlindIndex() string {
+	if q.IsBlindIndexSet() {
+		return q.properties["blindIndex"].(string)
+	}
+	return ""
+}
+
+// SetBlindIndex filters the records by the blind index of their value, see Store.BlindIndex
+func (q *recordQueryImpl) SetBlindIndex(blindIndex string) RecordQueryInterface {
+	q.properties["blindIndex"] = blindIndex
+	return q
+}
+
+func (q *recordQueryImpl) IsBlindIndexPrefixSet() bool {
+	return q.hasProperty("blindIndexPrefix")
+}
+
+func (q *recordQueryImpl) GetBlindIndexPrefix() string {
+	if q.IsBlindIndexPrefixSet() {
+		return q.properties["blindIndexPrefix"].(string)
+	}
+	return ""
+}
+
+// SetBlindIndexPrefix filters the records by the blind index of the prefix of their value, see Store.BlindIndexPrefix
+func (q *recordQueryImpl) SetBlindIndexPrefix(blindIndexPrefix string) RecordQueryInterface {
+	q.properties["blindIndexPrefix"] = blindIndexPrefix
+	return q
+}
+
+func (q *recordQueryImpl) IsBlindIndexSuffixSet() bool {
+	return q.hasProperty("blindIndexSuffix")
+}
+
+func (q *recordQueryImpl) GetBlindIndexSuffix() string {
+	if q.IsBlindIndexSuffixSet() {
+		return q.properties["blindIndexSuffix"].(string)
+	}
+	return ""
+}
+
+// SetBlindIndexSuffix filters the records by the blind index of the suffix of their value, see Store.BlindIndexSuffix
+func (q *recordQueryImpl) SetBlindIndexSuffix(blindIndexSuffix string) RecordQueryInterface {
+	q.properties["blindIndexSuffix"] = blindIndexSuffix
+	return q
+}
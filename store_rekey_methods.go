@@ -0,0 +1,261 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gouniverse/sb"
+)
+
+// RekeyOptions define the options for re-encrypting the vault
+type RekeyOptions struct {
+	// BatchSize is the number of records re-encrypted per transaction (default: 100)
+	BatchSize int
+
+	// StartAfterID resumes a previous run, use the LastID of the last
+	// reported progress. Empty starts from the beginning.
+	StartAfterID string
+
+	// UpgradeFormat re-encrypts legacy XOR values, and values encrypted
+	// with other KDF settings than the current store options
+	UpgradeFormat bool
+
+	// OnProgress is called after each committed batch
+	OnProgress func(progress RekeyProgress)
+}
+
+// RekeyProgress reports the progress of a rekey run
+type RekeyProgress struct {
+	// Processed is the number of records examined
+	Processed int64
+	// Rekeyed is the number of records re-encrypted
+	Rekeyed int64
+	// Upgraded is the number of re-encrypted records that were stored in an outdated format
+	Upgraded int64
+	// Skipped is the number of records encrypted with another password,
+	// or wrapped by the key provider
+	Skipped int64
+	// VersionsRekeyed is the number of earlier versions re-encrypted
+	VersionsRekeyed int64
+	// LastID is the ID of the last committed record, used to resume a run
+	LastID string
+}
+
+// RekeyAll re-encrypts all records encrypted with the old password
+// using the new password
+//
+// Business logic:
+//  1. Walk the table in batches ordered by ID, including soft deleted,
+//     expired and exhausted records
+//  2. Each batch is read and re-encrypted in its own transaction
+//  3. Records encrypted with another password are skipped, this
+//     includes records already re-encrypted by an interrupted run, and
+//     so are values wrapped by the key provider
+//  4. A tampered or malformed value aborts the run, rolling back its batch
+//  5. The version history of each record is re-encrypted with the record
+//  6. Progress is reported after each committed batch, its LastID
+//     can be passed as StartAfterID to resume after a crash
+//
+// Parameters:
+// - ctx: The context
+// - oldPassword: The password the records are currently encrypted with
+// - newPassword: The password to re-encrypt the records with
+// - opts: The rekey options
+//
+// Returns:
+// - progress: The progress up to the last committed batch
+// - err: An error if something went wrong
+func (st *Store) RekeyAll(ctx context.Context, oldPassword string, newPassword string, opts RekeyOptions) (progress RekeyProgress, err error) {
+	progress = RekeyProgress{LastID: opts.StartAfterID}
+
+	if oldPassword == "" || newPassword == "" {
+		return progress, ErrEmptyPassword
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		batchProgress, count, err := st.rekeyBatch(ctx, oldPassword, newPassword, opts, progress)
+
+		if err != nil {
+			return progress, err
+		}
+
+		if count == 0 {
+			return progress, nil
+		}
+
+		progress = batchProgress
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+
+		if count < opts.BatchSize {
+			return progress, nil
+		}
+	}
+}
+
+// rekeyBatch re-encrypts the next batch of records after progress.LastID
+// in a single transaction, returns the new progress and the number of
+// records in the batch
+func (st *Store) rekeyBatch(ctx context.Context, oldPassword string, newPassword string, opts RekeyOptions, progress RekeyProgress) (RekeyProgress, int, error) {
+	count := 0
+
+	err := st.runInTransaction(ctx, func(txCtx context.Context) error {
+		// all namespaces are rekeyed, unless the store is scoped, and
+		// the records which cannot be read now, as they may be restored
+		query := RecordQuery().
+			SetNamespaceAll(true).
+			SetSoftDeletedInclude(true).
+			SetExpiredInclude(true).
+			SetOrderBy(COLUMN_ID).
+			SetSortOrder(sb.ASC).
+			SetLimit(opts.BatchSize)
+
+		if progress.LastID != "" {
+			query = query.SetIDGt(progress.LastID)
+		}
+
+		records, err := st.RecordList(txCtx, query)
+
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			value, upgraded, changed, err := st.rekeyValue(record, oldPassword, newPassword, opts.UpgradeFormat)
+
+			if err != nil {
+				return err
+			}
+
+			progress.Processed++
+			progress.LastID = record.GetID()
+
+			versionsRekeyed, err := st.rekeyVersions(txCtx, record, oldPassword, newPassword, opts.UpgradeFormat)
+
+			if err != nil {
+				return err
+			}
+
+			progress.VersionsRekeyed += versionsRekeyed
+
+			if !changed {
+				progress.Skipped++
+				continue
+			}
+
+			record.SetValue(value)
+
+			if err := st.RecordUpdate(txCtx, record); err != nil {
+				return err
+			}
+
+			progress.Rekeyed++
+
+			if upgraded {
+				progress.Upgraded++
+			}
+		}
+
+		count = len(records)
+
+		return nil
+	})
+
+	if err != nil {
+		return progress, 0, err
+	}
+
+	return progress, count, nil
+}
+
+// rekeyVersions re-encrypts the version history of a record,
+// returns the number of versions re-encrypted
+func (st *Store) rekeyVersions(ctx context.Context, record RecordInterface, oldPassword string, newPassword string, upgradeFormat bool) (int64, error) {
+	versions, err := st.versionList(ctx, record.GetID())
+
+	if err != nil {
+		return 0, err
+	}
+
+	rekeyed := int64(0)
+
+	for versionID, versionValue := range versions {
+		value, _, changed, err := st.rekeyValue(versionRecord(record, versionValue), oldPassword, newPassword, upgradeFormat)
+
+		if err != nil {
+			return rekeyed, err
+		}
+
+		if !changed {
+			continue
+		}
+
+		if err := st.versionUpdateValue(ctx, versionID, value); err != nil {
+			return rekeyed, err
+		}
+
+		rekeyed++
+	}
+
+	return rekeyed, nil
+}
+
+// rekeyValue re-encrypts the value of a record, returns the new value,
+// whether the old value was in an outdated format, and whether
+// the value should be updated
+//
+// Values encrypted with another password, and values wrapped by the
+// key provider, are reported as unchanged. Any other failure, i.e. a
+// tampered or malformed value, is returned as an error.
+func (st *Store) rekeyValue(record RecordInterface, oldPassword string, newPassword string, upgradeFormat bool) (newValue string, upgraded bool, changed bool, err error) {
+	associatedData := recordAssociatedData(record.GetID(), record.GetToken())
+
+	e, err := parseEnvelope(record.GetValue())
+
+	if err != nil {
+		return "", false, false, fmt.Errorf("rekey record %s: %w", record.GetID(), err)
+	}
+
+	// the data key is rotated by the key provider, not with a password
+	if e.Kdf == KDF_KEY_PROVIDER {
+		return "", false, false, nil
+	}
+
+	outdated := e.isOutdated(st.kdf)
+
+	plaintext, err := decode(record.GetValue(), oldPassword, associatedData)
+
+	if errors.Is(err, ErrInvalidPassword) && upgradeFormat && outdated {
+		// encrypted with the new password, but in an outdated format
+		plaintext, err = decode(record.GetValue(), newPassword, associatedData)
+	} else if err == nil && oldPassword == newPassword && (!upgradeFormat || !outdated) {
+		return "", false, false, nil
+	}
+
+	if errors.Is(err, ErrInvalidPassword) {
+		return "", false, false, nil
+	}
+
+	if err != nil {
+		return "", false, false, fmt.Errorf("rekey record %s: %w", record.GetID(), err)
+	}
+
+	encoded, err := encode(plaintext, newPassword, st.kdf, associatedData)
+
+	if err != nil {
+		return "", false, false, err
+	}
+
+	return encoded, outdated, true, nil
+}
@@ -0,0 +1,323 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func Test_Store_RekeyAll(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	values := []string{"value1", "value2", "value3", "value4", "value5"}
+	tokens := []string{}
+
+	for _, value := range values {
+		token, err := store.TokenCreate(ctx, value, "old_pass", 20)
+		if err != nil {
+			t.Fatalf("Test_Store_RekeyAll: Failed to create token: [%v]", err.Error())
+		}
+		tokens = append(tokens, token)
+	}
+
+	otherToken, err := store.TokenCreate(ctx, "other_value", "other_pass", 20)
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll: Failed to create token: [%v]", err.Error())
+	}
+
+	progressCalls := 0
+	progress, err := store.RekeyAll(ctx, "old_pass", "new_pass", RekeyOptions{
+		BatchSize: 2,
+		OnProgress: func(progress RekeyProgress) {
+			progressCalls++
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if progress.Processed != 6 || progress.Rekeyed != 5 || progress.Skipped != 1 {
+		t.Fatalf("Test_Store_RekeyAll: Unexpected progress [%+v]", progress)
+	}
+
+	if progressCalls != 3 {
+		t.Fatalf("Test_Store_RekeyAll: Expected 3 progress calls but got %d", progressCalls)
+	}
+
+	for i, token := range tokens {
+		value, err := store.TokenRead(ctx, token, "new_pass")
+		if err != nil {
+			t.Fatalf("Test_Store_RekeyAll: Expected [err] to be nil received [%v]", err.Error())
+		}
+		if value != values[i] {
+			t.Fatalf("Test_Store_RekeyAll: Expected [%v] received [%v]", values[i], value)
+		}
+
+		if _, err := store.TokenRead(ctx, token, "old_pass"); err == nil {
+			t.Fatal("Test_Store_RekeyAll: Expected old password to no longer work")
+		}
+	}
+
+	value, err := store.TokenRead(ctx, otherToken, "other_pass")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "other_value" {
+		t.Fatalf("Test_Store_RekeyAll: Expected [other_value] received [%v]", value)
+	}
+}
+
+func Test_Store_RekeyAll_Resume(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Resume: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	for _, value := range []string{"value1", "value2", "value3"} {
+		if _, err := store.TokenCreate(ctx, value, "old_pass", 20); err != nil {
+			t.Fatalf("Test_Store_RekeyAll_Resume: Failed to create token: [%v]", err.Error())
+		}
+	}
+
+	// Simulate a crash after the first batch
+	cancelCtx, cancel := context.WithCancel(ctx)
+	first, err := store.RekeyAll(cancelCtx, "old_pass", "new_pass", RekeyOptions{
+		BatchSize: 1,
+		OnProgress: func(progress RekeyProgress) {
+			cancel()
+		},
+	})
+
+	if err == nil {
+		t.Fatal("Test_Store_RekeyAll_Resume: Expected context cancelled error")
+	}
+
+	if first.Rekeyed != 1 || first.LastID == "" {
+		t.Fatalf("Test_Store_RekeyAll_Resume: Unexpected progress [%+v]", first)
+	}
+
+	second, err := store.RekeyAll(ctx, "old_pass", "new_pass", RekeyOptions{
+		BatchSize:    1,
+		StartAfterID: first.LastID,
+	})
+
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Resume: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if second.Processed != 2 || second.Rekeyed != 2 {
+		t.Fatalf("Test_Store_RekeyAll_Resume: Unexpected progress [%+v]", second)
+	}
+
+	// Running again from the start skips the records already rekeyed
+	third, err := store.RekeyAll(ctx, "old_pass", "new_pass", RekeyOptions{})
+
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Resume: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if third.Rekeyed != 0 || third.Skipped != 3 {
+		t.Fatalf("Test_Store_RekeyAll_Resume: Unexpected progress [%+v]", third)
+	}
+}
+
+func Test_Store_RekeyAll_UpgradeFormat(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	record := NewRecord().SetToken("tk_legacy").SetValue(encodeXor("legacy_value", "pass"))
+	if err := store.RecordCreate(ctx, record); err != nil {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Failed to create record: [%v]", err.Error())
+	}
+
+	// Same password without upgrade does nothing
+	progress, err := store.RekeyAll(ctx, "pass", "pass", RekeyOptions{})
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if progress.Rekeyed != 0 {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Unexpected progress [%+v]", progress)
+	}
+
+	progress, err = store.RekeyAll(ctx, "pass", "pass", RekeyOptions{UpgradeFormat: true})
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if progress.Rekeyed != 1 || progress.Upgraded != 1 {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Unexpected progress [%+v]", progress)
+	}
+
+	found, err := store.RecordFindByToken(ctx, "tk_legacy")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	e, err := parseEnvelope(found.GetValue())
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if e.Version != ENVELOPE_VERSION {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Expected version [%v] received [%v]", ENVELOPE_VERSION, e.Version)
+	}
+
+	value, err := store.TokenRead(ctx, "tk_legacy", "pass")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "legacy_value" {
+		t.Fatalf("Test_Store_RekeyAll_UpgradeFormat: Expected [legacy_value] received [%v]", value)
+	}
+}
+
+func Test_Store_RekeyAll_Versions(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Versions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "value_1", "old_pass", 20)
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Versions: Failed to create token: [%v]", err.Error())
+	}
+
+	if err := store.TokenUpdate(ctx, token, "value_2", "old_pass"); err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Versions: Failed to update token: [%v]", err.Error())
+	}
+
+	progress, err := store.RekeyAll(ctx, "old_pass", "new_pass", RekeyOptions{})
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Versions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if progress.Rekeyed != 1 || progress.VersionsRekeyed != 2 {
+		t.Fatalf("Test_Store_RekeyAll_Versions: Unexpected progress [%+v]", progress)
+	}
+
+	value, err := store.TokenReadVersion(ctx, token, 1, "new_pass")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Versions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "value_1" {
+		t.Fatalf("Test_Store_RekeyAll_Versions: Expected [value_1] received [%v]", value)
+	}
+}
+
+func Test_Store_RekeyAll_Expired(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "value_1", "old_pass", 20)
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Failed to create token: [%v]", err.Error())
+	}
+
+	if err := store.TokenUpdate(ctx, token, "value_2", "old_pass"); err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Failed to update token: [%v]", err.Error())
+	}
+
+	record, err := store.RecordFindByToken(ctx, token)
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	record.SetExpiresAt("2020-01-01 00:00:00")
+
+	if err := store.RecordUpdate(ctx, record); err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	progress, err := store.RekeyAll(ctx, "old_pass", "new_pass", RekeyOptions{})
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if progress.Rekeyed != 1 || progress.VersionsRekeyed != 2 {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Unexpected progress [%+v]", progress)
+	}
+
+	records, err := store.RecordList(ctx, RecordQuery().SetToken(token).SetExpiredInclude(true))
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(records) != 1 {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Expected [1] record received [%v]", len(records))
+	}
+
+	value, err := store.(*Store).decodeValue(ctx, records[0], "new_pass")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "value_2" {
+		t.Fatalf("Test_Store_RekeyAll_Expired: Expected [value_2] received [%v]", value)
+	}
+}
+
+func Test_Store_RekeyAll_Tampered(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Tampered: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	first, err := store.TokenCreate(ctx, "value_1", "old_pass", 20)
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Tampered: Failed to create token: [%v]", err.Error())
+	}
+
+	second, err := store.TokenCreate(ctx, "value_2", "old_pass", 20)
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Tampered: Failed to create token: [%v]", err.Error())
+	}
+
+	// copy the value of the first record into the second
+	firstRecord, err := store.RecordFindByToken(ctx, first)
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Tampered: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	secondRecord, err := store.RecordFindByToken(ctx, second)
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Tampered: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.RecordUpdate(ctx, secondRecord.SetValue(firstRecord.GetValue())); err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Tampered: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	progress, err := store.RekeyAll(ctx, "old_pass", "new_pass", RekeyOptions{})
+	if !errors.Is(err, ErrValueIntegrity) {
+		t.Fatalf("Test_Store_RekeyAll_Tampered: Expected [%v] received [%v]", ErrValueIntegrity, err)
+	}
+
+	if progress.Rekeyed != 0 {
+		t.Fatalf("Test_Store_RekeyAll_Tampered: Unexpected progress [%+v]", progress)
+	}
+
+	// the batch is rolled back, the first record keeps the old password
+	value, err := store.TokenRead(ctx, first, "old_pass")
+	if err != nil {
+		t.Fatalf("Test_Store_RekeyAll_Tampered: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "value_1" {
+		t.Fatalf("Test_Store_RekeyAll_Tampered: Expected [value_1] received [%v]", value)
+	}
+}
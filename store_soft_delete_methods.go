@@ -0,0 +1,423 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dromara/carbon/v2"
+	"github.com/gouniverse/base/database"
+	"github.com/gouniverse/sb"
+	"github.com/samber/lo"
+)
+
+// Number of records hard deleted per transaction by PurgeSoftDeleted
+const PURGE_BATCH_SIZE = 500
+
+// RecordRestoreByID restores a soft deleted record, restoring a
+// record which is not soft deleted does nothing
+//
+// # If the supplied record ID is empty, ErrEmptyRecordID is returned
+// # If the record does not exist, ErrRecordNotFound is returned
+//
+// Parameters:
+// - ctx: The context
+// - recordID: The ID of the record to restore
+//
+// Returns:
+// - err: An error if something went wrong
+func (store *Store) RecordRestoreByID(ctx context.Context, recordID string) error {
+	if recordID == "" {
+		return ErrEmptyRecordID
+	}
+
+	records, err := store.RecordList(ctx, RecordQuery().
+		SetID(recordID).
+		SetSoftDeletedInclude(true).
+		SetExpiredInclude(true).
+		SetLimit(1))
+
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return ErrRecordNotFound
+	}
+
+	return store.recordRestore(ctx, records[0])
+}
+
+// TokenRestore restores a soft deleted token, restoring a token
+// which is not soft deleted does nothing
+//
+// # If the token does not exist, ErrTokenNotFound is returned
+// # If the principal may not delete the token, a *PermissionError is returned
+//
+// Parameters:
+// - ctx: The context
+// - token: The token to restore
+//
+// Returns:
+// - err: An error if something went wrong
+func (st *Store) TokenRestore(ctx context.Context, token string) (err error) {
+	defer func() {
+		err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_RESTORE, []string{token}, err)
+	}()
+
+	if token == "" {
+		return ErrEmptyToken
+	}
+
+	records, err := st.RecordList(ctx, RecordQuery().
+		SetToken(token).
+		SetSoftDeletedInclude(true).
+		SetExpiredInclude(true).
+		SetLimit(1))
+
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return ErrTokenNotFound
+	}
+
+	if err := st.tokenAuthorize(ctx, PERMISSION_DELETE, records[0]); err != nil {
+		return err
+	}
+
+	return st.recordRestore(ctx, records[0])
+}
+
+// TokensRestore restores the soft deleted tokens, all or nothing,
+// the tokens which are not soft deleted are left as they are
+//
+// # If some tokens do not exist, a *MissingTokensError is returned
+// # If the principal may not delete a token, a *PermissionError is returned
+//
+// Parameters:
+// - ctx: The context
+// - tokens: The tokens to restore
+//
+// Returns:
+// - err: An error if something went wrong, no token is restored then
+func (st *Store) TokensRestore(ctx context.Context, tokens []string) (err error) {
+	defer func() {
+		err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_RESTORE, tokens, err)
+	}()
+
+	ids, err := st.tokensRestorable(ctx, tokens)
+
+	if err != nil {
+		return err
+	}
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	return st.runInTransaction(ctx, func(txCtx context.Context) error {
+		for _, chunk := range lo.Chunk(ids, st.batchChunkSize(1)) {
+			sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+				Update(st.vaultTableName).
+				Prepared(true).
+				Set(goqu.Record{
+					COLUMN_SOFT_DELETED_AT: sb.MAX_DATETIME,
+					COLUMN_UPDATED_AT:      now,
+					COLUMN_REVISION:        goqu.L("COALESCE(?, 0) + 1", goqu.C(COLUMN_REVISION)),
+				}).
+				Where(goqu.C(COLUMN_ID).In(chunk)).
+				ToSQL()
+
+			if err != nil {
+				return err
+			}
+
+			if st.debugEnabled {
+				log.Println(sqlStr)
+			}
+
+			if _, err := database.Execute(st.toQuerableContext(txCtx), sqlStr, sqlParams...); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// TokensRestoreCount counts the tokens TokensRestore would restore,
+// without restoring them (dry run)
+//
+// # If some tokens do not exist, a *MissingTokensError is returned
+// # If the principal may not delete a token, a *PermissionError is returned
+//
+// Parameters:
+// - ctx: The context
+// - tokens: The tokens to restore
+//
+// Returns:
+// - count: The number of tokens which are soft deleted
+// - err: An error if something went wrong
+func (st *Store) TokensRestoreCount(ctx context.Context, tokens []string) (count int64, err error) {
+	ids, err := st.tokensRestorable(ctx, tokens)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(ids)), nil
+}
+
+// tokensRestorable finds the records of the tokens, checks the principal
+// may delete each of them, and returns the IDs of the soft deleted ones
+func (st *Store) tokensRestorable(ctx context.Context, tokens []string) ([]string, error) {
+	tokens = lo.Uniq(tokens)
+
+	entries, err := st.recordsFindByTokens(ctx, tokens, RecordQuery().
+		SetSoftDeletedInclude(true).
+		SetExpiredInclude(true))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) != len(tokens) {
+		entryTokens := lo.Map(entries, func(entry RecordInterface, _ int) string {
+			return entry.GetToken()
+		})
+
+		missingTokens, _ := lo.Difference(tokens, entryTokens)
+
+		return nil, &MissingTokensError{Tokens: missingTokens}
+	}
+
+	for _, entry := range entries {
+		if err := st.tokenAuthorize(ctx, PERMISSION_DELETE, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := lo.FilterMap(entries, func(entry RecordInterface, _ int) (string, bool) {
+		return entry.GetID(), recordIsSoftDeleted(entry)
+	})
+
+	return ids, nil
+}
+
+// PurgeSoftDeleted hard deletes the records soft deleted before the
+// cutoff, together with their version history
+//
+// The records are deleted in batches of PURGE_BATCH_SIZE, each in its
+// own transaction, so a cancelled purge keeps the batches already
+// deleted. A scoped store only purges the records of its namespace.
+//
+// Parameters:
+// - ctx: The context
+// - olderThan: The minimum time since the records were soft deleted
+//
+// Returns:
+// - purged: The number of records deleted
+// - err: An error if something went wrong
+func (st *Store) PurgeSoftDeleted(ctx context.Context, olderThan time.Duration) (purged int64, err error) {
+	return st.purgeSoftDeleted(ctx, olderThan, PURGE_BATCH_SIZE)
+}
+
+// PurgeSoftDeletedCount counts the records PurgeSoftDeleted would
+// hard delete, without deleting them (dry run)
+//
+// Parameters:
+// - ctx: The context
+// - olderThan: The minimum time since the records were soft deleted
+//
+// Returns:
+// - count: The number of records soft deleted before the cutoff
+// - err: An error if something went wrong
+func (st *Store) PurgeSoftDeletedCount(ctx context.Context, olderThan time.Duration) (count int64, err error) {
+	condition, err := softDeletedBefore(olderThan)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return st.purgeCount(ctx, condition)
+}
+
+// purgeSoftDeleted hard deletes the records soft deleted before the
+// cutoff, in batches of batchSize records
+func (st *Store) purgeSoftDeleted(ctx context.Context, olderThan time.Duration, batchSize int) (purged int64, err error) {
+	condition, err := softDeletedBefore(olderThan)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return st.purgeBatches(ctx, condition, batchSize)
+}
+
+// purgeBatches hard deletes the records matching the condition, in
+// batches of batchSize records, until none is left
+func (st *Store) purgeBatches(ctx context.Context, condition goqu.Expression, batchSize int) (purged int64, err error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+
+		deleted, selected, err := st.purgeBatch(ctx, condition, batchSize)
+
+		purged += deleted
+
+		if err != nil {
+			return purged, err
+		}
+
+		if selected < batchSize {
+			return purged, nil
+		}
+	}
+}
+
+// softDeletedBefore returns the condition matching the records soft
+// deleted more than olderThan ago
+func softDeletedBefore(olderThan time.Duration) (goqu.Expression, error) {
+	if olderThan < 0 {
+		return nil, errors.New("purge age is negative: " + olderThan.String())
+	}
+
+	cutoff := carbon.CreateFromStdTime(time.Now().UTC().Add(-olderThan), carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	// records which are not soft deleted are at MAX_DATETIME
+	return goqu.C(COLUMN_SOFT_DELETED_AT).Lte(cutoff), nil
+}
+
+// purgeBatch hard deletes up to limit records matching the condition,
+// and their version history, in one transaction
+//
+// Returns the number of records deleted, and the number selected for
+// deletion, which is below the limit when no records are left
+func (st *Store) purgeBatch(ctx context.Context, condition goqu.Expression, limit int) (deleted int64, selected int, err error) {
+	if namespaceWhere := st.namespaceWhere(ctx); namespaceWhere != nil {
+		condition = goqu.And(condition, namespaceWhere)
+	}
+
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		From(st.vaultTableName).
+		Prepared(true).
+		Select(COLUMN_ID).
+		Where(condition).
+		Order(goqu.C(COLUMN_ID).Asc()).
+		Limit(uint(limit)).
+		ToSQL()
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(rows) == 0 {
+		return 0, 0, nil
+	}
+
+	ids := lo.Map(rows, func(row map[string]string, _ int) string {
+		return row[COLUMN_ID]
+	})
+
+	err = st.runInTransaction(ctx, func(txCtx context.Context) error {
+		if err := st.versionsDelete(txCtx, goqu.C(COLUMN_RECORD_ID).In(ids)); err != nil {
+			return err
+		}
+
+		// the condition is checked again, a record restored since it
+		// was selected is kept
+		sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+			Delete(st.vaultTableName).
+			Prepared(true).
+			Where(goqu.C(COLUMN_ID).In(ids), condition).
+			ToSQL()
+
+		if err != nil {
+			return err
+		}
+
+		if st.debugEnabled {
+			log.Println(sqlStr)
+		}
+
+		result, err := database.Execute(st.toQuerableContext(txCtx), sqlStr, sqlParams...)
+
+		if err != nil {
+			return err
+		}
+
+		deleted, err = result.RowsAffected()
+
+		return err
+	})
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return deleted, len(rows), nil
+}
+
+// purgeCount counts the records matching the purge condition
+func (st *Store) purgeCount(ctx context.Context, condition goqu.Expression) (int64, error) {
+	if namespaceWhere := st.namespaceWhere(ctx); namespaceWhere != nil {
+		condition = goqu.And(condition, namespaceWhere)
+	}
+
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		From(st.vaultTableName).
+		Prepared(true).
+		Select(goqu.COUNT(goqu.Star()).As("count")).
+		Where(condition).
+		ToSQL()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(rows) < 1 {
+		return 0, errors.New("count query returned no rows")
+	}
+
+	return strconv.ParseInt(rows[0]["count"], 10, 64)
+}
+
+// recordRestore restores the record if it is soft deleted
+func (store *Store) recordRestore(ctx context.Context, record RecordInterface) error {
+	if !recordIsSoftDeleted(record) {
+		return nil
+	}
+
+	record.SetSoftDeletedAt(sb.MAX_DATETIME)
+
+	return store.RecordUpdate(ctx, record)
+}
+
+// recordIsSoftDeleted returns true if the record is soft deleted
+func recordIsSoftDeleted(record RecordInterface) bool {
+	return !carbon.Parse(record.GetSoftDeletedAt(), carbon.UTC).Gt(carbon.Now(carbon.UTC))
+}
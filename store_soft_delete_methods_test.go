@@ -0,0 +1,189 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// softDeleteAt soft deletes the token, backdated to the time
+func softDeleteAt(t *testing.T, store StoreInterface, token string, softDeletedAt string) {
+	record, err := store.RecordFindByToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("RecordFindByToken: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	record.SetSoftDeletedAt(softDeletedAt)
+
+	if err := store.RecordUpdate(context.Background(), record); err != nil {
+		t.Fatalf("RecordUpdate: Expected [err] to be nil received [%v]", err.Error())
+	}
+}
+
+func Test_Store_TokenRestore(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	tokens, err := store.TokensCreate(ctx, []string{"one", "two", "three"}, "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokensCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokensSoftDelete(ctx, tokens); err != nil {
+		t.Fatalf("TokensSoftDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenRestore(ctx, tokens[0]); err != nil {
+		t.Fatalf("TokenRestore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	value, err := store.TokenRead(ctx, tokens[0], "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "one" {
+		t.Fatalf("TokenRead: Expected [one] received [%v]", value)
+	}
+
+	// restoring an active token does nothing
+	if err := store.TokenRestore(ctx, tokens[0]); err != nil {
+		t.Fatalf("TokenRestore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenRestore(ctx, "tk_missing"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenRestore: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	if err := store.TokensRestore(ctx, []string{tokens[1], "tk_missing"}); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokensRestore: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	if exists, _ := store.TokenExists(ctx, tokens[1]); exists {
+		t.Fatal("TokensRestore: Expected no token to be restored when one is missing")
+	}
+
+	if _, err := store.TokensRestoreCount(ctx, []string{tokens[1], "tk_missing"}); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokensRestoreCount: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	// the dry run counts the soft deleted tokens, without restoring them
+	restorable, err := store.TokensRestoreCount(ctx, tokens)
+	if err != nil {
+		t.Fatalf("TokensRestoreCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if restorable != 2 {
+		t.Fatalf("TokensRestoreCount: Expected [2] received [%v]", restorable)
+	}
+
+	if exists, _ := store.TokenExists(ctx, tokens[1]); exists {
+		t.Fatal("TokensRestoreCount: Expected no token to be restored")
+	}
+
+	if err := store.TokensRestore(ctx, tokens); err != nil {
+		t.Fatalf("TokensRestore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	count, err := store.RecordCount(ctx, RecordQuery())
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 3 {
+		t.Fatalf("RecordCount: Expected [3] received [%v]", count)
+	}
+
+	record, err := store.RecordFindByToken(ctx, tokens[2])
+	if err != nil {
+		t.Fatalf("RecordFindByToken: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.RecordSoftDelete(ctx, record); err != nil {
+		t.Fatalf("RecordSoftDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.RecordRestoreByID(ctx, record.GetID()); err != nil {
+		t.Fatalf("RecordRestoreByID: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if exists, _ := store.TokenExists(ctx, tokens[2]); !exists {
+		t.Fatal("RecordRestoreByID: Expected the token to be restored")
+	}
+
+	if err := store.RecordRestoreByID(ctx, "missing"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("RecordRestoreByID: Expected [%v] received [%v]", ErrRecordNotFound, err)
+	}
+}
+
+func Test_Store_PurgeSoftDeleted(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	tokens, err := store.TokensCreate(ctx, []string{"one", "two", "three", "four", "five"}, "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokensCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// three tokens deleted 40 days ago, one just now, one active
+	for _, token := range tokens[:3] {
+		softDeleteAt(t, store, token, time.Now().UTC().AddDate(0, 0, -40).Format(time.DateTime))
+	}
+
+	if err := store.TokenSoftDelete(ctx, tokens[3]); err != nil {
+		t.Fatalf("TokenSoftDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.PurgeSoftDeleted(ctx, -time.Hour); err == nil {
+		t.Fatal("PurgeSoftDeleted: Expected [err] for a negative age received [nil]")
+	}
+
+	retention := 30 * 24 * time.Hour
+
+	count, err := store.PurgeSoftDeletedCount(ctx, retention)
+	if err != nil {
+		t.Fatalf("PurgeSoftDeletedCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 3 {
+		t.Fatalf("PurgeSoftDeletedCount: Expected [3] received [%v]", count)
+	}
+
+	// batches of 2 records
+	purged, err := store.(*Store).purgeSoftDeleted(ctx, retention, 2)
+	if err != nil {
+		t.Fatalf("purgeSoftDeleted: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if purged != 3 {
+		t.Fatalf("purgeSoftDeleted: Expected [3] received [%v]", purged)
+	}
+
+	count, err = store.RecordCount(ctx, RecordQuery().SetSoftDeletedInclude(true))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 2 {
+		t.Fatalf("RecordCount: Expected [2] received [%v]", count)
+	}
+
+	purged, err = store.PurgeSoftDeleted(ctx, 0)
+	if err != nil {
+		t.Fatalf("PurgeSoftDeleted: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if purged != 1 {
+		t.Fatalf("PurgeSoftDeleted: Expected [1] received [%v]", purged)
+	}
+
+	if exists, _ := store.TokenExists(ctx, tokens[4]); !exists {
+		t.Fatal("PurgeSoftDeleted: Expected the active token to be kept")
+	}
+}
@@ -0,0 +1,668 @@
+package vaultstore
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dromara/carbon/v2"
+	"github.com/gouniverse/base/database"
+	"github.com/samber/lo"
+)
+
+// Maximum number of parameters of a prepared statement per dialect,
+// the multi-row statements are chunked to stay within them
+const BATCH_MAX_PARAMS_MSSQL = 2100
+const BATCH_MAX_PARAMS_SQLITE = 999
+const BATCH_MAX_PARAMS_DEFAULT = 65535
+
+// TokensCreate creates a token for each value, all or nothing
+//
+// The records are inserted with multi-row INSERT statements, chunked
+// to the parameter limit of the database, inside one transaction. The
+// audit entries are written in the same transaction.
+//
+// # If the tokens taken concurrently run out the retries, a *TokenCollisionError is returned
+//
+// Parameters:
+// - ctx: The context
+// - values: The values to store
+// - password: The password to use for encryption, empty to use the key provider
+// - tokenLength: The length of the tokens to generate
+//
+// Returns:
+// - tokens: The tokens, in the order of the values
+// - err: An error if something went wrong, no token is created then
+func (st *Store) TokensCreate(ctx context.Context, values []string, password string, tokenLength int) (tokens []string, err error) {
+	format := st.tokenFormat(ctx)
+	entries := make([]RecordInterface, len(values))
+
+	// the successful calls are audited in their transaction,
+	// the failed ones with the tokens generated so far
+	defer func() {
+		if err != nil {
+			generated := lo.Map(lo.Compact(entries), func(entry RecordInterface, _ int) string {
+				return entry.GetToken()
+			})
+
+			err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_CREATE, lo.Uniq(generated), err)
+		}
+	}()
+
+	for i, value := range values {
+		entries[i] = NewRecord().
+			SetOwner(PrincipalFromContext(ctx)).
+			SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+			SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+
+		st.blindIndexSet(ctx, entries[i], value)
+	}
+
+	// the entries without a free token, all of them at first
+	pending := lo.Range(len(entries))
+
+	for attempt := 1; attempt <= st.tokenCreateRetries+1; attempt++ {
+		for _, i := range pending {
+			token, err := format.generate(tokenLength)
+
+			if err != nil {
+				return []string{}, err
+			}
+
+			entries[i].SetToken(token)
+
+			// the value is bound to the token, so it is encrypted per token
+			encoded, err := st.encodeValue(ctx, entries[i], values[i], password)
+
+			if err != nil {
+				return []string{}, err
+			}
+
+			entries[i].SetValue(encoded)
+		}
+
+		pending, err = st.tokensPending(ctx, entries)
+
+		if err != nil {
+			return []string{}, err
+		}
+
+		if len(pending) > 0 {
+			continue
+		}
+
+		tokens = lo.Map(entries, func(entry RecordInterface, _ int) string {
+			return entry.GetToken()
+		})
+
+		// a savepoint inside a transaction of the caller, which remains
+		// usable after a unique violation
+		errCreate := st.runInSavepoint(ctx, func(txCtx context.Context) error {
+			if err := st.recordsCreate(txCtx, entries); err != nil {
+				return err
+			}
+
+			return st.auditLog(txCtx, AUDIT_ACTION_TOKEN_CREATE, tokens, nil)
+		})
+
+		if errCreate == nil {
+			return tokens, nil
+		}
+
+		if !isUniqueViolation(errCreate) {
+			return []string{}, errCreate
+		}
+
+		// taken concurrently, find the tokens to replace
+		pending, err = st.tokensPending(ctx, entries)
+
+		if err != nil {
+			return []string{}, err
+		}
+	}
+
+	return []string{}, &TokenCollisionError{Attempts: st.tokenCreateRetries + 1}
+}
+
+// TokensUpdate updates the values of the tokens, all or nothing
+//
+// The previous values are kept in the version history of the tokens.
+//
+// # If some tokens do not exist, a *MissingTokensError is returned
+// # If the principal may not update a token, a *PermissionError is returned
+// # If a token is updated concurrently, ErrRevisionConflict is returned
+//
+// Parameters:
+// - ctx: The context
+// - values: The new values by token
+// - password: The password to use for encryption, empty to use the key provider
+//
+// Returns:
+// - err: An error if something went wrong, no token is updated then
+func (st *Store) TokensUpdate(ctx context.Context, values map[string]string, password string) (err error) {
+	tokens := lo.Keys(values)
+
+	// the successful calls are audited in their transaction
+	defer func() {
+		if err != nil {
+			err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_UPDATE, tokens, err)
+		}
+	}()
+
+	entries, err := st.tokensFind(ctx, tokens, PERMISSION_UPDATE)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.GetValueHmac() != "" {
+			return ErrDeterministicTokenImmutable
+		}
+	}
+
+	encodedValues := map[string]string{}
+
+	for _, entry := range entries {
+		encodedValue, err := st.encodeValue(ctx, entry, values[entry.GetToken()], password)
+
+		if err != nil {
+			return err
+		}
+
+		encodedValues[entry.GetToken()] = encodedValue
+	}
+
+	return st.runInTransaction(ctx, func(txCtx context.Context) error {
+		latest, err := st.versionsLatest(txCtx, lo.Map(entries, func(entry RecordInterface, _ int) string {
+			return entry.GetID()
+		}))
+
+		if err != nil {
+			return err
+		}
+
+		versions := []goqu.Record{}
+
+		// tokens created before versioning have no history yet,
+		// their current value is saved as the first version
+		for _, entry := range entries {
+			if latest[entry.GetID()] == 0 {
+				versions = append(versions, versionRow(entry, 1))
+				latest[entry.GetID()] = 1
+			}
+		}
+
+		for _, entry := range entries {
+			entry.SetValue(encodedValues[entry.GetToken()])
+			st.blindIndexSet(txCtx, entry, values[entry.GetToken()])
+
+			latest[entry.GetID()]++
+			versions = append(versions, versionRow(entry, latest[entry.GetID()]))
+		}
+
+		if err := st.recordsUpdateValues(txCtx, entries); err != nil {
+			return err
+		}
+
+		if err := st.batchInsert(txCtx, st.vaultVersionTableName, versions); err != nil {
+			return err
+		}
+
+		if err := st.versionsPrune(txCtx, latest); err != nil {
+			return err
+		}
+
+		return st.auditLog(txCtx, AUDIT_ACTION_TOKEN_UPDATE, tokens, nil)
+	})
+}
+
+// TokensDelete hard deletes the tokens and their version history,
+// all or nothing, the tokens that do not exist are ignored
+//
+// # If the principal may not delete a token, a *PermissionError is returned
+//
+// Parameters:
+// - ctx: The context
+// - tokens: The tokens to delete
+//
+// Returns:
+// - err: An error if something went wrong, no token is deleted then
+func (st *Store) TokensDelete(ctx context.Context, tokens []string) (err error) {
+	// the successful calls are audited in their transaction
+	defer func() {
+		if err != nil {
+			err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_DELETE, tokens, err)
+		}
+	}()
+
+	if st.policyEvaluator != nil {
+		entries, err := st.recordsFindByTokens(ctx, tokens, RecordQuery().
+			SetSoftDeletedInclude(true).
+			SetExpiredInclude(true))
+
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if err := st.tokenAuthorize(ctx, PERMISSION_DELETE, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return st.runInTransaction(ctx, func(txCtx context.Context) error {
+		for _, chunk := range lo.Chunk(tokens, st.batchChunkSize(1)) {
+			condition := goqu.And(goqu.C(COLUMN_VAULT_TOKEN).In(chunk), st.tokenNamespaceWhere(txCtx))
+
+			recordIDs := goqu.Dialect(st.dbDriverName).
+				From(st.vaultTableName).
+				Select(COLUMN_ID).
+				Where(condition)
+
+			if err := st.versionsDelete(txCtx, goqu.C(COLUMN_RECORD_ID).In(recordIDs)); err != nil {
+				return err
+			}
+
+			sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+				Delete(st.vaultTableName).
+				Prepared(true).
+				Where(condition).
+				ToSQL()
+
+			if err != nil {
+				return err
+			}
+
+			if st.debugEnabled {
+				log.Println(sqlStr)
+			}
+
+			if _, err := database.Execute(st.toQuerableContext(txCtx), sqlStr, sqlParams...); err != nil {
+				return err
+			}
+		}
+
+		return st.auditLog(txCtx, AUDIT_ACTION_TOKEN_DELETE, tokens, nil)
+	})
+}
+
+// TokensSoftDelete soft deletes the tokens, all or nothing
+//
+// # If some tokens do not exist, a *MissingTokensError is returned
+// # If the principal may not delete a token, a *PermissionError is returned
+//
+// Parameters:
+// - ctx: The context
+// - tokens: The tokens to soft delete
+//
+// Returns:
+// - err: An error if something went wrong, no token is soft deleted then
+func (st *Store) TokensSoftDelete(ctx context.Context, tokens []string) (err error) {
+	// the successful calls are audited in their transaction
+	defer func() {
+		if err != nil {
+			err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_SOFT_DELETE, tokens, err)
+		}
+	}()
+
+	entries, err := st.tokensFind(ctx, tokens, PERMISSION_DELETE)
+
+	if err != nil {
+		return err
+	}
+
+	ids := lo.Map(entries, func(entry RecordInterface, _ int) string {
+		return entry.GetID()
+	})
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	return st.runInTransaction(ctx, func(txCtx context.Context) error {
+		for _, chunk := range lo.Chunk(ids, st.batchChunkSize(1)) {
+			sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+				Update(st.vaultTableName).
+				Prepared(true).
+				Set(goqu.Record{
+					COLUMN_SOFT_DELETED_AT: now,
+					COLUMN_UPDATED_AT:      now,
+					COLUMN_REVISION:        goqu.L("COALESCE(?, 0) + 1", goqu.C(COLUMN_REVISION)),
+				}).
+				Where(goqu.C(COLUMN_ID).In(chunk)).
+				ToSQL()
+
+			if err != nil {
+				return err
+			}
+
+			if st.debugEnabled {
+				log.Println(sqlStr)
+			}
+
+			if _, err := database.Execute(st.toQuerableContext(txCtx), sqlStr, sqlParams...); err != nil {
+				return err
+			}
+		}
+
+		return st.auditLog(txCtx, AUDIT_ACTION_TOKEN_SOFT_DELETE, tokens, nil)
+	})
+}
+
+// tokensFind finds the active records of the tokens, and checks the
+// principal has the permission on each of them
+func (st *Store) tokensFind(ctx context.Context, tokens []string, permission string) ([]RecordInterface, error) {
+	tokens = lo.Uniq(tokens)
+
+	entries, err := st.recordsFindByTokens(ctx, tokens, RecordQuery())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) != len(tokens) {
+		entryTokens := lo.Map(entries, func(entry RecordInterface, _ int) string {
+			return entry.GetToken()
+		})
+
+		missingTokens, _ := lo.Difference(tokens, entryTokens)
+
+		return nil, &MissingTokensError{Tokens: missingTokens}
+	}
+
+	for _, entry := range entries {
+		if err := st.tokenAuthorize(ctx, permission, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// recordsFindByTokens lists the records of the tokens matching the query, chunked
+func (st *Store) recordsFindByTokens(ctx context.Context, tokens []string, query RecordQueryInterface) ([]RecordInterface, error) {
+	entries := []RecordInterface{}
+
+	for _, chunk := range lo.Chunk(tokens, st.batchChunkSize(1)) {
+		found, err := st.RecordList(ctx, query.SetTokenIn(chunk))
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, found...)
+	}
+
+	return entries, nil
+}
+
+// tokensPending returns the indexes of the entries whose token is taken,
+// by another record or by an earlier entry of the batch
+func (st *Store) tokensPending(ctx context.Context, entries []RecordInterface) ([]int, error) {
+	tokens := lo.Map(entries, func(entry RecordInterface, _ int) string {
+		return entry.GetToken()
+	})
+
+	taken := map[string]bool{}
+
+	for _, chunk := range lo.Chunk(tokens, st.batchChunkSize(1)) {
+		sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+			From(st.vaultTableName).
+			Prepared(true).
+			Select(COLUMN_VAULT_TOKEN).
+			Where(goqu.C(COLUMN_VAULT_TOKEN).In(chunk)).
+			ToSQL()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if st.debugEnabled {
+			log.Println(sqlStr)
+		}
+
+		rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			taken[row[COLUMN_VAULT_TOKEN]] = true
+		}
+	}
+
+	pending := []int{}
+
+	for i, token := range tokens {
+		if taken[token] {
+			pending = append(pending, i)
+		}
+
+		taken[token] = true
+	}
+
+	return pending, nil
+}
+
+// recordsCreate inserts the records and their first version,
+// with multi-row INSERT statements
+func (st *Store) recordsCreate(ctx context.Context, entries []RecordInterface) error {
+	namespace, scoped := st.namespaceFromContext(ctx)
+
+	rows := []goqu.Record{}
+	versions := []goqu.Record{}
+
+	for _, entry := range entries {
+		if scoped {
+			entry.SetNamespace(namespace)
+		}
+
+		row := goqu.Record{}
+
+		for column, value := range entry.Data() {
+			row[column] = value
+		}
+
+		rows = append(rows, row)
+		versions = append(versions, versionRow(entry, 1))
+	}
+
+	if err := st.batchInsert(ctx, st.vaultTableName, rows); err != nil {
+		return err
+	}
+
+	return st.batchInsert(ctx, st.vaultVersionTableName, versions)
+}
+
+// recordsUpdateValues updates the values and blind indexes of the
+// records, with multi-row UPDATE statements using CASE expressions,
+// if the records still have the revision they were read with
+func (st *Store) recordsUpdateValues(ctx context.Context, entries []RecordInterface) error {
+	columns := map[string]func(RecordInterface) any{
+		COLUMN_VAULT_VALUE:        func(entry RecordInterface) any { return entry.GetValue() },
+		COLUMN_BLIND_INDEX:        func(entry RecordInterface) any { return entry.GetBlindIndex() },
+		COLUMN_BLIND_INDEX_PREFIX: func(entry RecordInterface) any { return entry.GetBlindIndexPrefix() },
+		COLUMN_BLIND_INDEX_SUFFIX: func(entry RecordInterface) any { return entry.GetBlindIndexSuffix() },
+		COLUMN_REVISION:           func(entry RecordInterface) any { return entry.GetRevision() + 1 },
+	}
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	// each record takes an ID and a value per column, plus the ID
+	// and revision filter
+	for _, chunk := range lo.Chunk(entries, st.batchChunkSize(2*len(columns)+2)) {
+		set := goqu.Record{COLUMN_UPDATED_AT: now}
+
+		for column, value := range columns {
+			cases := goqu.Case().Value(goqu.C(COLUMN_ID))
+
+			for _, entry := range chunk {
+				cases = cases.When(entry.GetID(), value(entry))
+			}
+
+			set[column] = cases.Else(goqu.C(column))
+		}
+
+		conditions := lo.Map(chunk, func(entry RecordInterface, _ int) goqu.Expression {
+			return goqu.And(
+				goqu.C(COLUMN_ID).Eq(entry.GetID()),
+				revisionCondition(entry.GetRevision()),
+			)
+		})
+
+		sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+			Update(st.vaultTableName).
+			Prepared(true).
+			Set(set).
+			Where(goqu.Or(conditions...)).
+			ToSQL()
+
+		if err != nil {
+			return err
+		}
+
+		if st.debugEnabled {
+			log.Println(sqlStr)
+		}
+
+		result, err := database.Execute(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		// some records were updated concurrently, the transaction is rolled back
+		if affected < int64(len(chunk)) {
+			return ErrRevisionConflict
+		}
+	}
+
+	for _, entry := range entries {
+		entry.SetRevision(entry.GetRevision() + 1)
+	}
+
+	return nil
+}
+
+// versionsLatest returns the latest version number of each record,
+// 0 for the records without versions
+func (st *Store) versionsLatest(ctx context.Context, recordIDs []string) (map[string]int, error) {
+	latest := map[string]int{}
+
+	for _, chunk := range lo.Chunk(recordIDs, st.batchChunkSize(1)) {
+		sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+			From(st.vaultVersionTableName).
+			Prepared(true).
+			Select(goqu.C(COLUMN_RECORD_ID), goqu.MAX(COLUMN_VERSION).As(COLUMN_VERSION)).
+			Where(goqu.C(COLUMN_RECORD_ID).In(chunk)).
+			GroupBy(goqu.C(COLUMN_RECORD_ID)).
+			ToSQL()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if st.debugEnabled {
+			log.Println(sqlStr)
+		}
+
+		rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			version, err := strconv.Atoi(row[COLUMN_VERSION])
+
+			if err != nil {
+				return nil, err
+			}
+
+			latest[row[COLUMN_RECORD_ID]] = version
+		}
+	}
+
+	return latest, nil
+}
+
+// versionsPrune deletes the versions exceeding the number of versions
+// kept, given the latest version of each record
+func (st *Store) versionsPrune(ctx context.Context, latest map[string]int) error {
+	if st.maxVersions < 1 {
+		return nil
+	}
+
+	// each record takes 2 parameters
+	for _, chunk := range lo.Chunk(lo.Keys(latest), st.batchChunkSize(2)) {
+		conditions := lo.Map(chunk, func(recordID string, _ int) goqu.Expression {
+			return goqu.And(
+				goqu.C(COLUMN_RECORD_ID).Eq(recordID),
+				goqu.C(COLUMN_VERSION).Lte(latest[recordID]-st.maxVersions),
+			)
+		})
+
+		if err := st.versionsDelete(ctx, goqu.Or(conditions...)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// batchInsert inserts the rows with multi-row INSERT statements,
+// chunked to the parameter limit of the database
+func (st *Store) batchInsert(ctx context.Context, table string, rows []goqu.Record) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	for _, chunk := range lo.Chunk(rows, st.batchChunkSize(len(rows[0]))) {
+		chunkRows := lo.Map(chunk, func(row goqu.Record, _ int) any {
+			return row
+		})
+
+		sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+			Insert(table).
+			Prepared(true).
+			Rows(chunkRows...).
+			ToSQL()
+
+		if err != nil {
+			return err
+		}
+
+		if st.debugEnabled {
+			log.Println(sqlStr)
+		}
+
+		if _, err := database.Execute(st.toQuerableContext(ctx), sqlStr, sqlParams...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// batchChunkSize returns the number of rows per statement, so a statement
+// with the parameters per row stays within the limit of the database
+func (st *Store) batchChunkSize(paramsPerRow int) int {
+	maxParams := BATCH_MAX_PARAMS_DEFAULT
+
+	switch st.dbDriverName {
+	case database.DATABASE_TYPE_MSSQL:
+		maxParams = BATCH_MAX_PARAMS_MSSQL
+	case database.DATABASE_TYPE_SQLITE:
+		maxParams = BATCH_MAX_PARAMS_SQLITE
+	}
+
+	// one parameter is kept for the conditions of the statement
+	return max((maxParams-1)/max(paramsPerRow, 1), 1)
+}
@@ -0,0 +1,266 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func Test_Store_TokensCreate(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.MaxVersions = 2
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	// more rows than fit in one statement with the sqlite parameter limit
+	values := []string{}
+	for i := 0; i < 150; i++ {
+		values = append(values, "value_"+strconv.Itoa(i))
+	}
+
+	tokens, err := store.TokensCreate(ctx, values, "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokensCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(tokens) != len(values) {
+		t.Fatalf("TokensCreate: Expected [%v] tokens received [%v]", len(values), len(tokens))
+	}
+
+	read, err := store.TokensRead(ctx, tokens, "test_pass")
+	if err != nil {
+		t.Fatalf("TokensRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	for i, token := range tokens {
+		if read[token] != values[i] {
+			t.Fatalf("TokensRead: Expected [%v] received [%v]", values[i], read[token])
+		}
+	}
+
+	versions, err := store.TokenVersions(ctx, tokens[149])
+	if err != nil {
+		t.Fatalf("TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(versions) != 1 {
+		t.Fatalf("TokenVersions: Expected [1] version received [%v]", len(versions))
+	}
+}
+
+func Test_Store_TokensCreate_CollisionRollback(t *testing.T) {
+	// only 2 tokens are possible, "tk_a" and "tk_b"
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.TokenFormat = TokenFormat{Alphabet: "ab", MinLength: 4, MaxLength: 4}
+		options.TokenCreateRetries = 50
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	tokens, err := store.TokensCreate(ctx, []string{"one", "two"}, "test_pass", 4)
+	if err != nil {
+		t.Fatalf("TokensCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if tokens[0] == tokens[1] {
+		t.Fatalf("TokensCreate: Expected different tokens received [%v] twice", tokens[0])
+	}
+
+	if err := store.TokensDelete(ctx, tokens[1:]); err != nil {
+		t.Fatalf("TokensDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// one token is left, so a batch of 2 cannot be created
+	tokens, err = store.TokensCreate(ctx, []string{"three", "four"}, "test_pass", 4)
+	if !errors.Is(err, ErrTokenCollision) {
+		t.Fatalf("TokensCreate: Expected [%v] received [%v]", ErrTokenCollision, err)
+	}
+	if len(tokens) != 0 {
+		t.Fatalf("TokensCreate: Expected no tokens received [%v]", tokens)
+	}
+
+	count, err := store.RecordCount(ctx, RecordQuery())
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 1 {
+		t.Fatalf("RecordCount: Expected [1] received [%v]", count)
+	}
+}
+
+func Test_Store_TokensUpdate(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.MaxVersions = 2
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	tokens, err := store.TokensCreate(ctx, []string{"one", "two", "three"}, "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokensCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	for _, suffix := range []string{"_v2", "_v3"} {
+		err = store.TokensUpdate(ctx, map[string]string{
+			tokens[0]: "one" + suffix,
+			tokens[1]: "two" + suffix,
+		}, "test_pass")
+		if err != nil {
+			t.Fatalf("TokensUpdate: Expected [err] to be nil received [%v]", err.Error())
+		}
+	}
+
+	read, err := store.TokensRead(ctx, tokens, "test_pass")
+	if err != nil {
+		t.Fatalf("TokensRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if read[tokens[0]] != "one_v3" || read[tokens[1]] != "two_v3" || read[tokens[2]] != "three" {
+		t.Fatalf("TokensRead: Unexpected values [%v]", read)
+	}
+
+	versions, err := store.TokenVersions(ctx, tokens[0])
+	if err != nil {
+		t.Fatalf("TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(versions) != 2 || versions[0].Version != 3 {
+		t.Fatalf("TokenVersions: Expected versions [2 3] received [%v]", versions)
+	}
+
+	value, err := store.TokenReadVersion(ctx, tokens[1], 2, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenReadVersion: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "two_v2" {
+		t.Fatalf("TokenReadVersion: Expected [two_v2] received [%v]", value)
+	}
+
+	// a missing token fails the whole batch
+	err = store.TokensUpdate(ctx, map[string]string{
+		tokens[2]:    "three_v2",
+		"tk_missing": "missing",
+	}, "test_pass")
+
+	var missingErr *MissingTokensError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("TokensUpdate: Expected [*MissingTokensError] received [%v]", err)
+	}
+	if len(missingErr.Tokens) != 1 || missingErr.Tokens[0] != "tk_missing" {
+		t.Fatalf("TokensUpdate: Expected missing [tk_missing] received [%v]", missingErr.Tokens)
+	}
+
+	value, err = store.TokenRead(ctx, tokens[2], "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "three" {
+		t.Fatalf("TokenRead: Expected [three] received [%v]", value)
+	}
+}
+
+func Test_Store_TokensDelete(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.MaxVersions = 2
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	tokens, err := store.TokensCreate(ctx, []string{"one", "two", "three"}, "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokensCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokensSoftDelete(ctx, []string{tokens[0], "tk_missing"}); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokensSoftDelete: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	if err := store.TokensSoftDelete(ctx, tokens[:2]); err != nil {
+		t.Fatalf("TokensSoftDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	count, err := store.RecordCount(ctx, RecordQuery())
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 1 {
+		t.Fatalf("RecordCount: Expected [1] received [%v]", count)
+	}
+
+	entry, err := store.RecordFindByToken(ctx, tokens[2])
+	if err != nil {
+		t.Fatalf("RecordFindByToken: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// missing tokens are ignored, soft deleted tokens are deleted too
+	if err := store.TokensDelete(ctx, append(tokens, "tk_missing")); err != nil {
+		t.Fatalf("TokensDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	count, err = store.RecordCount(ctx, RecordQuery().SetSoftDeletedInclude(true))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 0 {
+		t.Fatalf("RecordCount: Expected [0] received [%v]", count)
+	}
+
+	latest, err := store.(*Store).versionLatest(ctx, entry.GetID())
+	if err != nil {
+		t.Fatalf("versionLatest: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if latest != 0 {
+		t.Fatalf("versionLatest: Expected versions to be deleted received [%v]", latest)
+	}
+}
+
+func Test_Store_TokensCreate_AuditFailure(t *testing.T) {
+	// only 2 tokens are possible, "tk_a" and "tk_b"
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.TokenFormat = TokenFormat{Alphabet: "ab", MinLength: 4, MaxLength: 4}
+		options.AuditEnabled = true
+		options.AuditHmacKey = testKey(7)
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	if _, err := store.TokensCreate(ctx, []string{"one", "two"}, "test_pass", 4); err != nil {
+		t.Fatalf("TokensCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// no token is left, the failed call is audited
+	if _, err := store.TokensCreate(ctx, []string{"three"}, "test_pass", 4); !errors.Is(err, ErrTokenCollision) {
+		t.Fatalf("TokensCreate: Expected [%v] received [%v]", ErrTokenCollision, err)
+	}
+
+	failed, err := store.AuditCount(ctx, AuditQuery().
+		SetAction(AUDIT_ACTION_TOKEN_CREATE).
+		SetOutcome(AUDIT_OUTCOME_ERROR))
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if failed != 1 {
+		t.Fatalf("AuditCount: Expected [1] failed create received [%v]", failed)
+	}
+
+	if _, err := store.VerifyAuditChain(ctx); err != nil {
+		t.Fatalf("VerifyAuditChain: Expected [err] to be nil received [%v]", err.Error())
+	}
+}
@@ -3,47 +3,128 @@ package vaultstore
 import (
 	"context"
 	"errors"
-	"strings"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gouniverse/base/database"
 
 	"github.com/dromara/carbon/v2"
 	"github.com/samber/lo"
 )
 
 // TokenCreate creates a new record and returns the token
+//
+// If the password is empty and the store has a KeyProvider,
+// the value is encrypted with a data key wrapped by the provider
 func (st *Store) TokenCreate(ctx context.Context, data string, password string, tokenLength int) (token string, err error) {
-	token, err = generateToken(tokenLength)
+	return st.TokenCreateWithOptions(ctx, data, password, tokenLength, TokenCreateOptions{})
+}
+
+// TokenCreateWithOptions creates a new record and returns the token
+//
+// Parameters:
+// - ctx: The context
+// - data: The value to store
+// - password: The password to use for encryption, empty to use the key provider
+// - tokenLength: The length of the token to generate
+// - opts: The options, i.e. the expiration or read limit of the token
+//
+// Returns:
+// - token: The token of the new record
+// - err: An error if something went wrong
+func (st *Store) TokenCreateWithOptions(ctx context.Context, data string, password string, tokenLength int, opts TokenCreateOptions) (token string, err error) {
+	defer func() {
+		err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_CREATE, []string{token}, err)
+	}()
+
+	expiresAt, err := opts.expiresAt()
+
+	if err != nil {
+		return "", err
+	}
+
+	readsRemaining, err := opts.readsRemaining()
 
 	if err != nil {
 		return "", err
 	}
 
-	encodedData := encode(data, password)
+	acl, err := opts.acl()
+
+	if err != nil {
+		return "", err
+	}
+
+	metadata, err := opts.metadata()
+
+	if err != nil {
+		return "", err
+	}
+
+	owner := opts.Owner
+
+	if owner == "" {
+		owner = PrincipalFromContext(ctx)
+	}
 
 	var newEntry = NewRecord().
-		SetToken(token).
-		SetValue(encodedData).
+		SetExpiresAt(expiresAt).
+		SetReadsRemaining(readsRemaining).
+		SetOwner(owner).
+		SetAcl(acl).
+		SetMetadata(metadata).
 		SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
 		SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
 
-	err = st.RecordCreate(ctx, newEntry)
+	st.blindIndexSet(ctx, newEntry, data)
 
-	if err != nil {
-		return "", err
+	if opts.Deterministic && opts.FormatPreserving != nil {
+		return "", errors.New("a token cannot be both deterministic and format preserving")
+	}
+
+	if opts.Deterministic {
+		return st.tokenCreateDeterministic(ctx, newEntry, data, password, tokenLength)
 	}
 
-	return token, nil
+	if opts.FormatPreserving != nil {
+		return st.tokenCreateFormatPreserving(ctx, newEntry, data, password, *opts.FormatPreserving)
+	}
+
+	format := st.tokenFormat(ctx)
+
+	return st.tokenCreateWithRetry(ctx, newEntry, data, password, func() (string, error) {
+		return format.generate(tokenLength)
+	})
 }
 
 func (store *Store) TokenCreateCustom(ctx context.Context, token string, data string, password string) (err error) {
-	encodedData := encode(data, password)
+	defer func() {
+		err = store.auditLog(ctx, AUDIT_ACTION_TOKEN_CREATE, []string{token}, err)
+	}()
 
 	var newEntry = NewRecord().
 		SetToken(token).
-		SetValue(encodedData).
+		SetOwner(PrincipalFromContext(ctx)).
 		SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
 		SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
 
-	err = store.RecordCreate(ctx, newEntry)
+	store.blindIndexSet(ctx, newEntry, data)
+
+	encodedData, err := store.encodeValue(ctx, newEntry, data, password)
+
+	if err != nil {
+		return err
+	}
+
+	newEntry.SetValue(encodedData)
+
+	err = store.tokenRecordCreate(ctx, newEntry)
+
+	if isUniqueViolation(err) {
+		return ErrTokenExists
+	}
 
 	if err != nil {
 		return err
@@ -52,9 +133,25 @@ func (store *Store) TokenCreateCustom(ctx context.Context, token string, data st
 	return nil
 }
 
+// tokenRecordCreate creates the record of a new token,
+// together with the first version of its value
+//
+// Inside a transaction the record is created in a savepoint, so the
+// transaction remains usable when the token is taken.
+func (st *Store) tokenRecordCreate(ctx context.Context, entry RecordInterface) error {
+	return st.runInSavepoint(ctx, func(txCtx context.Context) error {
+		if err := st.RecordCreate(txCtx, entry); err != nil {
+			return err
+		}
+
+		return st.versionCreate(txCtx, entry)
+	})
+}
+
 // TokenDelete deletes a token from the store
 //
-// # If the supplied token is empty, an error is returned
+// # If the supplied token is empty, ErrEmptyToken is returned
+// # If the principal may not delete the token, a *PermissionError is returned
 //
 // Parameters:
 // - ctx: The context
@@ -62,9 +159,33 @@ func (store *Store) TokenCreateCustom(ctx context.Context, token string, data st
 //
 // Returns:
 // - err: An error if something went wrong
-func (st *Store) TokenDelete(ctx context.Context, token string) error {
+func (st *Store) TokenDelete(ctx context.Context, token string) (err error) {
+	defer func() {
+		err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_DELETE, []string{token}, err)
+	}()
+
 	if token == "" {
-		return errors.New("token is empty")
+		return ErrEmptyToken
+	}
+
+	if st.policyEvaluator != nil {
+		entries, err := st.RecordList(ctx, RecordQuery().
+			SetToken(token).
+			SetSoftDeletedInclude(true).
+			SetExpiredInclude(true).
+			SetLimit(1))
+
+		if err != nil {
+			return err
+		}
+
+		if len(entries) == 0 {
+			return nil
+		}
+
+		if err := st.tokenAuthorize(ctx, PERMISSION_DELETE, entries[0]); err != nil {
+			return err
+		}
 	}
 
 	return st.RecordDeleteByToken(ctx, token)
@@ -72,7 +193,9 @@ func (st *Store) TokenDelete(ctx context.Context, token string) error {
 
 // TokenExists checks if a token exists
 //
-// # If the supplied token is empty, an error is returned
+// # Expired and soft deleted tokens do not exist
+//
+// # If the supplied token is empty, ErrEmptyToken is returned
 //
 // Parameters:
 // - ctx: The context
@@ -83,7 +206,7 @@ func (st *Store) TokenDelete(ctx context.Context, token string) error {
 // - err: An error if something went wrong
 func (store *Store) TokenExists(ctx context.Context, token string) (bool, error) {
 	if token == "" {
-		return false, errors.New("token is empty")
+		return false, ErrEmptyToken
 	}
 
 	count, err := store.RecordCount(ctx, RecordQuery().SetToken(token))
@@ -97,17 +220,27 @@ func (store *Store) TokenExists(ctx context.Context, token string) (bool, error)
 
 // TokenRead retrieves the value of a token
 //
-// # If the token does not exist, an error is returned
+// # If the token does not exist, or has expired, ErrTokenNotFound is returned
+// # If the principal may not read the token, a *PermissionError is returned
+// # If the password is incorrect, ErrInvalidPassword is returned
+// # If the token is read limited and the call runs in a transaction, ErrReadLimitedInTx is returned
 //
 // Parameters:
 // - ctx: The context
 // - token: The token to retrieve
-// - password: The password to use for decryption
+// - password: The password to use for decryption, empty to use the key provider
 //
 // Returns:
 // - value: The value of the token
 // - err: An error if something went wrong
 func (st *Store) TokenRead(ctx context.Context, token string, password string) (value string, err error) {
+	// the successful calls are audited with the consumed read
+	defer func() {
+		if err != nil {
+			err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_READ, []string{token}, err)
+		}
+	}()
+
 	entry, err := st.RecordFindByToken(ctx, token)
 
 	if err != nil {
@@ -115,10 +248,34 @@ func (st *Store) TokenRead(ctx context.Context, token string, password string) (
 	}
 
 	if entry == nil {
-		return "", errors.New("token does not exist")
+		return "", ErrTokenNotFound
+	}
+
+	if err := st.tokenAuthorize(ctx, PERMISSION_READ, entry); err != nil {
+		return "", err
+	}
+
+	if err := st.tokenReadLimitedCheck(ctx, []RecordInterface{entry}); err != nil {
+		return "", err
 	}
 
-	decoded, err := decode(entry.GetValue(), password)
+	decoded, err := st.decodeValue(ctx, entry, password)
+
+	if err != nil {
+		return "", err
+	}
+
+	// the read is consumed in the transaction of its audit entry,
+	// so a failed audit write does not use up a read limited value
+	err = st.runInSavepoint(ctx, func(txCtx context.Context) error {
+		if entry.GetReadsRemaining() > 0 {
+			if err := st.tokenConsumeRead(txCtx, entry); err != nil {
+				return err
+			}
+		}
+
+		return st.auditLog(txCtx, AUDIT_ACTION_TOKEN_READ, []string{token}, nil)
+	})
 
 	if err != nil {
 		return "", err
@@ -127,12 +284,137 @@ func (st *Store) TokenRead(ctx context.Context, token string, password string) (
 	return decoded, nil
 }
 
+// tokenReadLimitedCheck returns ErrReadLimitedInTx if one of the records
+// is read limited, and the call runs in a transaction of the caller,
+// which could restore the consumed reads by rolling back
+func (st *Store) tokenReadLimitedCheck(ctx context.Context, entries []RecordInterface) error {
+	if !st.toQuerableContext(ctx).IsTx() {
+		return nil
+	}
+
+	for _, entry := range entries {
+		if entry.GetReadsRemaining() > 0 {
+			return ErrReadLimitedInTx
+		}
+	}
+
+	return nil
+}
+
+// tokenConsumeReads consumes a read of each read limited record,
+// all or nothing when run in a transaction
+//
+// # If the last read of some records was consumed by a concurrent
+// reader, a *MissingTokensError listing their tokens is returned
+func (st *Store) tokenConsumeReads(ctx context.Context, entries []RecordInterface) error {
+	consumedTokens := []string{}
+
+	for _, entry := range entries {
+		if entry.GetReadsRemaining() < 1 {
+			continue
+		}
+
+		err := st.tokenConsumeRead(ctx, entry)
+
+		if errors.Is(err, ErrTokenNotFound) {
+			consumedTokens = append(consumedTokens, entry.GetToken())
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(consumedTokens) > 0 {
+		return &MissingTokensError{Tokens: consumedTokens}
+	}
+
+	return nil
+}
+
+// tokenConsumeRead atomically decrements the reads remaining of a read
+// limited record, and deletes the record after its last read
+//
+// Concurrent readers race on the conditional decrement, only as many
+// readers as the read limit succeed, the others get ErrTokenNotFound
+func (st *Store) tokenConsumeRead(ctx context.Context, entry RecordInterface) error {
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		Update(st.vaultTableName).
+		Prepared(true).
+		Set(goqu.Record{
+			COLUMN_READS_REMAINING: goqu.L("? - 1", goqu.C(COLUMN_READS_REMAINING)),
+		}).
+		Where(
+			goqu.C(COLUMN_ID).Eq(entry.GetID()),
+			goqu.C(COLUMN_READS_REMAINING).Gt(0),
+		).
+		ToSQL()
+
+	if err != nil {
+		return err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	result, err := database.Execute(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected < 1 {
+		// the last read was consumed by a concurrent reader
+		return ErrTokenNotFound
+	}
+
+	// The record is no longer returned once its reads are exhausted,
+	// any reader may delete it, so a crash here leaves no readable record
+	sqlStr, sqlParams, err = goqu.Dialect(st.dbDriverName).
+		Delete(st.vaultTableName).
+		Prepared(true).
+		Where(
+			goqu.C(COLUMN_ID).Eq(entry.GetID()),
+			goqu.C(COLUMN_READS_REMAINING).Lte(0),
+		).
+		ToSQL()
+
+	if err != nil {
+		return err
+	}
+
+	result, err = database.Execute(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+
+	if err != nil || deleted < 1 {
+		return err
+	}
+
+	// a consumed secret must not remain readable through its history
+	return st.versionsDeleteByRecordID(ctx, entry.GetID())
+}
+
 // TokenSoftDelete soft deletes a token from the store
 //
 // Soft deleting keeps the record in the database but marks it
 // as soft deleted and soft deleted records are not returned by default
 //
-// # If the supplied token is empty, an error is returned
+// # If the supplied token is empty, ErrEmptyToken is returned
+// # If the token does not exist, ErrTokenNotFound is returned
+// # If the principal may not delete the token, a *PermissionError is returned
 //
 // Parameters:
 // - ctx: The context
@@ -140,58 +422,261 @@ func (st *Store) TokenRead(ctx context.Context, token string, password string) (
 //
 // Returns:
 // - err: An error if something went wrong
-func (st *Store) TokenSoftDelete(ctx context.Context, token string) error {
+func (st *Store) TokenSoftDelete(ctx context.Context, token string) (err error) {
+	defer func() {
+		err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_SOFT_DELETE, []string{token}, err)
+	}()
+
 	if token == "" {
-		return errors.New("token is empty")
+		return ErrEmptyToken
+	}
+
+	entry, err := st.RecordFindByToken(ctx, token)
+
+	if err != nil {
+		return err
 	}
 
-	return st.RecordSoftDeleteByToken(ctx, token)
+	if entry == nil {
+		return ErrTokenNotFound
+	}
+
+	if err := st.tokenAuthorize(ctx, PERMISSION_DELETE, entry); err != nil {
+		return err
+	}
+
+	return st.RecordSoftDelete(ctx, entry)
 }
 
 // TokenUpdate updates the value of a token
 //
-// # If the token does not exist, an error is returned
+// The previous value is kept in the version history of the token,
+// see TokenVersions, TokenReadVersion and TokenRollback
+//
+// # If the token does not exist, ErrTokenNotFound is returned
+// # If the principal may not update the token, a *PermissionError is returned
+// # If the token is updated concurrently, a *RevisionConflictError is returned
 //
 // Parameters:
 // - ctx: The context
 // - token: The token to update
 // - value: The new value
-// - password: The password to use for encryption
+// - password: The password to use for encryption, empty to use the key provider
 //
 // Returns:
 // - err: An error if something went wrong
 func (st *Store) TokenUpdate(ctx context.Context, token string, value string, password string) (err error) {
-	entry, errFind := st.RecordFindByToken(ctx, token)
+	defer func() {
+		err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_UPDATE, []string{token}, err)
+	}()
+
+	entry, err := st.tokenFindForUpdate(ctx, token)
+
+	if err != nil {
+		return err
+	}
+
+	return st.tokenUpdateValue(ctx, entry, value, password)
+}
+
+// TokenUpdateIfRevision updates the value of a token, only if the token
+// is still at the revision, a compare-and-swap for read-modify-write
+//
+// Example:
+//
+//	revision, err := store.TokenRevision(ctx, token)
+//	value, err := store.TokenRead(ctx, token, password)
+//	err = store.TokenUpdateIfRevision(ctx, token, revision, modify(value), password)
+//	if errors.Is(err, vaultstore.ErrRevisionConflict) {
+//		// updated concurrently, read again and retry
+//	}
+//
+// # If the token does not exist, ErrTokenNotFound is returned
+// # If the principal may not update the token, a *PermissionError is returned
+// # If the token is no longer at the revision, a *RevisionConflictError is returned
+//
+// Parameters:
+// - ctx: The context
+// - token: The token to update
+// - revision: The expected revision, as returned by TokenRevision
+// - value: The new value
+// - password: The password to use for encryption, empty to use the key provider
+//
+// Returns:
+// - err: An error if something went wrong
+func (st *Store) TokenUpdateIfRevision(ctx context.Context, token string, revision int, value string, password string) (err error) {
+	defer func() {
+		err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_UPDATE, []string{token}, err)
+	}()
+
+	entry, err := st.tokenFindForUpdate(ctx, token)
+
+	if err != nil {
+		return err
+	}
+
+	if entry.GetRevision() != revision {
+		return &RevisionConflictError{
+			RecordID: entry.GetID(),
+			Token:    token,
+			Revision: revision,
+		}
+	}
+
+	// the update is conditional on the revision read here
+	return st.tokenUpdateValue(ctx, entry, value, password)
+}
+
+// TokenRevision returns the revision of a token, incremented by every
+// update of the token, to pass to TokenUpdateIfRevision
+//
+// # If the token does not exist, or has expired, ErrTokenNotFound is returned
+// # If the principal may not read the token, a *PermissionError is returned
+//
+// Parameters:
+// - ctx: The context
+// - token: The token
+//
+// Returns:
+// - revision: The revision of the token
+// - err: An error if something went wrong
+func (st *Store) TokenRevision(ctx context.Context, token string) (int, error) {
+	entry, err := st.RecordFindByToken(ctx, token)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if entry == nil {
+		return 0, ErrTokenNotFound
+	}
 
-	if errFind != nil {
+	if err := st.tokenAuthorize(ctx, PERMISSION_READ, entry); err != nil {
+		return 0, err
+	}
+
+	return entry.GetRevision(), nil
+}
+
+// tokenFindForUpdate finds the record of a token whose value is updated,
+// and checks the principal may update it
+func (st *Store) tokenFindForUpdate(ctx context.Context, token string) (RecordInterface, error) {
+	entry, err := st.RecordFindByToken(ctx, token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, ErrTokenNotFound
+	}
+
+	if err := st.tokenAuthorize(ctx, PERMISSION_UPDATE, entry); err != nil {
+		return nil, err
+	}
+
+	if entry.GetValueHmac() != "" {
+		return nil, ErrDeterministicTokenImmutable
+	}
+
+	return entry, nil
+}
+
+// tokenUpdateValue encrypts and saves the new value of the record,
+// and keeps the previous value in the version history
+func (st *Store) tokenUpdateValue(ctx context.Context, entry RecordInterface, value string, password string) error {
+	encodedValue, err := st.encodeValue(ctx, entry, value, password)
+
+	if err != nil {
+		return err
+	}
+
+	return st.runInTransaction(ctx, func(txCtx context.Context) error {
+		latest, err := st.versionLatest(txCtx, entry.GetID())
+
+		if err != nil {
+			return err
+		}
+
+		// tokens created before versioning have no history yet,
+		// their current value is saved as the first version
+		if latest == 0 {
+			if err := st.versionCreate(txCtx, entry); err != nil {
+				return err
+			}
+		}
+
+		entry.SetValue(encodedValue)
+		st.blindIndexSet(txCtx, entry, value)
+
+		if err := st.RecordUpdate(txCtx, entry); err != nil {
+			return err
+		}
+
+		return st.versionCreate(txCtx, entry)
+	})
+}
+
+// TokenUpdateExpiration extends or shortens the expiration of a token
+//
+// # If the token does not exist, or has already expired, ErrTokenNotFound is returned
+//
+// Parameters:
+// - ctx: The context
+// - token: The token to update
+// - expiresAt: The new expiration time, the zero time removes the expiration
+//
+// Returns:
+// - err: An error if something went wrong
+func (st *Store) TokenUpdateExpiration(ctx context.Context, token string, expiresAt time.Time) (err error) {
+	defer func() {
+		err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_UPDATE_EXPIRATION, []string{token}, err)
+	}()
+
+	entry, err := st.RecordFindByToken(ctx, token)
+
+	if err != nil {
 		return err
 	}
 
 	if entry == nil {
-		return errors.New("token does not exist")
+		return ErrTokenNotFound
 	}
 
-	encodedValue := encode(value, password)
+	if err := st.tokenAuthorize(ctx, PERMISSION_UPDATE, entry); err != nil {
+		return err
+	}
 
-	entry.SetValue(encodedValue)
+	entry.SetExpiresAt(expirationToDateTimeString(expiresAt))
 
 	return st.RecordUpdate(ctx, entry)
 }
 
 // TokensRead reads a list of tokens, returns a map of token to value
 //
-// # If a token is not found, it is not included in the map
+// # If a token is not found, or its last read was consumed by a concurrent
+// reader, a *MissingTokensError listing the missing tokens is returned,
+// it matches ErrTokenNotFound with errors.Is, and no read is consumed
+// # If a token is read limited and the call runs in a transaction, ErrReadLimitedInTx is returned
 //
 // Parameters:
 // - ctx: The context
 // - tokens: The list of tokens to read
-// - password: The password to use for decryption
+// - password: The password to use for decryption, empty to use the key provider
 //
 // Returns:
 // - values: A map of token to value
 // - err: An error if something went wrong
 func (st *Store) TokensRead(ctx context.Context, tokens []string, password string) (values map[string]string, err error) {
+	// the successful calls are audited with the consumed reads
+	defer func() {
+		if err != nil {
+			err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_READ, tokens, err)
+		}
+	}()
+
 	values = map[string]string{}
+	tokens = lo.Uniq(tokens)
 
 	entries, err := st.RecordList(ctx, RecordQuery().SetTokenIn(tokens))
 
@@ -204,20 +689,44 @@ func (st *Store) TokensRead(ctx context.Context, tokens []string, password strin
 			return entry.GetToken()
 		})
 
-		_, missingTokens := lo.Difference(tokens, entryTokens)
+		missingTokens, _ := lo.Difference(tokens, entryTokens)
+
+		return values, &MissingTokensError{Tokens: missingTokens}
+	}
+
+	for _, entry := range entries {
+		if err := st.tokenAuthorize(ctx, PERMISSION_READ, entry); err != nil {
+			return map[string]string{}, err
+		}
+	}
 
-		return values, errors.New("missing tokens: " + strings.Join(missingTokens, ", "))
+	if err := st.tokenReadLimitedCheck(ctx, entries); err != nil {
+		return map[string]string{}, err
 	}
 
 	for _, entry := range entries {
-		decoded, err := decode(entry.GetValue(), password)
+		decoded, err := st.decodeValue(ctx, entry, password)
 
 		if err != nil {
-			return map[string]string{}, errors.New("decode error for token: " + entry.GetToken() + " : " + err.Error())
+			return map[string]string{}, fmt.Errorf("decode error for token: %s : %w", entry.GetToken(), err)
 		}
 
 		values[entry.GetToken()] = decoded
 	}
 
+	// Reads are consumed only after all values were decrypted, in one
+	// transaction with the audit entries, all or nothing
+	err = st.runInSavepoint(ctx, func(txCtx context.Context) error {
+		if err := st.tokenConsumeReads(txCtx, entries); err != nil {
+			return err
+		}
+
+		return st.auditLog(txCtx, AUDIT_ACTION_TOKEN_READ, tokens, nil)
+	})
+
+	if err != nil {
+		return map[string]string{}, err
+	}
+
 	return values, nil
 }
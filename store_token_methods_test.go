@@ -2,8 +2,10 @@ package vaultstore
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 )
 
 func Test_Store_TokenCreate(t *testing.T) {
@@ -290,7 +292,515 @@ func Test_Store_TokenSoftDelete(t *testing.T) {
 
 	// Test with non-existent token
 	err = store.TokenSoftDelete(ctx, "non_existent_token")
+	if !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Test_Store_TokenSoftDelete: Expected [%v] for non-existent token received [%v]", ErrTokenNotFound, err)
+	}
+}
+
+func Test_Store_TokenRead_SwappedValue(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_TokenRead_SwappedValue: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token1, err := store.TokenCreate(ctx, "value1", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("Test_Store_TokenRead_SwappedValue: Failed to create token: [%v]", err.Error())
+	}
+
+	token2, err := store.TokenCreate(ctx, "value2", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("Test_Store_TokenRead_SwappedValue: Failed to create token: [%v]", err.Error())
+	}
+
+	record1, err := store.RecordFindByToken(ctx, token1)
+	if err != nil {
+		t.Fatalf("Test_Store_TokenRead_SwappedValue: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	record2, err := store.RecordFindByToken(ctx, token2)
+	if err != nil {
+		t.Fatalf("Test_Store_TokenRead_SwappedValue: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// Copy the value of the first record into the second record
+	record2.SetValue(record1.GetValue())
+
+	if err := store.RecordUpdate(ctx, record2); err != nil {
+		t.Fatalf("Test_Store_TokenRead_SwappedValue: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	value, err := store.TokenRead(ctx, token2, "test_pass")
+	if !errors.Is(err, ErrValueIntegrity) {
+		t.Fatalf("Test_Store_TokenRead_SwappedValue: Expected [%v] received value [%v] err [%v]", ErrValueIntegrity, value, err)
+	}
+
+	_, err = store.TokensRead(ctx, []string{token1, token2}, "test_pass")
 	if err == nil {
-		t.Fatal("Test_Store_TokenSoftDelete: Expected error for non-existent token but got nil")
+		t.Fatal("Test_Store_TokenRead_SwappedValue: Expected TokensRead to fail for swapped value")
+	}
+}
+
+func Test_Store_Token_Errors(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_Token_Errors: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "test_val", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("Test_Store_Token_Errors: Failed to create token: [%v]", err.Error())
+	}
+
+	if _, err := store.TokenRead(ctx, "", "test_pass"); !errors.Is(err, ErrEmptyToken) {
+		t.Fatalf("TokenRead: Expected [%v] received [%v]", ErrEmptyToken, err)
+	}
+
+	if _, err := store.TokenRead(ctx, "tk_missing", "test_pass"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenRead: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	if _, err := store.TokenRead(ctx, token, "wrong_pass"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("TokenRead: Expected [%v] received [%v]", ErrInvalidPassword, err)
+	}
+
+	if err := store.TokenUpdate(ctx, "", "value", "test_pass"); !errors.Is(err, ErrEmptyToken) {
+		t.Fatalf("TokenUpdate: Expected [%v] received [%v]", ErrEmptyToken, err)
+	}
+
+	if err := store.TokenUpdate(ctx, "tk_missing", "value", "test_pass"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenUpdate: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	if err := store.TokenDelete(ctx, ""); !errors.Is(err, ErrEmptyToken) {
+		t.Fatalf("TokenDelete: Expected [%v] received [%v]", ErrEmptyToken, err)
+	}
+
+	if err := store.TokenSoftDelete(ctx, "tk_missing"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenSoftDelete: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	_, err = store.TokensRead(ctx, []string{token, "tk_missing1", "tk_missing2"}, "test_pass")
+
+	var missingErr *MissingTokensError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("TokensRead: Expected [*MissingTokensError] received [%v]", err)
+	}
+
+	if len(missingErr.Tokens) != 2 || missingErr.Tokens[0] != "tk_missing1" || missingErr.Tokens[1] != "tk_missing2" {
+		t.Fatalf("TokensRead: Expected missing tokens [tk_missing1 tk_missing2] received [%v]", missingErr.Tokens)
+	}
+
+	if !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokensRead: Expected error to match [%v]", ErrTokenNotFound)
+	}
+
+	if _, err := store.TokensRead(ctx, []string{token}, "wrong_pass"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("TokensRead: Expected [%v] received [%v]", ErrInvalidPassword, err)
+	}
+}
+
+func Test_Store_TokensRead_DuplicateTokens(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_TokensRead_DuplicateTokens: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token1, err := store.TokenCreate(ctx, "value1", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("Test_Store_TokensRead_DuplicateTokens: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	token2, err := store.TokenCreate(ctx, "value2", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("Test_Store_TokensRead_DuplicateTokens: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	values, err := store.TokensRead(ctx, []string{token1, token2, token1}, "test_pass")
+	if err != nil {
+		t.Fatalf("Test_Store_TokensRead_DuplicateTokens: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if len(values) != 2 || values[token1] != "value1" || values[token2] != "value2" {
+		t.Fatalf("Test_Store_TokensRead_DuplicateTokens: Expected both values received [%v]", values)
+	}
+}
+
+func Test_Store_TokenCreateWithOptions_Expiration(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_TokenCreateWithOptions_Expiration: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	liveToken, err := store.TokenCreateWithOptions(ctx, "live_value", "test_pass", 20, TokenCreateOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	expiredToken, err := store.TokenCreateWithOptions(ctx, "expired_value", "test_pass", 20, TokenCreateOptions{ExpiresAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokenCreateWithOptions(ctx, "value", "test_pass", 20, TokenCreateOptions{TTL: -time.Hour}); err == nil {
+		t.Fatal("TokenCreateWithOptions: Expected error for negative TTL")
+	}
+
+	value, err := store.TokenRead(ctx, liveToken, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "live_value" {
+		t.Fatalf("TokenRead: Expected [live_value] received [%v]", value)
+	}
+
+	if _, err := store.TokenRead(ctx, expiredToken, "test_pass"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenRead: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	exists, err := store.TokenExists(ctx, expiredToken)
+	if err != nil {
+		t.Fatalf("TokenExists: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if exists {
+		t.Fatal("TokenExists: Expected expired token not to exist")
+	}
+
+	if _, err := store.TokensRead(ctx, []string{liveToken, expiredToken}, "test_pass"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokensRead: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	expiredOnly, err := store.RecordList(ctx, RecordQuery().SetExpiredOnly(true))
+	if err != nil {
+		t.Fatalf("RecordList: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(expiredOnly) != 1 || expiredOnly[0].GetToken() != expiredToken {
+		t.Fatalf("RecordList: Expected only the expired token received %d records", len(expiredOnly))
+	}
+
+	expiredInclude, err := store.RecordList(ctx, RecordQuery().SetExpiredInclude(true))
+	if err != nil {
+		t.Fatalf("RecordList: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(expiredInclude) != 2 {
+		t.Fatalf("RecordList: Expected 2 records received %d", len(expiredInclude))
+	}
+}
+
+func Test_Store_TokenUpdateExpiration(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_TokenUpdateExpiration: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "test_val", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenUpdateExpiration(ctx, token, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("TokenUpdateExpiration: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	exists, err := store.TokenExists(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenExists: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if !exists {
+		t.Fatal("TokenExists: Expected token to exist after extending the expiration")
+	}
+
+	if err := store.TokenUpdateExpiration(ctx, token, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("TokenUpdateExpiration: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	exists, err = store.TokenExists(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenExists: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if exists {
+		t.Fatal("TokenExists: Expected token not to exist after shortening the expiration")
+	}
+
+	if err := store.TokenUpdateExpiration(ctx, token, time.Time{}); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenUpdateExpiration: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+}
+
+func Test_Store_TokenCreateWithOptions_MaxReads(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_TokenCreateWithOptions_MaxReads: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	if _, err := store.TokenCreateWithOptions(ctx, "value", "test_pass", 20, TokenCreateOptions{MaxReads: -1}); err == nil {
+		t.Fatal("TokenCreateWithOptions: Expected error for negative MaxReads")
+	}
+
+	oneTimeToken, err := store.TokenCreateWithOptions(ctx, "one_time_value", "test_pass", 20, TokenCreateOptions{MaxReads: 1})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// a wrong password does not consume the read
+	if _, err := store.TokenRead(ctx, oneTimeToken, "wrong_pass"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("TokenRead: Expected [%v] received [%v]", ErrInvalidPassword, err)
+	}
+
+	value, err := store.TokenRead(ctx, oneTimeToken, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "one_time_value" {
+		t.Fatalf("TokenRead: Expected [one_time_value] received [%v]", value)
+	}
+
+	if _, err := store.TokenRead(ctx, oneTimeToken, "test_pass"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenRead: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	exists, err := store.TokenExists(ctx, oneTimeToken)
+	if err != nil {
+		t.Fatalf("TokenExists: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if exists {
+		t.Fatal("TokenExists: Expected consumed token not to exist")
+	}
+
+	// the record is deleted after its last read
+	count, err := store.RecordCount(ctx, RecordQuery().SetToken(oneTimeToken).SetExpiredInclude(true).SetSoftDeletedInclude(true))
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 0 {
+		t.Fatalf("RecordCount: Expected [0] received [%v]", count)
+	}
+
+	twoReadsToken, err := store.TokenCreateWithOptions(ctx, "two_reads_value", "test_pass", 20, TokenCreateOptions{MaxReads: 2})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	unlimitedToken, err := store.TokenCreate(ctx, "unlimited_value", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	values, err := store.TokensRead(ctx, []string{twoReadsToken, unlimitedToken}, "test_pass")
+	if err != nil {
+		t.Fatalf("TokensRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if values[twoReadsToken] != "two_reads_value" || values[unlimitedToken] != "unlimited_value" {
+		t.Fatalf("TokensRead: Unexpected values [%v]", values)
+	}
+
+	if _, err := store.TokenRead(ctx, twoReadsToken, "test_pass"); err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokensRead(ctx, []string{twoReadsToken, unlimitedToken}, "test_pass"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokensRead: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.TokenRead(ctx, unlimitedToken, "test_pass"); err != nil {
+			t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+		}
+	}
+}
+
+// concurrentReadEvaluator allows every access, and reads the token once
+// while it is authorized, as a concurrent reader would
+type concurrentReadEvaluator struct {
+	store StoreInterface
+	token string
+	done  bool
+}
+
+func (e *concurrentReadEvaluator) Evaluate(ctx context.Context, principal string, permission string, record RecordInterface) (bool, error) {
+	if record.GetToken() == e.token && !e.done {
+		e.done = true
+
+		if _, err := e.store.TokenRead(context.Background(), e.token, "test_pass"); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func Test_Store_TokensRead_ConsumedConcurrently(t *testing.T) {
+	evaluator := &concurrentReadEvaluator{}
+
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.PolicyEvaluator = evaluator
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	first, err := store.TokenCreateWithOptions(ctx, "first_value", "test_pass", 20, TokenCreateOptions{MaxReads: 1})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	second, err := store.TokenCreateWithOptions(ctx, "second_value", "test_pass", 20, TokenCreateOptions{MaxReads: 1})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	evaluator.store = store
+	evaluator.token = second
+
+	values, err := store.TokensRead(ctx, []string{first, second}, "test_pass")
+
+	var missing *MissingTokensError
+	if !errors.As(err, &missing) || len(missing.Tokens) != 1 || missing.Tokens[0] != second {
+		t.Fatalf("TokensRead: Expected missing token [%v] received [%v]", second, err)
+	}
+	if len(values) != 0 {
+		t.Fatalf("TokensRead: Expected no values received [%v]", values)
+	}
+
+	// the read of the first token is rolled back with the batch
+	value, err := store.TokenRead(ctx, first, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "first_value" {
+		t.Fatalf("TokenRead: Expected [first_value] received [%v]", value)
+	}
+}
+
+func Test_Store_TokenRead_AuditFailure(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.AuditEnabled = true
+		options.AuditHmacKey = testKey(7)
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreateWithOptions(ctx, "one_time_value", "test_pass", 20, TokenCreateOptions{MaxReads: 1})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.(*Store).db.Exec("DROP TABLE " + store.GetAuditTableName()); err != nil {
+		t.Fatalf("DROP TABLE: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokenRead(ctx, token, "test_pass"); err == nil {
+		t.Fatal("TokenRead: Expected [err] when the audit entry cannot be written received [nil]")
+	}
+
+	// the read is not consumed without its audit entry
+	if err := store.AutoMigrate(); err != nil {
+		t.Fatalf("AutoMigrate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	value, err := store.TokenRead(ctx, token, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "one_time_value" {
+		t.Fatalf("TokenRead: Expected [one_time_value] received [%v]", value)
+	}
+}
+
+func Test_Store_TokenUpdateIfRevision(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "balance_100", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	revision, err := store.TokenRevision(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenRevision: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if revision != 1 {
+		t.Fatalf("TokenRevision: Expected [1] received [%v]", revision)
+	}
+
+	if err := store.TokenUpdateIfRevision(ctx, token, revision, "balance_90", "test_pass"); err != nil {
+		t.Fatalf("TokenUpdateIfRevision: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// a second writer with the same revision loses
+	err = store.TokenUpdateIfRevision(ctx, token, revision, "balance_80", "test_pass")
+
+	var conflictErr *RevisionConflictError
+	if !errors.As(err, &conflictErr) || !errors.Is(err, ErrRevisionConflict) {
+		t.Fatalf("TokenUpdateIfRevision: Expected [%v] received [%v]", ErrRevisionConflict, err)
+	}
+	if conflictErr.Token != token || conflictErr.Revision != 1 {
+		t.Fatalf("TokenUpdateIfRevision: Unexpected conflict [%v]", conflictErr)
+	}
+
+	value, err := store.TokenRead(ctx, token, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "balance_90" {
+		t.Fatalf("TokenRead: Expected [balance_90] received [%v]", value)
+	}
+
+	revision, err = store.TokenRevision(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenRevision: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if revision != 2 {
+		t.Fatalf("TokenRevision: Expected [2] received [%v]", revision)
+	}
+
+	// a record read before a concurrent update is stale
+	stale, err := store.RecordFindByToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RecordFindByToken: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenUpdate(ctx, token, "balance_70", "test_pass"); err != nil {
+		t.Fatalf("TokenUpdate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	stale.SetExpiresAt("2000-01-01 00:00:00")
+
+	if err := store.RecordUpdate(ctx, stale); !errors.Is(err, ErrRevisionConflict) {
+		t.Fatalf("RecordUpdate: Expected [%v] received [%v]", ErrRevisionConflict, err)
+	}
+
+	value, err = store.TokenRead(ctx, token, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "balance_70" {
+		t.Fatalf("TokenRead: Expected [balance_70] received [%v]", value)
+	}
+
+	if _, err := store.TokenRevision(ctx, "tk_missing"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenRevision: Expected [%v] received [%v]", ErrTokenNotFound, err)
 	}
 }
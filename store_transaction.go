@@ -0,0 +1,209 @@
+package vaultstore
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+
+	"github.com/gouniverse/base/database"
+)
+
+// Savepoint actions of savepointExec
+const SAVEPOINT_CREATE = "create"
+const SAVEPOINT_ROLLBACK = "rollback"
+const SAVEPOINT_RELEASE = "release"
+
+// WithTx runs fn with a copy of the store bound to a transaction, which
+// is committed if fn returns no error and rolled back otherwise
+//
+// All the calls of the bound store run in the transaction, whatever the
+// context passed to them. Use GetTx to run your own statements in the
+// same transaction, so they commit atomically with the vault changes.
+// The bound store must not be used after fn returns.
+//
+// Calling WithTx on a bound store, or with a context carrying a
+// transaction, nests a savepoint in the transaction instead: an error
+// rolls back to the savepoint only, and is returned to the caller.
+//
+// The audit entries of the reads, and of the calls which failed, i.e.
+// "invalid_password", are written again after a rollback, so they are
+// kept even when fn returns an error, as the values were disclosed. The
+// entries of the successful creates, updates and deletes are rolled back
+// with the changes they record.
+//
+// Read limited tokens cannot be read inside a transaction, the reads
+// return ErrReadLimitedInTx, as a rollback would restore their reads.
+//
+// The context values read by the store, i.e. WithAuditActor,
+// WithAuditPurpose, WithPrincipal and WithNamespace, must be set before
+// the context is wrapped with database.Context to join a transaction.
+//
+// Example:
+//
+//	err := store.WithTx(ctx, func(tx vaultstore.StoreInterface) error {
+//		token, err := tx.TokenCreate(ctx, "secret", password, 20)
+//		if err != nil {
+//			return err
+//		}
+//		_, err = tx.GetTx().ExecContext(ctx, "INSERT INTO cards (token) VALUES (?)", token)
+//		return err
+//	})
+//
+// Parameters:
+// - ctx: The context
+// - fn: The function to run with the bound store
+//
+// Returns:
+// - err: The error returned by fn, or an error beginning or committing the transaction
+func (st *Store) WithTx(ctx context.Context, fn func(tx StoreInterface) error) (err error) {
+	tx := st.tx
+
+	if tx == nil && database.IsQueryableContext(ctx) {
+		tx, _ = ctx.(database.QueryableContext).Queryable().(*sql.Tx)
+	}
+
+	if tx != nil {
+		return st.withSavepoint(ctx, tx, fn)
+	}
+
+	tx, err = st.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	bound := *st
+	bound.tx = tx
+	bound.txDepth = 0
+	bound.txAuditKept = &[]AuditEntryInterface{}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			st.auditRewrite(ctx, *bound.txAuditKept)
+			panic(r)
+		}
+	}()
+
+	if err := fn(&bound); err != nil {
+		_ = tx.Rollback()
+		st.auditRewrite(ctx, *bound.txAuditKept)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTx returns the transaction the store is bound to by WithTx,
+// or nil if the store is not bound to a transaction
+func (st *Store) GetTx() *sql.Tx {
+	return st.tx
+}
+
+// withSavepoint runs fn with a copy of the store bound to a savepoint
+// of the transaction, released if fn returns no error and rolled back
+// to otherwise
+func (st *Store) withSavepoint(ctx context.Context, tx *sql.Tx, fn func(tx StoreInterface) error) error {
+	bound := *st
+	bound.tx = tx
+	bound.txDepth = st.txDepth + 1
+
+	if bound.txAuditKept == nil {
+		bound.txAuditKept = &[]AuditEntryInterface{}
+	}
+
+	// the entries logged before the savepoint are not rolled back
+	kept := len(*bound.txAuditKept)
+
+	name := "vaultstore_sp_" + strconv.Itoa(bound.txDepth)
+
+	if err := st.savepointExec(ctx, tx, SAVEPOINT_CREATE, name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = st.savepointExec(ctx, tx, SAVEPOINT_ROLLBACK, name)
+			bound.auditRewrite(ctx, (*bound.txAuditKept)[kept:])
+			panic(r)
+		}
+	}()
+
+	if err := fn(&bound); err != nil {
+		if errRollback := st.savepointExec(ctx, tx, SAVEPOINT_ROLLBACK, name); errRollback != nil {
+			return errRollback
+		}
+
+		// written again in the transaction, which goes on
+		bound.auditRewrite(ctx, (*bound.txAuditKept)[kept:])
+
+		return err
+	}
+
+	return st.savepointExec(ctx, tx, SAVEPOINT_RELEASE, name)
+}
+
+// runInSavepoint runs fn in a savepoint of the transaction of the
+// context, rolled back to if fn returns an error, so the transaction
+// remains usable after a failed statement (i.e. on PostgreSQL), or in
+// a transaction of its own when the context carries no transaction
+func (st *Store) runInSavepoint(ctx context.Context, fn func(txCtx context.Context) error) error {
+	queryable := st.toQuerableContext(ctx)
+	tx, isTx := queryable.Queryable().(*sql.Tx)
+
+	if !isTx {
+		return st.runInTransaction(ctx, fn)
+	}
+
+	name := "vaultstore_sp_" + strconv.Itoa(st.txDepth+1)
+
+	if err := st.savepointExec(ctx, tx, SAVEPOINT_CREATE, name); err != nil {
+		return err
+	}
+
+	if err := fn(queryable); err != nil {
+		if errRollback := st.savepointExec(ctx, tx, SAVEPOINT_ROLLBACK, name); errRollback != nil {
+			return errRollback
+		}
+
+		return err
+	}
+
+	return st.savepointExec(ctx, tx, SAVEPOINT_RELEASE, name)
+}
+
+// savepointExec creates, rolls back to or releases the savepoint,
+// in the syntax of the dialect
+func (st *Store) savepointExec(ctx context.Context, tx *sql.Tx, action string, name string) error {
+	sqlStr := ""
+
+	if st.dbDriverName == database.DATABASE_TYPE_MSSQL {
+		switch action {
+		case SAVEPOINT_CREATE:
+			sqlStr = "SAVE TRANSACTION " + name
+		case SAVEPOINT_ROLLBACK:
+			sqlStr = "ROLLBACK TRANSACTION " + name
+		case SAVEPOINT_RELEASE:
+			// SQL Server releases the savepoints on commit
+			return nil
+		}
+	} else {
+		switch action {
+		case SAVEPOINT_CREATE:
+			sqlStr = "SAVEPOINT " + name
+		case SAVEPOINT_ROLLBACK:
+			sqlStr = "ROLLBACK TO SAVEPOINT " + name
+		case SAVEPOINT_RELEASE:
+			sqlStr = "RELEASE SAVEPOINT " + name
+		}
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	_, err := tx.ExecContext(ctx, sqlStr)
+
+	return err
+}
@@ -0,0 +1,251 @@
+package vaultstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// createCards creates the table of the domain rows written with the tokens
+func createCards(t *testing.T, store StoreInterface) *sql.DB {
+	db := store.(*Store).db
+
+	if _, err := db.Exec("CREATE TABLE cards (token TEXT)"); err != nil {
+		t.Fatalf("CREATE TABLE: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	return db
+}
+
+func countCards(t *testing.T, db *sql.DB) int {
+	count := 0
+	if err := db.QueryRow("SELECT COUNT(*) FROM cards").Scan(&count); err != nil {
+		t.Fatalf("SELECT: Expected [err] to be nil received [%v]", err.Error())
+	}
+	return count
+}
+
+func Test_Store_WithTx_Commit(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	db := createCards(t, store)
+	ctx := context.Background()
+
+	token := ""
+
+	err = store.WithTx(ctx, func(tx StoreInterface) error {
+		if tx.GetTx() == nil {
+			t.Fatal("GetTx: Expected a transaction received [nil]")
+		}
+
+		var err error
+		token, err = tx.TokenCreate(ctx, "secret", "test_pass", 20)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.GetTx().ExecContext(ctx, "INSERT INTO cards (token) VALUES (?)", token)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if store.GetTx() != nil {
+		t.Fatal("GetTx: Expected the store not to be bound to a transaction")
+	}
+
+	value, err := store.TokenRead(ctx, token, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "secret" {
+		t.Fatalf("TokenRead: Expected [secret] received [%v]", value)
+	}
+
+	if countCards(t, db) != 1 {
+		t.Fatalf("cards: Expected [1] row received [%v]", countCards(t, db))
+	}
+}
+
+func Test_Store_WithTx_Rollback(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	db := createCards(t, store)
+	ctx := context.Background()
+
+	errDomain := errors.New("domain insert failed")
+	token := ""
+
+	err = store.WithTx(ctx, func(tx StoreInterface) error {
+		var err error
+		token, err = tx.TokenCreate(ctx, "secret", "test_pass", 20)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.GetTx().ExecContext(ctx, "INSERT INTO cards (token) VALUES (?)", token); err != nil {
+			return err
+		}
+
+		return errDomain
+	})
+	if !errors.Is(err, errDomain) {
+		t.Fatalf("WithTx: Expected [%v] received [%v]", errDomain, err)
+	}
+
+	exists, err := store.TokenExists(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenExists: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if exists {
+		t.Fatal("TokenExists: Expected the token to be rolled back")
+	}
+
+	if countCards(t, db) != 0 {
+		t.Fatalf("cards: Expected [0] rows received [%v]", countCards(t, db))
+	}
+}
+
+func Test_Store_WithTx_Savepoint(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	errInner := errors.New("inner failed")
+	outerToken := ""
+	innerToken := ""
+	releasedToken := ""
+
+	err = store.WithTx(ctx, func(tx StoreInterface) error {
+		var err error
+		outerToken, err = tx.TokenCreate(ctx, "outer", "test_pass", 20)
+		if err != nil {
+			return err
+		}
+
+		err = tx.WithTx(ctx, func(inner StoreInterface) error {
+			var err error
+			innerToken, err = inner.TokenCreate(ctx, "inner", "test_pass", 20)
+			if err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Fatalf("WithTx: Expected [%v] received [%v]", errInner, err)
+		}
+
+		return tx.WithTx(ctx, func(inner StoreInterface) error {
+			var err error
+			releasedToken, err = inner.TokenCreate(ctx, "released", "test_pass", 20)
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	for token, want := range map[string]bool{outerToken: true, innerToken: false, releasedToken: true} {
+		exists, err := store.TokenExists(ctx, token)
+		if err != nil {
+			t.Fatalf("TokenExists: Expected [err] to be nil received [%v]", err.Error())
+		}
+		if exists != want {
+			t.Fatalf("TokenExists: Expected [%v] for [%v] received [%v]", want, token, exists)
+		}
+	}
+}
+
+func Test_Store_WithTx_RollbackKeepsReads(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.AuditEnabled = true
+		options.AuditHmacKey = testKey(7)
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "secret_value", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	oneTime, err := store.TokenCreateWithOptions(ctx, "one_time_value", "test_pass", 20, TokenCreateOptions{MaxReads: 1})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	errDomain := errors.New("domain error")
+
+	for i := 0; i < 3; i++ {
+		err = store.WithTx(ctx, func(tx StoreInterface) error {
+			if _, err := tx.TokenRead(ctx, oneTime, "test_pass"); !errors.Is(err, ErrReadLimitedInTx) {
+				t.Fatalf("TokenRead: Expected [%v] received [%v]", ErrReadLimitedInTx, err)
+			}
+
+			if _, err := tx.TokensRead(ctx, []string{token, oneTime}, "test_pass"); !errors.Is(err, ErrReadLimitedInTx) {
+				t.Fatalf("TokensRead: Expected [%v] received [%v]", ErrReadLimitedInTx, err)
+			}
+
+			// nested in a savepoint, rolled back with the transaction
+			return tx.WithTx(ctx, func(inner StoreInterface) error {
+				if _, err := inner.TokenRead(ctx, token, "test_pass"); err != nil {
+					return err
+				}
+
+				return errDomain
+			})
+		})
+		if !errors.Is(err, errDomain) {
+			t.Fatalf("WithTx: Expected [%v] received [%v]", errDomain, err)
+		}
+	}
+
+	// the reads of the rolled back transactions are audited
+	reads, err := store.AuditCount(ctx, AuditQuery().
+		SetAction(AUDIT_ACTION_TOKEN_READ).
+		SetToken(token).
+		SetOutcome(AUDIT_OUTCOME_SUCCESS))
+	if err != nil {
+		t.Fatalf("AuditCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if reads != 3 {
+		t.Fatalf("AuditCount: Expected [3] reads received [%v]", reads)
+	}
+
+	if _, err := store.VerifyAuditChain(ctx); err != nil {
+		t.Fatalf("VerifyAuditChain: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// the one-time token is read once, outside of a transaction
+	value, err := store.TokenRead(ctx, oneTime, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "one_time_value" {
+		t.Fatalf("TokenRead: Expected [one_time_value] received [%v]", value)
+	}
+
+	if _, err := store.TokenRead(ctx, oneTime, "test_pass"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenRead: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+}
@@ -0,0 +1,475 @@
+package vaultstore
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dromara/carbon/v2"
+	"github.com/gouniverse/base/database"
+	"github.com/gouniverse/uid"
+)
+
+// VERSION_CREATE_RETRIES is the number of retries with the next version,
+// when a concurrent update saved the same version number first
+const VERSION_CREATE_RETRIES = 3
+
+// TokenVersion describes a version of the value of a token
+type TokenVersion struct {
+	// Version is the version number, the first value is version 1
+	Version int
+	// CreatedAt is the time the version was created
+	CreatedAt string
+}
+
+// TokenVersions lists the versions kept for a token, newest first
+//
+// # If the token does not exist, ErrTokenNotFound is returned
+// # If the principal may not read the token, a *PermissionError is returned
+//
+// Parameters:
+// - ctx: The context
+// - token: The token to list the versions of
+//
+// Returns:
+// - versions: The versions, the first one is the current value
+// - err: An error if something went wrong
+func (st *Store) TokenVersions(ctx context.Context, token string) (versions []TokenVersion, err error) {
+	entry, err := st.RecordFindByToken(ctx, token)
+
+	if err != nil {
+		return []TokenVersion{}, err
+	}
+
+	if entry == nil {
+		return []TokenVersion{}, ErrTokenNotFound
+	}
+
+	if err := st.tokenAuthorize(ctx, PERMISSION_READ, entry); err != nil {
+		return []TokenVersion{}, err
+	}
+
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		From(st.vaultVersionTableName).
+		Prepared(true).
+		Select(COLUMN_VERSION, COLUMN_CREATED_AT).
+		Where(goqu.C(COLUMN_RECORD_ID).Eq(entry.GetID())).
+		Order(goqu.C(COLUMN_VERSION).Desc()).
+		ToSQL()
+
+	if err != nil {
+		return []TokenVersion{}, err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return []TokenVersion{}, err
+	}
+
+	versions = []TokenVersion{}
+
+	for _, row := range rows {
+		version, err := strconv.Atoi(row[COLUMN_VERSION])
+
+		if err != nil {
+			return []TokenVersion{}, err
+		}
+
+		versions = append(versions, TokenVersion{
+			Version:   version,
+			CreatedAt: row[COLUMN_CREATED_AT],
+		})
+	}
+
+	return versions, nil
+}
+
+// TokenReadVersion retrieves the value of a token at the given version
+//
+// # If the token does not exist, ErrTokenNotFound is returned
+// # If the version does not exist, ErrVersionNotFound is returned
+// # If the token is read limited and the call runs in a transaction, ErrReadLimitedInTx is returned
+//
+// Parameters:
+// - ctx: The context
+// - token: The token to retrieve
+// - version: The version to retrieve
+// - password: The password to use for decryption, empty to use the key provider
+//
+// Returns:
+// - value: The value of the token at the version
+// - err: An error if something went wrong
+func (st *Store) TokenReadVersion(ctx context.Context, token string, version int, password string) (value string, err error) {
+	// the successful calls are audited with the consumed read
+	defer func() {
+		if err != nil {
+			err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_READ_VERSION, []string{token}, err)
+		}
+	}()
+
+	entry, err := st.RecordFindByToken(ctx, token)
+
+	if err != nil {
+		return "", err
+	}
+
+	if entry == nil {
+		return "", ErrTokenNotFound
+	}
+
+	if err := st.tokenAuthorize(ctx, PERMISSION_READ, entry); err != nil {
+		return "", err
+	}
+
+	if err := st.tokenReadLimitedCheck(ctx, []RecordInterface{entry}); err != nil {
+		return "", err
+	}
+
+	versionRow, err := st.versionFind(ctx, entry.GetID(), version)
+
+	if err != nil {
+		return "", err
+	}
+
+	decoded, err := st.decodeValue(ctx, versionRecord(entry, versionRow[COLUMN_VAULT_VALUE]), password)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = st.runInSavepoint(ctx, func(txCtx context.Context) error {
+		if entry.GetReadsRemaining() > 0 {
+			if err := st.tokenConsumeRead(txCtx, entry); err != nil {
+				return err
+			}
+		}
+
+		return st.auditLog(txCtx, AUDIT_ACTION_TOKEN_READ_VERSION, []string{token}, nil)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return decoded, nil
+}
+
+// TokenRollback restores the value of a token to an earlier version
+//
+// The restored value is saved as a new version, so the rollback
+// itself can be undone. The password is not required, as the value
+// is restored in its encrypted form.
+//
+// # If the token does not exist, ErrTokenNotFound is returned
+// # If the version does not exist, ErrVersionNotFound is returned
+//
+// Parameters:
+// - ctx: The context
+// - token: The token to roll back
+// - version: The version to restore
+//
+// Returns:
+// - err: An error if something went wrong
+func (st *Store) TokenRollback(ctx context.Context, token string, version int) (err error) {
+	defer func() {
+		err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_ROLLBACK, []string{token}, err)
+	}()
+
+	return st.runInTransaction(ctx, func(txCtx context.Context) error {
+		entry, err := st.RecordFindByToken(txCtx, token)
+
+		if err != nil {
+			return err
+		}
+
+		if entry == nil {
+			return ErrTokenNotFound
+		}
+
+		if err := st.tokenAuthorize(txCtx, PERMISSION_UPDATE, entry); err != nil {
+			return err
+		}
+
+		if entry.GetValueHmac() != "" {
+			return ErrDeterministicTokenImmutable
+		}
+
+		versionRow, err := st.versionFind(txCtx, entry.GetID(), version)
+
+		if err != nil {
+			return err
+		}
+
+		// the blind indexes are restored with the value, they cannot be
+		// recomputed without decrypting it
+		entry.SetValue(versionRow[COLUMN_VAULT_VALUE]).
+			SetBlindIndex(versionRow[COLUMN_BLIND_INDEX]).
+			SetBlindIndexPrefix(versionRow[COLUMN_BLIND_INDEX_PREFIX]).
+			SetBlindIndexSuffix(versionRow[COLUMN_BLIND_INDEX_SUFFIX])
+
+		if err := st.RecordUpdate(txCtx, entry); err != nil {
+			return err
+		}
+
+		return st.versionCreate(txCtx, entry)
+	})
+}
+
+// versionRecord returns a copy of the record holding the value of a version,
+// the versions are bound to the record ID and token like the current value
+func versionRecord(record RecordInterface, value string) RecordInterface {
+	return NewRecordFromExistingData(map[string]string{
+		COLUMN_ID:          record.GetID(),
+		COLUMN_VAULT_TOKEN: record.GetToken(),
+		COLUMN_VAULT_VALUE: value,
+	})
+}
+
+// versionCreate saves the current value of the record as its next version,
+// and deletes the versions exceeding the number of versions kept
+//
+// A concurrent update may save the same version number first, the insert
+// then fails on the unique version of the record, and is retried with the
+// next version. Each insert runs in a savepoint, as a failed insert aborts
+// the whole transaction on some databases (PostgreSQL).
+func (st *Store) versionCreate(ctx context.Context, record RecordInterface) error {
+	latest := 0
+
+	for attempt := 1; ; attempt++ {
+		errCreate := st.runInSavepoint(ctx, func(txCtx context.Context) error {
+			var err error
+
+			latest, err = st.versionLatest(txCtx, record.GetID())
+
+			if err != nil {
+				return err
+			}
+
+			return st.versionInsert(txCtx, record, latest+1)
+		})
+
+		if errCreate == nil {
+			break
+		}
+
+		if !isUniqueViolation(errCreate) || attempt > VERSION_CREATE_RETRIES {
+			return errCreate
+		}
+	}
+
+	if st.maxVersions < 1 {
+		return nil
+	}
+
+	return st.versionsDelete(ctx, goqu.And(
+		goqu.C(COLUMN_RECORD_ID).Eq(record.GetID()),
+		goqu.C(COLUMN_VERSION).Lte(latest+1-st.maxVersions),
+	))
+}
+
+// versionInsert saves the current value of the record as the version
+func (st *Store) versionInsert(ctx context.Context, record RecordInterface, version int) error {
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		Insert(st.vaultVersionTableName).
+		Prepared(true).
+		Rows(versionRow(record, version)).
+		ToSQL()
+
+	if err != nil {
+		return err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	_, err = database.Execute(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	return err
+}
+
+// versionRow returns the version table row saving the current value of the record
+func versionRow(record RecordInterface, version int) goqu.Record {
+	return goqu.Record{
+		COLUMN_ID:                 uid.HumanUid(),
+		COLUMN_RECORD_ID:          record.GetID(),
+		COLUMN_VERSION:            version,
+		COLUMN_VAULT_VALUE:        record.GetValue(),
+		COLUMN_BLIND_INDEX:        record.GetBlindIndex(),
+		COLUMN_BLIND_INDEX_PREFIX: record.GetBlindIndexPrefix(),
+		COLUMN_BLIND_INDEX_SUFFIX: record.GetBlindIndexSuffix(),
+		COLUMN_CREATED_AT:         carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC),
+	}
+}
+
+// versionLatest returns the latest version number of the record,
+// or 0 if no versions were saved
+func (st *Store) versionLatest(ctx context.Context, recordID string) (int, error) {
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		From(st.vaultVersionTableName).
+		Prepared(true).
+		Select(goqu.MAX(COLUMN_VERSION).As(COLUMN_VERSION)).
+		Where(goqu.C(COLUMN_RECORD_ID).Eq(recordID)).
+		ToSQL()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(rows) < 1 || rows[0][COLUMN_VERSION] == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(rows[0][COLUMN_VERSION])
+}
+
+// versionFind returns the encrypted value and blind indexes of the record at the version
+func (st *Store) versionFind(ctx context.Context, recordID string, version int) (map[string]string, error) {
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		From(st.vaultVersionTableName).
+		Prepared(true).
+		Select(COLUMN_VAULT_VALUE, COLUMN_BLIND_INDEX, COLUMN_BLIND_INDEX_PREFIX, COLUMN_BLIND_INDEX_SUFFIX).
+		Where(
+			goqu.C(COLUMN_RECORD_ID).Eq(recordID),
+			goqu.C(COLUMN_VERSION).Eq(version),
+		).
+		Limit(1).
+		ToSQL()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) < 1 {
+		return nil, ErrVersionNotFound
+	}
+
+	return rows[0], nil
+}
+
+// versionList returns the versions of the record as ID to encrypted value
+func (st *Store) versionList(ctx context.Context, recordID string) (map[string]string, error) {
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		From(st.vaultVersionTableName).
+		Prepared(true).
+		Select(COLUMN_ID, COLUMN_VAULT_VALUE).
+		Where(goqu.C(COLUMN_RECORD_ID).Eq(recordID)).
+		Order(goqu.C(COLUMN_VERSION).Asc()).
+		ToSQL()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+
+	for _, row := range rows {
+		values[row[COLUMN_ID]] = row[COLUMN_VAULT_VALUE]
+	}
+
+	return values, nil
+}
+
+// versionUpdateValue replaces the encrypted value of a version, used when rekeying
+func (st *Store) versionUpdateValue(ctx context.Context, versionID string, value string) error {
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		Update(st.vaultVersionTableName).
+		Prepared(true).
+		Set(goqu.Record{COLUMN_VAULT_VALUE: value}).
+		Where(goqu.C(COLUMN_ID).Eq(versionID)).
+		ToSQL()
+
+	if err != nil {
+		return err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	_, err = database.Execute(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	return err
+}
+
+// versionsDeleteByRecordID deletes all versions of the record
+func (st *Store) versionsDeleteByRecordID(ctx context.Context, recordID string) error {
+	return st.versionsDelete(ctx, goqu.C(COLUMN_RECORD_ID).Eq(recordID))
+}
+
+// versionsDeleteByToken deletes all versions of the record with the token
+func (st *Store) versionsDeleteByToken(ctx context.Context, token string) error {
+	return st.versionsDeleteByRecords(ctx, goqu.And(goqu.C(COLUMN_VAULT_TOKEN).Eq(token), st.tokenNamespaceWhere(ctx)))
+}
+
+// versionsDeleteByRecords deletes all versions of the records matching
+// the condition, only the records of the namespace of a scoped store
+func (st *Store) versionsDeleteByRecords(ctx context.Context, condition goqu.Expression) error {
+	if namespaceWhere := st.namespaceWhere(ctx); namespaceWhere != nil {
+		condition = goqu.And(condition, namespaceWhere)
+	}
+
+	recordIDs := goqu.Dialect(st.dbDriverName).
+		From(st.vaultTableName).
+		Select(COLUMN_ID).
+		Where(condition)
+
+	return st.versionsDelete(ctx, goqu.C(COLUMN_RECORD_ID).In(recordIDs))
+}
+
+// versionsDelete deletes the versions matching the condition
+func (st *Store) versionsDelete(ctx context.Context, condition goqu.Expression) error {
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		Delete(st.vaultVersionTableName).
+		Prepared(true).
+		Where(condition).
+		ToSQL()
+
+	if err != nil {
+		return err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	_, err = database.Execute(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	return err
+}
@@ -0,0 +1,211 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func Test_Store_TokenVersions(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "value_1", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	for _, value := range []string{"value_2", "value_3"} {
+		if err := store.TokenUpdate(ctx, token, value, "test_pass"); err != nil {
+			t.Fatalf("TokenUpdate: Expected [err] to be nil received [%v]", err.Error())
+		}
+	}
+
+	versions, err := store.TokenVersions(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(versions) != 3 {
+		t.Fatalf("TokenVersions: Expected [3] versions received [%v]", len(versions))
+	}
+	if versions[0].Version != 3 || versions[2].Version != 1 {
+		t.Fatalf("TokenVersions: Expected newest first received [%v]", versions)
+	}
+	if versions[0].CreatedAt == "" {
+		t.Fatal("TokenVersions: Expected CreatedAt to be set")
+	}
+
+	value, err := store.TokenReadVersion(ctx, token, 1, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenReadVersion: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "value_1" {
+		t.Fatalf("TokenReadVersion: Expected [value_1] received [%v]", value)
+	}
+
+	if _, err := store.TokenReadVersion(ctx, token, 4, "test_pass"); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("TokenReadVersion: Expected [%v] received [%v]", ErrVersionNotFound, err)
+	}
+
+	if _, err := store.TokenVersions(ctx, "tk_missing"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenVersions: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+}
+
+func Test_Store_TokenRollback(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_TokenRollback: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "value_1", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenUpdate(ctx, token, "value_2", "test_pass"); err != nil {
+		t.Fatalf("TokenUpdate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenRollback(ctx, token, 1); err != nil {
+		t.Fatalf("TokenRollback: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	value, err := store.TokenRead(ctx, token, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "value_1" {
+		t.Fatalf("TokenRead: Expected [value_1] received [%v]", value)
+	}
+
+	// the rollback is saved as a new version
+	versions, err := store.TokenVersions(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(versions) != 3 || versions[0].Version != 3 {
+		t.Fatalf("TokenVersions: Expected [3] versions received [%v]", versions)
+	}
+
+	if err := store.TokenRollback(ctx, token, 9); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("TokenRollback: Expected [%v] received [%v]", ErrVersionNotFound, err)
+	}
+}
+
+func Test_Store_MaxVersions(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.MaxVersions = 2
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "value_1", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	for _, value := range []string{"value_2", "value_3"} {
+		if err := store.TokenUpdate(ctx, token, value, "test_pass"); err != nil {
+			t.Fatalf("TokenUpdate: Expected [err] to be nil received [%v]", err.Error())
+		}
+	}
+
+	versions, err := store.TokenVersions(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(versions) != 2 || versions[1].Version != 2 {
+		t.Fatalf("TokenVersions: Expected versions [3 2] received [%v]", versions)
+	}
+
+	if err := store.TokenRollback(ctx, token, 1); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("TokenRollback: Expected [%v] received [%v]", ErrVersionNotFound, err)
+	}
+
+	if _, err := NewStore(NewStoreOptions{VaultTableName: "vault_negative", DB: store.(*Store).db, MaxVersions: -1}); err == nil {
+		t.Fatal("NewStore: Expected error for negative MaxVersions")
+	}
+}
+
+func Test_Store_TokenDelete_DeletesVersions(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_TokenDelete_DeletesVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "value_1", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	entry, err := store.RecordFindByToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RecordFindByToken: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if err := store.TokenDelete(ctx, token); err != nil {
+		t.Fatalf("TokenDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	latest, err := store.(*Store).versionLatest(ctx, entry.GetID())
+	if err != nil {
+		t.Fatalf("versionLatest: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if latest != 0 {
+		t.Fatalf("versionLatest: Expected versions to be deleted received [%v]", latest)
+	}
+}
+
+func Test_Store_Versions_UniqueVersion(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("Test_Store_Versions_UniqueVersion: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	// the indexes are created with the tables, a second run does not recreate them
+	if err := store.AutoMigrate(); err != nil {
+		t.Fatalf("AutoMigrate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	token, err := store.TokenCreate(ctx, "value_1", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	entry, err := store.RecordFindByToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RecordFindByToken: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// a concurrent update saving the same version number is rejected
+	err = store.(*Store).versionInsert(ctx, entry, 1)
+	if !isUniqueViolation(err) {
+		t.Fatalf("versionInsert: Expected a unique violation received [%v]", err)
+	}
+
+	if err := store.TokenUpdate(ctx, token, "value_2", "test_pass"); err != nil {
+		t.Fatalf("TokenUpdate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	versions, err := store.TokenVersions(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenVersions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(versions) != 2 || versions[0].Version != 2 {
+		t.Fatalf("TokenVersions: Unexpected versions [%v]", versions)
+	}
+}
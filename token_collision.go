@@ -0,0 +1,123 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// TOKEN_CREATE_RETRIES_DEFAULT is the default number of retries with a
+// fresh token, when the generated token is already taken
+const TOKEN_CREATE_RETRIES_DEFAULT = 3
+
+// tokenCreateWithRetry creates the record with a generated token, and
+// retries with a fresh token while the token is already taken
+//
+// Business logic:
+//  1. A token is generated, and the value encrypted, as it is bound to the token
+//  2. The record is inserted
+//  3. If the insert fails with a unique violation, or the token turns out
+//     to be taken, a fresh token is generated, up to the store retries
+//  4. When the retries run out, a *TokenCollisionError is returned
+//
+// Inside a transaction of the caller, each insert runs in a savepoint,
+// which is rolled back to on a collision, as a failed insert aborts the
+// whole transaction on some databases (PostgreSQL).
+func (st *Store) tokenCreateWithRetry(ctx context.Context, newEntry RecordInterface, data string, password string, generate func() (string, error)) (string, error) {
+	attempts := st.tokenCreateRetries + 1
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		token, err := generate()
+
+		if err != nil {
+			return "", err
+		}
+
+		newEntry.SetToken(token)
+
+		encodedData, err := st.encodeValue(ctx, newEntry, data, password)
+
+		if err != nil {
+			return "", err
+		}
+
+		newEntry.SetValue(encodedData)
+
+		errCreate := st.tokenRecordCreate(ctx, newEntry)
+
+		if errCreate == nil {
+			return token, nil
+		}
+
+		collided, err := st.tokenCollided(ctx, token, errCreate)
+
+		if err != nil {
+			return "", err
+		}
+
+		if !collided {
+			return "", errCreate
+		}
+	}
+
+	return "", &TokenCollisionError{Attempts: attempts}
+}
+
+// tokenCollided returns true if the insert failed because the token is
+// taken, drivers with unrecognized errors fall back to looking it up
+func (st *Store) tokenCollided(ctx context.Context, token string, errCreate error) (bool, error) {
+	if isUniqueViolation(errCreate) {
+		return true, nil
+	}
+
+	taken, err := st.tokenTaken(ctx, token)
+
+	if err != nil {
+		return false, errCreate
+	}
+
+	return taken, nil
+}
+
+// sqlStateError is implemented by the PostgreSQL errors of pgx
+type sqlStateError interface {
+	SQLState() string
+}
+
+// isUniqueViolation returns true if the error is a unique constraint
+// violation, recognized for SQLite, MySQL, PostgreSQL and SQL Server,
+// without depending on their drivers
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// PostgreSQL (pgx)
+	var stateErr sqlStateError
+	if errors.As(err, &stateErr) && stateErr.SQLState() == "23505" {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+
+	for _, pattern := range []string{
+		// SQLite (modernc, mattn), extended codes 2067 and 1555
+		"unique constraint failed",
+		// MySQL and MariaDB, error 1062
+		"error 1062",
+		"duplicate entry",
+		// PostgreSQL (lib/pq, pgx), SQLSTATE 23505
+		"duplicate key value violates unique constraint",
+		"sqlstate 23505",
+		// SQL Server, errors 2627 and 2601
+		"violation of unique key constraint",
+		"violation of primary key constraint",
+		"cannot insert duplicate key",
+	} {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,147 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type sqlStateTestError struct {
+	state string
+}
+
+func (e sqlStateTestError) Error() string {
+	return "ERROR: duplicate (SQLSTATE " + e.state + ")"
+}
+
+func (e sqlStateTestError) SQLState() string {
+	return e.state
+}
+
+func Test_isUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"other error", errors.New("no such table: vault"), false},
+		{"sqlite", errors.New("constraint failed: UNIQUE constraint failed: vault.vault_token (2067)"), true},
+		{"mysql", errors.New("Error 1062 (23000): Duplicate entry 'tk_abc' for key 'vault_token'"), true},
+		{"postgres lib/pq", errors.New(`pq: duplicate key value violates unique constraint "vault_vault_token_key"`), true},
+		{"postgres pgx", sqlStateTestError{state: "23505"}, true},
+		{"postgres pgx other state", sqlStateTestError{state: "23503"}, false},
+		{"sqlserver", errors.New("mssql: Violation of UNIQUE KEY constraint 'UQ_vault'. Cannot insert duplicate key in object 'dbo.vault'."), true},
+		{"sqlserver index", errors.New("mssql: Cannot insert duplicate key row in object 'dbo.vault' with unique index 'IX_vault'."), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUniqueViolation(tt.err); got != tt.want {
+				t.Errorf("isUniqueViolation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Store_TokenCreate_CollisionRetry(t *testing.T) {
+	// only 2 tokens are possible, "tk_a" and "tk_b"
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.TokenFormat = TokenFormat{Alphabet: "ab", MinLength: 4, MaxLength: 4}
+		options.TokenCreateRetries = 50
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	first, err := store.TokenCreate(ctx, "one", "test_pass", 4)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	second, err := store.TokenCreate(ctx, "two", "test_pass", 4)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if first == second {
+		t.Fatalf("TokenCreate: Expected different tokens received [%v] twice", first)
+	}
+
+	value, err := store.TokenRead(ctx, second, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "two" {
+		t.Fatalf("TokenRead: Expected [two] received [%v]", value)
+	}
+
+	_, err = store.TokenCreate(ctx, "three", "test_pass", 4)
+
+	var collisionErr *TokenCollisionError
+	if !errors.As(err, &collisionErr) || !errors.Is(err, ErrTokenCollision) {
+		t.Fatalf("TokenCreate: Expected [%v] received [%v]", ErrTokenCollision, err)
+	}
+	if collisionErr.Attempts != 51 {
+		t.Fatalf("TokenCreate: Expected [51] attempts received [%v]", collisionErr.Attempts)
+	}
+
+	if err := store.TokenCreateCustom(ctx, first, "four", "test_pass"); !errors.Is(err, ErrTokenExists) {
+		t.Fatalf("TokenCreateCustom: Expected [%v] received [%v]", ErrTokenExists, err)
+	}
+}
+
+func Test_Store_TokenCreate_CollisionRetryInTransaction(t *testing.T) {
+	// only 2 tokens are possible, "tk_a" and "tk_b"
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.TokenFormat = TokenFormat{Alphabet: "ab", MinLength: 4, MaxLength: 4}
+		options.TokenCreateRetries = 50
+		options.Kdf = KdfOptions{Algorithm: KDF_SCRYPT, ScryptN: 1024}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	first, err := store.TokenCreate(ctx, "one", "test_pass", 4)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	tokens := []string{}
+
+	// the collisions roll back to a savepoint, the transaction goes on
+	err = store.WithTx(ctx, func(tx StoreInterface) error {
+		second, err := tx.TokenCreate(ctx, "two", "test_pass", 4)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.TokensCreate(ctx, []string{"three"}, "test_pass", 4); !errors.Is(err, ErrTokenCollision) {
+			t.Fatalf("TokensCreate: Expected [%v] received [%v]", ErrTokenCollision, err)
+		}
+
+		if err := tx.TokenCreateCustom(ctx, first, "four", "test_pass"); !errors.Is(err, ErrTokenExists) {
+			t.Fatalf("TokenCreateCustom: Expected [%v] received [%v]", ErrTokenExists, err)
+		}
+
+		tokens = append(tokens, first, second)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	values, err := store.TokensRead(ctx, tokens, "test_pass")
+	if err != nil {
+		t.Fatalf("TokensRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if values[tokens[0]] != "one" || values[tokens[1]] != "two" {
+		t.Fatalf("TokensRead: Expected [one two] received [%v]", values)
+	}
+}
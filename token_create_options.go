@@ -0,0 +1,109 @@
+package vaultstore
+
+import (
+	"errors"
+	"path"
+	"time"
+
+	"github.com/dromara/carbon/v2"
+	"github.com/gouniverse/sb"
+)
+
+// TokenCreateOptions define the options for creating a new token
+type TokenCreateOptions struct {
+	// ExpiresAt is the absolute time the token expires at,
+	// takes precedence over TTL
+	ExpiresAt time.Time
+
+	// TTL is the time to live of the token, counted from now
+	TTL time.Duration
+
+	// MaxReads is the number of times the token can be read, after the
+	// last read it is deleted. Use 1 for burn after reading, 0 for unlimited.
+	MaxReads int
+
+	// Owner is the principal owning the token, it has all permissions
+	// on the token. Defaults to the principal of the context.
+	Owner string
+
+	// Acl grants other principals permissions on the token
+	Acl []AclEntry
+
+	// Metadata is the non-secret metadata of the token, i.e. its
+	// labels {"kind": "api_key", "user_id": "123"}, saved in plain text
+	Metadata map[string]string
+
+	// Deterministic derives the token from the keyed HMAC of the value,
+	// so the same value always gets the same token, and creating a token
+	// for an already tokenized value returns the existing token.
+	// Requires NewStoreOptions.DeterministicKey.
+	Deterministic bool
+
+	// FormatPreserving generates a token with the format of the value,
+	// i.e. 16 digits for a card number, the token length is ignored.
+	// Cannot be combined with Deterministic.
+	FormatPreserving *FormatPreservingOptions
+}
+
+// metadata returns the metadata of the new token
+func (o TokenCreateOptions) metadata() (map[string]string, error) {
+	for key := range o.Metadata {
+		if key == "" {
+			return nil, errors.New("metadata: key cannot be empty")
+		}
+	}
+
+	return o.Metadata, nil
+}
+
+// acl returns the access control list of the new token
+func (o TokenCreateOptions) acl() ([]AclEntry, error) {
+	for _, entry := range o.Acl {
+		if _, err := path.Match(entry.Principal, ""); err != nil || entry.Principal == "" {
+			return nil, errors.New("acl: malformed principal pattern: " + entry.Principal)
+		}
+	}
+
+	return o.Acl, nil
+}
+
+// readsRemaining returns the reads remaining for the new token
+func (o TokenCreateOptions) readsRemaining() (int, error) {
+	if o.MaxReads < 0 {
+		return 0, errors.New("max reads cannot be negative")
+	}
+
+	if o.MaxReads == 0 {
+		return READS_UNLIMITED, nil
+	}
+
+	return o.MaxReads, nil
+}
+
+// expiresAt returns the expiration as a UTC datetime string,
+// tokens without an expiration expire at MAX_DATETIME
+func (o TokenCreateOptions) expiresAt() (string, error) {
+	if o.TTL < 0 {
+		return "", errors.New("ttl cannot be negative")
+	}
+
+	if !o.ExpiresAt.IsZero() {
+		return expirationToDateTimeString(o.ExpiresAt), nil
+	}
+
+	if o.TTL > 0 {
+		return expirationToDateTimeString(time.Now().Add(o.TTL)), nil
+	}
+
+	return sb.MAX_DATETIME, nil
+}
+
+// expirationToDateTimeString converts an expiration time to a UTC
+// datetime string, the zero time means the token never expires
+func expirationToDateTimeString(expiresAt time.Time) string {
+	if expiresAt.IsZero() {
+		return sb.MAX_DATETIME
+	}
+
+	return carbon.CreateFromStdTime(expiresAt.UTC(), carbon.UTC).ToDateTimeString(carbon.UTC)
+}
@@ -0,0 +1,207 @@
+package vaultstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// DETERMINISTIC_TOKEN_MIN_LENGTH is the minimum length of a deterministic
+// token, shorter tokens make collisions between values likely
+const DETERMINISTIC_TOKEN_MIN_LENGTH = 20
+
+// TokenFindByValue finds the deterministic token of a value, without
+// storing or comparing the plaintext, only its keyed HMAC
+//
+// # If the store has no DeterministicKey, ErrDeterministicKeyRequired is returned
+// # If no active deterministic token holds the value, ErrTokenNotFound is returned
+// # If the principal may not read the token, a *PermissionError without the token is returned
+//
+// Parameters:
+// - ctx: The context
+// - value: The value to find the token of
+//
+// Returns:
+// - token: The deterministic token of the value
+// - err: An error if something went wrong
+func (st *Store) TokenFindByValue(ctx context.Context, value string) (token string, err error) {
+	defer func() {
+		err = st.auditLog(ctx, AUDIT_ACTION_TOKEN_FIND_BY_VALUE, []string{token}, err)
+	}()
+
+	valueHmac, err := st.deterministicValueHmac(ctx, value)
+
+	if err != nil {
+		return "", err
+	}
+
+	records, err := st.RecordList(ctx, RecordQuery().SetValueHmac(valueHmac).SetLimit(1))
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(records) < 1 {
+		return "", ErrTokenNotFound
+	}
+
+	if err := st.tokenAuthorizeByValue(ctx, records[0]); err != nil {
+		return "", err
+	}
+
+	return records[0].GetToken(), nil
+}
+
+// tokenAuthorizeByValue checks that the principal of the context may read
+// the token found by its value, the denial does not disclose the token
+func (st *Store) tokenAuthorizeByValue(ctx context.Context, record RecordInterface) error {
+	err := st.tokenAuthorize(ctx, PERMISSION_READ, record)
+
+	var denied *PermissionError
+
+	if errors.As(err, &denied) {
+		return &PermissionError{
+			Principal:  denied.Principal,
+			Permission: denied.Permission,
+		}
+	}
+
+	return err
+}
+
+// tokenCreateDeterministic creates the deterministic token of the value,
+// or returns the existing token if the value was already tokenized
+//
+// Business logic:
+//  1. The token is derived from the HMAC of the namespace and value,
+//     in the token format of the namespace
+//  2. If a record holds the HMAC, and the principal may read it, its token
+//     is returned as is, the password and options of the call are ignored
+//  3. If the record is soft deleted or expired, an error is returned,
+//     it must be restored or purged before the value is tokenized again
+//  4. Otherwise a new record is created, keeping the HMAC for lookups
+//  5. If the token is taken meanwhile, the token of a concurrent create
+//     of the value is returned, else a *TokenCollisionError
+func (st *Store) tokenCreateDeterministic(ctx context.Context, newEntry RecordInterface, data string, password string, tokenLength int) (string, error) {
+	if tokenLength < DETERMINISTIC_TOKEN_MIN_LENGTH {
+		return "", errors.New("deterministic token length must be at least " + strconv.Itoa(DETERMINISTIC_TOKEN_MIN_LENGTH))
+	}
+
+	valueHmac, err := st.deterministicValueHmac(ctx, data)
+
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := st.RecordList(ctx, RecordQuery().
+		SetValueHmac(valueHmac).
+		SetSoftDeletedInclude(true).
+		SetExpiredInclude(true).
+		SetLimit(1))
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(existing) > 0 {
+		if err := st.tokenAuthorizeByValue(ctx, existing[0]); err != nil {
+			return "", err
+		}
+
+		if !recordIsActive(existing[0]) {
+			return "", errors.New("deterministic token is soft deleted or expired: " + existing[0].GetToken())
+		}
+
+		return existing[0].GetToken(), nil
+	}
+
+	mac, err := hex.DecodeString(valueHmac)
+
+	if err != nil {
+		return "", err
+	}
+
+	token, err := st.tokenFormat(ctx).derive(mac, tokenLength)
+
+	if err != nil {
+		return "", err
+	}
+
+	newEntry.SetToken(token).SetValueHmac(valueHmac)
+
+	encodedData, err := st.encodeValue(ctx, newEntry, data, password)
+
+	if err != nil {
+		return "", err
+	}
+
+	newEntry.SetValue(encodedData)
+
+	errCreate := st.tokenRecordCreate(ctx, newEntry)
+
+	if errCreate == nil {
+		return token, nil
+	}
+
+	if !isUniqueViolation(errCreate) {
+		return "", errCreate
+	}
+
+	// the value was tokenized concurrently, or the token of another value
+	// has the same prefix, the tokens cannot be retried, as they are derived
+	existing, err = st.RecordList(ctx, RecordQuery().SetValueHmac(valueHmac).SetLimit(1))
+
+	if err != nil || len(existing) < 1 {
+		return "", &TokenCollisionError{Attempts: 1}
+	}
+
+	if err := st.tokenAuthorizeByValue(ctx, existing[0]); err != nil {
+		return "", err
+	}
+
+	return existing[0].GetToken(), nil
+}
+
+// deterministicValueHmac returns the hex HMAC-SHA256 of the value under
+// the deterministic key, scoped to the namespace of the call, so the
+// same value has different tokens in different namespaces
+func (st *Store) deterministicValueHmac(ctx context.Context, value string) (string, error) {
+	if len(st.deterministicKey) == 0 {
+		return "", ErrDeterministicKeyRequired
+	}
+
+	namespace, _ := st.namespaceFromContext(ctx)
+
+	mac := hmac.New(sha256.New, st.deterministicKey)
+
+	// length prefixed, so the namespace and value cannot run into each other
+	length := make([]byte, 8)
+	binary.BigEndian.PutUint64(length, uint64(len(namespace)))
+	mac.Write(length)
+	mac.Write([]byte(namespace))
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// recordIsActive returns true if the record is neither soft deleted nor expired
+func recordIsActive(record RecordInterface) bool {
+	now := carbon.Now(carbon.UTC)
+
+	if recordIsSoftDeleted(record) {
+		return false
+	}
+
+	// records without an expiration (NULL) never expire
+	if record.GetExpiresAt() != "" && !carbon.Parse(record.GetExpiresAt(), carbon.UTC).Gt(now) {
+		return false
+	}
+
+	return record.GetReadsRemaining() != 0
+}
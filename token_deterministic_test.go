@@ -0,0 +1,201 @@
+package vaultstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_Store_TokenCreate_Deterministic(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.DeterministicKey = []byte("0123456789abcdef0123456789abcdef")
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+	opts := TokenCreateOptions{Deterministic: true}
+
+	token, err := store.TokenCreateWithOptions(ctx, "jane@example.com", "test_pass", 30, opts)
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if len(token) != 30 || !strings.HasPrefix(token, TOKEN_PREFIX) {
+		t.Fatalf("TokenCreateWithOptions: Unexpected token [%v]", token)
+	}
+
+	again, err := store.TokenCreateWithOptions(ctx, "jane@example.com", "test_pass", 30, opts)
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if again != token {
+		t.Fatalf("TokenCreateWithOptions: Expected [%v] received [%v]", token, again)
+	}
+
+	other, err := store.TokenCreateWithOptions(ctx, "john@example.com", "test_pass", 30, opts)
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if other == token {
+		t.Fatalf("TokenCreateWithOptions: Expected different values to get different tokens")
+	}
+
+	count, err := store.RecordCount(ctx, RecordQuery())
+	if err != nil {
+		t.Fatalf("RecordCount: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if count != 2 {
+		t.Fatalf("RecordCount: Expected [2] received [%v]", count)
+	}
+
+	value, err := store.TokenRead(ctx, token, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != "jane@example.com" {
+		t.Fatalf("TokenRead: Expected [jane@example.com] received [%v]", value)
+	}
+
+	// the same value gets another token in another namespace
+	scoped, err := store.Namespace("acme").TokenCreateWithOptions(ctx, "jane@example.com", "test_pass", 30, opts)
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if scoped == token {
+		t.Fatalf("TokenCreateWithOptions: Expected a different token in another namespace")
+	}
+
+	if err := store.TokenUpdate(ctx, token, "other@example.com", "test_pass"); !errors.Is(err, ErrDeterministicTokenImmutable) {
+		t.Fatalf("TokenUpdate: Expected [%v] received [%v]", ErrDeterministicTokenImmutable, err)
+	}
+
+	if _, err := store.TokenCreateWithOptions(ctx, "jane@example.com", "test_pass", 10, opts); err == nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] for a short token received [nil]")
+	}
+
+	if err := store.TokenSoftDelete(ctx, token); err != nil {
+		t.Fatalf("TokenSoftDelete: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokenCreateWithOptions(ctx, "jane@example.com", "test_pass", 30, opts); err == nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] for a soft deleted token received [nil]")
+	}
+}
+
+func Test_Store_TokenFindByValue(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.DeterministicKey = []byte("0123456789abcdef0123456789abcdef")
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreateWithOptions(ctx, "jane@example.com", "test_pass", 20, TokenCreateOptions{Deterministic: true})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if _, err := store.TokenCreate(ctx, "john@example.com", "test_pass", 20); err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	found, err := store.TokenFindByValue(ctx, "jane@example.com")
+	if err != nil {
+		t.Fatalf("TokenFindByValue: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if found != token {
+		t.Fatalf("TokenFindByValue: Expected [%v] received [%v]", token, found)
+	}
+
+	// random tokens are not found by value
+	if _, err := store.TokenFindByValue(ctx, "john@example.com"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("TokenFindByValue: Expected [%v] received [%v]", ErrTokenNotFound, err)
+	}
+
+	record, err := store.RecordFindByToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RecordFindByToken: Expected [err] to be nil received [%v]", err.Error())
+	}
+	for column, stored := range record.Data() {
+		if strings.Contains(stored, "jane@example.com") {
+			t.Fatalf("RecordFindByToken: Expected no plaintext value, found in [%v]", column)
+		}
+	}
+}
+
+func Test_Store_TokenCreate_Deterministic_Denied(t *testing.T) {
+	evaluator, err := NewPolicyEvaluator(nil)
+	if err != nil {
+		t.Fatalf("NewPolicyEvaluator: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.DeterministicKey = []byte("0123456789abcdef0123456789abcdef")
+		options.PolicyEvaluator = evaluator
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	billing := WithPrincipal(context.Background(), "svc-billing")
+	shipping := WithPrincipal(context.Background(), "svc-shipping")
+
+	token, err := store.TokenCreateWithOptions(billing, "jane@example.com", "test_pass", 20, TokenCreateOptions{Deterministic: true})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	// another principal cannot obtain the token by creating the value again
+	created, err := store.TokenCreateWithOptions(shipping, "jane@example.com", "test_pass", 20, TokenCreateOptions{Deterministic: true})
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokenCreateWithOptions: Expected [%v] received [%v]", ErrPermissionDenied, err)
+	}
+	if created != "" || strings.Contains(err.Error(), token) {
+		t.Fatalf("TokenCreateWithOptions: Expected the token not to be disclosed received [%v] [%v]", created, err)
+	}
+
+	// nor by looking the value up
+	found, err := store.TokenFindByValue(shipping, "jane@example.com")
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("TokenFindByValue: Expected [%v] received [%v]", ErrPermissionDenied, err)
+	}
+	if found != "" || strings.Contains(err.Error(), token) {
+		t.Fatalf("TokenFindByValue: Expected the token not to be disclosed received [%v] [%v]", found, err)
+	}
+
+	var denied *PermissionError
+	if !errors.As(err, &denied) || denied.Token != "" {
+		t.Fatalf("TokenFindByValue: Expected a *PermissionError without the token received [%v]", err)
+	}
+
+	// the owner gets the same token
+	created, err = store.TokenCreateWithOptions(billing, "jane@example.com", "test_pass", 20, TokenCreateOptions{Deterministic: true})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if created != token {
+		t.Fatalf("TokenCreateWithOptions: Expected [%v] received [%v]", token, created)
+	}
+}
+
+func Test_Store_TokenFindByValue_KeyRequired(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	if _, err := store.TokenFindByValue(ctx, "jane@example.com"); !errors.Is(err, ErrDeterministicKeyRequired) {
+		t.Fatalf("TokenFindByValue: Expected [%v] received [%v]", ErrDeterministicKeyRequired, err)
+	}
+
+	if _, err := store.TokenCreateWithOptions(ctx, "jane@example.com", "test_pass", 20, TokenCreateOptions{Deterministic: true}); !errors.Is(err, ErrDeterministicKeyRequired) {
+		t.Fatalf("TokenCreateWithOptions: Expected [%v] received [%v]", ErrDeterministicKeyRequired, err)
+	}
+}
@@ -0,0 +1,271 @@
+package vaultstore
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// TOKEN_ALPHABET is the default alphabet of the random part of the tokens
+const TOKEN_ALPHABET = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// TOKEN_MAX_LENGTH is the length of the token column
+const TOKEN_MAX_LENGTH = 40
+
+// TokenFormat defines the format of the generated tokens
+type TokenFormat struct {
+	// Prefix starts every token (default: TOKEN_PREFIX)
+	Prefix string
+
+	// Alphabet are the characters of the random part of the token,
+	// at least 2 distinct characters (default: TOKEN_ALPHABET)
+	Alphabet string
+
+	// MinLength is the minimum token length, including the prefix
+	// (default: the prefix length + 5)
+	MinLength int
+
+	// MaxLength is the maximum token length, including the prefix,
+	// at most TOKEN_MAX_LENGTH (default: TOKEN_MAX_LENGTH)
+	MaxLength int
+
+	// CheckDigit ends the token with a Luhn mod N check character over
+	// the alphabet, so IsToken detects single typos and swapped characters
+	CheckDigit bool
+}
+
+// DefaultTokenFormat returns the default token format, "tk_" followed
+// by lower case letters and digits, without a check digit
+func DefaultTokenFormat() TokenFormat {
+	return TokenFormat{}.withDefaults()
+}
+
+// IsToken returns true if the string has the format of the tokens,
+// i.e. to reject typos before a database round trip
+//
+// Business logic:
+//  1. The string starts with the prefix
+//  2. Its length is between the minimum and maximum length
+//  3. The characters after the prefix are in the alphabet
+//  4. With a check digit, the last character matches the check digit
+//
+// Format preserving tokens have the format of their value, i.e. a card
+// number, so they are not recognized, use TokenExists to check them.
+func (f TokenFormat) IsToken(s string) bool {
+	f = f.withDefaults()
+
+	if !strings.HasPrefix(s, f.Prefix) || len(s) < f.MinLength || len(s) > f.MaxLength {
+		return false
+	}
+
+	payload := s[len(f.Prefix):]
+
+	for _, r := range payload {
+		if !strings.ContainsRune(f.Alphabet, r) {
+			return false
+		}
+	}
+
+	if !f.CheckDigit {
+		return true
+	}
+
+	check, err := checkCharacter(payload[:len(payload)-1], f.Alphabet)
+
+	return err == nil && payload[len(payload)-1] == check
+}
+
+// withDefaults returns the format with the defaults set
+func (f TokenFormat) withDefaults() TokenFormat {
+	if f.Prefix == "" {
+		f.Prefix = TOKEN_PREFIX
+	}
+
+	if f.Alphabet == "" {
+		f.Alphabet = TOKEN_ALPHABET
+	}
+
+	if f.MinLength == 0 {
+		f.MinLength = len(f.Prefix) + 5
+	}
+
+	if f.MaxLength == 0 {
+		f.MaxLength = TOKEN_MAX_LENGTH
+	}
+
+	return f
+}
+
+// validate checks the format fits the token column
+func (f TokenFormat) validate() error {
+	f = f.withDefaults()
+
+	if len(f.Alphabet) < 2 {
+		return errors.New("token format: alphabet must have at least 2 characters")
+	}
+
+	for i, r := range f.Alphabet {
+		if r > 127 {
+			return errors.New("token format: alphabet must be ASCII")
+		}
+
+		if strings.ContainsRune(f.Alphabet[i+1:], r) {
+			return errors.New("token format: alphabet has duplicate characters")
+		}
+	}
+
+	if f.MaxLength > TOKEN_MAX_LENGTH {
+		return errors.New("token format: max length cannot exceed " + strconv.Itoa(TOKEN_MAX_LENGTH))
+	}
+
+	if f.MinLength <= len(f.Prefix) {
+		return errors.New("token format: min length must be longer than the prefix")
+	}
+
+	if f.MinLength > f.MaxLength {
+		return errors.New("token format: min length cannot exceed max length")
+	}
+
+	if f.CheckDigit && f.MinLength < len(f.Prefix)+2 {
+		return errors.New("token format: min length is too short for a check digit")
+	}
+
+	return nil
+}
+
+// validateLength checks the token length is within the format bounds
+func (f TokenFormat) validateLength(tokenLength int) error {
+	if tokenLength < f.MinLength || tokenLength > f.MaxLength {
+		return errors.New("token length must be between " + strconv.Itoa(f.MinLength) + " and " + strconv.Itoa(f.MaxLength))
+	}
+
+	return nil
+}
+
+// generate generates a random token of the format
+func (f TokenFormat) generate(tokenLength int) (string, error) {
+	f = f.withDefaults()
+
+	if err := f.validateLength(tokenLength); err != nil {
+		return "", err
+	}
+
+	randomLength := tokenLength - len(f.Prefix)
+
+	if f.CheckDigit {
+		randomLength--
+	}
+
+	payload, err := randomFromAlphabet(randomLength, f.Alphabet)
+
+	if err != nil {
+		return "", err
+	}
+
+	return f.token(payload)
+}
+
+// derive derives a token of the format from a hash, used by the
+// deterministic tokens, the hash must be long enough for the length
+func (f TokenFormat) derive(hash []byte, tokenLength int) (string, error) {
+	f = f.withDefaults()
+
+	if err := f.validateLength(tokenLength); err != nil {
+		return "", err
+	}
+
+	payloadLength := tokenLength - len(f.Prefix)
+
+	if f.CheckDigit {
+		payloadLength--
+	}
+
+	number := new(big.Int).SetBytes(hash)
+	base := big.NewInt(int64(len(f.Alphabet)))
+	digit := new(big.Int)
+	payload := make([]byte, payloadLength)
+
+	for i := range payload {
+		number.DivMod(number, base, digit)
+		payload[i] = f.Alphabet[digit.Int64()]
+	}
+
+	return f.token(string(payload))
+}
+
+// token adds the prefix and check digit to the payload
+func (f TokenFormat) token(payload string) (string, error) {
+	if !f.CheckDigit {
+		return f.Prefix + payload, nil
+	}
+
+	check, err := checkCharacter(payload, f.Alphabet)
+
+	if err != nil {
+		return "", err
+	}
+
+	return f.Prefix + payload + string(check), nil
+}
+
+// checkCharacter returns the Luhn mod N check character of the payload
+func checkCharacter(payload string, alphabet string) (byte, error) {
+	n := len(alphabet)
+	factor := 2
+	sum := 0
+
+	for i := len(payload) - 1; i >= 0; i-- {
+		codePoint := strings.IndexByte(alphabet, payload[i])
+
+		if codePoint < 0 {
+			return 0, errors.New("token format: character not in the alphabet")
+		}
+
+		addend := factor * codePoint
+		factor = 3 - factor
+		sum += addend/n + addend%n
+	}
+
+	return alphabet[(n-sum%n)%n], nil
+}
+
+// randomFromAlphabet generates an unbiased random string of the alphabet
+func randomFromAlphabet(length int, alphabet string) (string, error) {
+	out := make([]byte, length)
+	max := big.NewInt(int64(len(alphabet)))
+
+	for i := range out {
+		index, err := rand.Int(rand.Reader, max)
+
+		if err != nil {
+			return "", err
+		}
+
+		out[i] = alphabet[index.Int64()]
+	}
+
+	return string(out), nil
+}
+
+// tokenFormat returns the token format of the namespace of the call,
+// or the store token format
+func (st *Store) tokenFormat(ctx context.Context) TokenFormat {
+	namespace, _ := st.namespaceFromContext(ctx)
+
+	if format, ok := st.tokenFormats[namespace]; ok {
+		return format.withDefaults()
+	}
+
+	return st.defaultTokenFormat.withDefaults()
+}
+
+// IsToken returns true if the string has the token format of the
+// namespace of the call, see TokenFormat.IsToken
+//
+// Format preserving tokens are not recognized, see TokenExists
+func (st *Store) IsToken(ctx context.Context, s string) bool {
+	return st.tokenFormat(ctx).IsToken(s)
+}
@@ -0,0 +1,200 @@
+package vaultstore
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log"
+	"math/big"
+	"strconv"
+	"unicode"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gouniverse/base/database"
+)
+
+// FORMAT_PRESERVING_MIN_RANDOM is the minimum number of random characters
+// of a format preserving token, shorter values are too easy to guess
+const FORMAT_PRESERVING_MIN_RANDOM = 4
+
+// FormatPreservingOptions define a format preserving token, a token with
+// the same length and character classes as the value, i.e. a 16 digit
+// token for a card number, fitting the legacy fixed width columns
+//
+// Digits are replaced by random digits, letters by random letters of the
+// same case, all other characters (separators) are kept as they are.
+type FormatPreservingOptions struct {
+	// Luhn makes the digits of the token pass the Luhn check, like a card number
+	Luhn bool
+
+	// PreserveLast keeps the last letters and digits of the value, i.e. 4
+	// for the last-4 digits of a card number (default: 0)
+	PreserveLast int
+}
+
+// tokenCreateFormatPreserving creates the record with a format preserving
+// token, generating a new token while the token is already taken
+func (st *Store) tokenCreateFormatPreserving(ctx context.Context, newEntry RecordInterface, data string, password string, opts FormatPreservingOptions) (string, error) {
+	// fail early, before encrypting, if the value cannot be tokenized
+	if _, err := generateFormatPreservingToken(data, opts); err != nil {
+		return "", err
+	}
+
+	return st.tokenCreateWithRetry(ctx, newEntry, data, password, func() (string, error) {
+		return generateFormatPreservingToken(data, opts)
+	})
+}
+
+// tokenTaken returns true if a record in any namespace holds the token,
+// including soft deleted and expired records, as the tables created
+// before the namespaces keep the tokens unique across namespaces
+func (st *Store) tokenTaken(ctx context.Context, token string) (bool, error) {
+	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
+		From(st.vaultTableName).
+		Prepared(true).
+		Select(goqu.COUNT(goqu.Star()).As("count")).
+		Where(goqu.C(COLUMN_VAULT_TOKEN).Eq(token)).
+		ToSQL()
+
+	if err != nil {
+		return false, err
+	}
+
+	if st.debugEnabled {
+		log.Println(sqlStr)
+	}
+
+	rows, err := database.SelectToMapString(st.toQuerableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(rows) > 0 && rows[0]["count"] != "0", nil
+}
+
+// generateFormatPreservingToken generates a random token with the format of the value
+//
+// Business logic:
+//  1. Digits are replaced by random digits, letters by random letters of
+//     the same case, the other characters are kept
+//  2. The last PreserveLast letters and digits are kept
+//  3. With Luhn, the last random digit is chosen to pass the Luhn check
+//  4. The token never equals the value
+func generateFormatPreservingToken(value string, opts FormatPreservingOptions) (string, error) {
+	runes := []rune(value)
+
+	if len(runes) > TOKEN_MAX_LENGTH {
+		return "", errors.New("format preserving token: value is longer than " + strconv.Itoa(TOKEN_MAX_LENGTH) + " characters")
+	}
+
+	if opts.PreserveLast < 0 {
+		return "", errors.New("format preserving token: preserve last cannot be negative")
+	}
+
+	// the positions of the letters and digits, the ones replaced
+	positions := []int{}
+
+	for i, r := range runes {
+		if opts.Luhn && (r < '0' || r > '9') && !unicode.IsSpace(r) && r != '-' {
+			return "", errors.New("format preserving token: Luhn requires a numeric value")
+		}
+
+		if isFormatPreservingRune(r) {
+			positions = append(positions, i)
+		}
+	}
+
+	random := positions[:max(len(positions)-opts.PreserveLast, 0)]
+
+	if len(random) < FORMAT_PRESERVING_MIN_RANDOM {
+		return "", errors.New("format preserving token: value is too short to tokenize")
+	}
+
+	for {
+		token := append([]rune{}, runes...)
+
+		for _, i := range random {
+			r, err := randomRuneLike(runes[i])
+
+			if err != nil {
+				return "", err
+			}
+
+			token[i] = r
+		}
+
+		if opts.Luhn {
+			luhnFix(token, random[len(random)-1])
+		}
+
+		if string(token) != value {
+			return string(token), nil
+		}
+	}
+}
+
+// isFormatPreservingRune returns true if the rune is replaced in the token
+func isFormatPreservingRune(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// randomRuneLike returns a random rune of the character class of the rune
+func randomRuneLike(r rune) (rune, error) {
+	gamma := "0123456789"
+
+	if r >= 'a' && r <= 'z' {
+		gamma = "abcdefghijklmnopqrstuvwxyz"
+	} else if r >= 'A' && r <= 'Z' {
+		gamma = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	}
+
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(len(gamma))))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return rune(gamma[index.Int64()]), nil
+}
+
+// luhnFix sets the digit at the position so the digits of the token pass
+// the Luhn check, the other characters are ignored
+func luhnFix(token []rune, position int) {
+	for digit := '0'; digit <= '9'; digit++ {
+		token[position] = digit
+
+		if luhnValid(string(token)) {
+			return
+		}
+	}
+}
+
+// luhnValid returns true if the digits of the value pass the Luhn check,
+// the other characters are ignored
+func luhnValid(value string) bool {
+	sum := 0
+	double := false
+	runes := []rune(value)
+
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] < '0' || runes[i] > '9' {
+			continue
+		}
+
+		digit := int(runes[i] - '0')
+
+		if double {
+			digit *= 2
+
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
@@ -0,0 +1,114 @@
+package vaultstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func Test_Store_TokenCreate_FormatPreserving(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+	card := "4111-1111-1111-1111"
+
+	token, err := store.TokenCreateWithOptions(ctx, card, "test_pass", 20, TokenCreateOptions{
+		FormatPreserving: &FormatPreservingOptions{Luhn: true, PreserveLast: 4},
+	})
+	if err != nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if len(token) != len(card) || token == card {
+		t.Fatalf("TokenCreateWithOptions: Unexpected token [%v]", token)
+	}
+	if !strings.HasSuffix(token, "-1111") || strings.Count(token, "-") != 3 {
+		t.Fatalf("TokenCreateWithOptions: Expected the separators and last-4 to be kept received [%v]", token)
+	}
+	if !luhnValid(token) {
+		t.Fatalf("TokenCreateWithOptions: Expected a Luhn valid token received [%v]", token)
+	}
+
+	value, err := store.TokenRead(ctx, token, "test_pass")
+	if err != nil {
+		t.Fatalf("TokenRead: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if value != card {
+		t.Fatalf("TokenRead: Expected [%v] received [%v]", card, value)
+	}
+
+	taken, err := store.(*Store).tokenTaken(ctx, token)
+	if err != nil {
+		t.Fatalf("tokenTaken: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if !taken {
+		t.Fatalf("tokenTaken: Expected [true] received [false]")
+	}
+
+	// the token has the format of the value, only TokenExists recognizes it
+	if IsToken(token) || store.IsToken(ctx, token) {
+		t.Fatalf("IsToken: Expected format preserving token [%v] not to be recognized", token)
+	}
+
+	exists, err := store.TokenExists(ctx, token)
+	if err != nil {
+		t.Fatalf("TokenExists: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if !exists {
+		t.Fatalf("TokenExists: Expected [true] received [false]")
+	}
+
+	if _, err := store.TokenCreateWithOptions(ctx, card, "test_pass", 20, TokenCreateOptions{
+		Deterministic:    true,
+		FormatPreserving: &FormatPreservingOptions{},
+	}); err == nil {
+		t.Fatalf("TokenCreateWithOptions: Expected [err] for deterministic and format preserving received [nil]")
+	}
+}
+
+func Test_generateFormatPreservingToken(t *testing.T) {
+	token, err := generateFormatPreservingToken("+1 (555) 123-4567", FormatPreservingOptions{})
+	if err != nil {
+		t.Fatalf("generateFormatPreservingToken: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if len(token) != 17 || token[0] != '+' || token[2:4] != " (" || token[7:9] != ") " || token[12] != '-' {
+		t.Fatalf("generateFormatPreservingToken: Expected the phone format to be kept received [%v]", token)
+	}
+
+	token, err = generateFormatPreservingToken("AB12cd34", FormatPreservingOptions{PreserveLast: 2})
+	if err != nil {
+		t.Fatalf("generateFormatPreservingToken: Expected [err] to be nil received [%v]", err.Error())
+	}
+	for i, r := range token[:6] {
+		original := rune("AB12cd34"[i])
+		if (original >= 'A' && original <= 'Z') != (r >= 'A' && r <= 'Z') ||
+			(original >= 'a' && original <= 'z') != (r >= 'a' && r <= 'z') ||
+			(original >= '0' && original <= '9') != (r >= '0' && r <= '9') {
+			t.Fatalf("generateFormatPreservingToken: Expected the character classes to be kept received [%v]", token)
+		}
+	}
+	if token[6:] != "34" {
+		t.Fatalf("generateFormatPreservingToken: Expected the last 2 to be kept received [%v]", token)
+	}
+
+	if _, err := generateFormatPreservingToken("1234-5678", FormatPreservingOptions{PreserveLast: 5}); err == nil {
+		t.Fatalf("generateFormatPreservingToken: Expected [err] for a short value received [nil]")
+	}
+
+	if _, err := generateFormatPreservingToken("4111x1111", FormatPreservingOptions{Luhn: true}); err == nil {
+		t.Fatalf("generateFormatPreservingToken: Expected [err] for Luhn on a non numeric value received [nil]")
+	}
+}
+
+func Test_luhnValid(t *testing.T) {
+	if !luhnValid("4111 1111 1111 1111") {
+		t.Fatalf("luhnValid: Expected [true] received [false]")
+	}
+
+	if luhnValid("4111 1111 1111 1112") {
+		t.Fatalf("luhnValid: Expected [false] received [true]")
+	}
+}
@@ -0,0 +1,110 @@
+package vaultstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func Test_TokenFormat_CheckDigit(t *testing.T) {
+	format := TokenFormat{Prefix: "cus_", Alphabet: "0123456789ABCDEF", CheckDigit: true}
+
+	if err := format.validate(); err != nil {
+		t.Fatalf("validate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	token, err := format.generate(24)
+	if err != nil {
+		t.Fatalf("generate: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	if len(token) != 24 || !strings.HasPrefix(token, "cus_") {
+		t.Fatalf("generate: Unexpected token [%v]", token)
+	}
+
+	if !format.IsToken(token) {
+		t.Fatalf("IsToken: Expected [true] received [false] for [%v]", token)
+	}
+
+	// a single typo is detected by the check digit
+	for i := len("cus_"); i < len(token); i++ {
+		typo := []byte(token)
+		typo[i] = format.Alphabet[(strings.IndexByte(format.Alphabet, typo[i])+1)%len(format.Alphabet)]
+
+		if format.IsToken(string(typo)) {
+			t.Fatalf("IsToken: Expected [false] received [true] for the typo [%v]", string(typo))
+		}
+	}
+
+	if IsToken(token) {
+		t.Fatalf("IsToken: Expected the default format to reject [%v]", token)
+	}
+}
+
+func Test_TokenFormat_Validate(t *testing.T) {
+	invalid := []TokenFormat{
+		{MaxLength: 41},
+		{Prefix: "tk_", MinLength: 3},
+		{MinLength: 30, MaxLength: 20},
+		{Alphabet: "a"},
+		{Alphabet: "abca"},
+	}
+
+	for _, format := range invalid {
+		if err := format.validate(); err == nil {
+			t.Fatalf("validate: Expected [err] for [%+v] received [nil]", format)
+		}
+	}
+
+	if _, err := DefaultTokenFormat().generate(41); err == nil {
+		t.Fatalf("generate: Expected [err] for a token longer than the column received [nil]")
+	}
+
+	if _, err := DefaultTokenFormat().generate(3); err == nil {
+		t.Fatalf("generate: Expected [err] for a token shorter than the prefix received [nil]")
+	}
+}
+
+func Test_Store_TokenFormat(t *testing.T) {
+	store, err := initStore(":memory:", func(options *NewStoreOptions) {
+		options.TokenFormat = TokenFormat{Prefix: "sec_", CheckDigit: true}
+		options.TokenFormats = map[string]TokenFormat{
+			"acme": {Prefix: "acme_", Alphabet: "0123456789"},
+		}
+	})
+	if err != nil {
+		t.Fatalf("initStore: Expected [err] to be nil received [%v]", err.Error())
+	}
+
+	ctx := context.Background()
+
+	token, err := store.TokenCreate(ctx, "secret", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if !strings.HasPrefix(token, "sec_") || !store.IsToken(ctx, token) {
+		t.Fatalf("TokenCreate: Unexpected token [%v]", token)
+	}
+
+	acme := store.Namespace("acme")
+
+	token, err = acme.TokenCreate(ctx, "secret", "test_pass", 20)
+	if err != nil {
+		t.Fatalf("TokenCreate: Expected [err] to be nil received [%v]", err.Error())
+	}
+	if !strings.HasPrefix(token, "acme_") || !acme.IsToken(ctx, token) || store.IsToken(ctx, token) {
+		t.Fatalf("TokenCreate: Unexpected namespace token [%v]", token)
+	}
+
+	if _, err := store.TokenCreate(ctx, "secret", "test_pass", 41); err == nil {
+		t.Fatalf("TokenCreate: Expected [err] for a token longer than the column received [nil]")
+	}
+
+	if _, err := NewStore(NewStoreOptions{
+		VaultTableName: "vault_token_format",
+		DB:             store.(*Store).db,
+		TokenFormat:    TokenFormat{MaxLength: 50},
+	}); err == nil {
+		t.Fatalf("NewStore: Expected [err] for an invalid token format received [nil]")
+	}
+}